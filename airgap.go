@@ -0,0 +1,111 @@
+package patchenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// airGappedVar is the environment variable that, when set to "1", forbids
+// loading variables over the network, like WithAirGapped.
+const airGappedVar = "PATCH_ENV_AIR_GAPPED"
+
+// ErrAirGapped is returned (wrapped with a description of the source) by
+// PatchWith and Resolve in air-gapped mode when a Source or Runner would
+// use the network.
+var ErrAirGapped = errors.New("patchenv: network access is forbidden in air-gapped mode")
+
+// NetworkUser is implemented by Sources and Runners that make network
+// connections, so air-gapped mode can refuse to use them.  Providers whose
+// Sources talk to a remote service implement it; Sources that wrap other
+// Sources, like CachedSource, implement it by asking the Source they wrap.
+type NetworkUser interface {
+	// UsesNetwork reports whether loading or running makes network
+	// connections.
+	UsesNetwork() bool
+}
+
+// WithAirGapped enables air-gapped mode, for regulated environments where
+// patchenv must not reach out over the network.  In air-gapped mode,
+// PatchWith and Resolve fail with an error wrapping ErrAirGapped before
+// loading from a Source (or running a command with a Runner) that
+// implements NetworkUser and uses the network, like URLSource.  Commands
+// run with ShellRunner and provider plugins are run in a Sandbox with
+// NoNetwork set, which fails on platforms that don't support sandboxing.
+// Setting the PATCH_ENV_AIR_GAPPED environment variable to "1" has the same
+// effect, and can't be overridden by the program.
+func WithAirGapped() Option {
+	return func(cfg *config) {
+		cfg.airGapped = true
+	}
+}
+
+// usesNetwork reports whether src, or the Runner it runs commands with,
+// reports that it uses the network.
+func usesNetwork(src Source) bool {
+	if m, ok := src.(multiSource); ok {
+		for _, s := range m {
+			if usesNetwork(s) {
+				return true
+			}
+		}
+		return false
+	}
+	if n, ok := src.(NetworkUser); ok && n.UsesNetwork() {
+		return true
+	}
+	if cs, ok := src.(*CommandSource); ok {
+		n, ok := cs.runner().(NetworkUser)
+		return ok && n.UsesNetwork()
+	}
+	return false
+}
+
+// checkAirGapped returns an error wrapping ErrAirGapped if air-gapped mode
+// is enabled and src uses the network.
+func (cfg *config) checkAirGapped(src Source) error {
+	if cfg.airGapped && usesNetwork(src) {
+		return fmt.Errorf("%w: %s uses the network", ErrAirGapped, describeSource(src))
+	}
+	return nil
+}
+
+// airGappedKey is the context key for the air-gapped mode flag.
+type airGappedKey struct{}
+
+// withAirGapped returns a copy of ctx that enables air-gapped mode for the
+// commands run while loading, if airGapped is true.
+func withAirGapped(ctx context.Context, airGapped bool) context.Context {
+	if !airGapped {
+		return ctx
+	}
+	return context.WithValue(ctx, airGappedKey{}, true)
+}
+
+// airGappedFrom reports whether ctx enables air-gapped mode.
+func airGappedFrom(ctx context.Context) bool {
+	airGapped, _ := ctx.Value(airGappedKey{}).(bool)
+	return airGapped
+}
+
+// noNetwork returns a copy of r with the network disabled by its Sandbox,
+// if r is a ShellRunner, or r itself otherwise.
+func noNetwork(r Runner) Runner {
+	var shell ShellRunner
+	switch sr := r.(type) {
+	case nil:
+	case ShellRunner:
+		shell = sr
+	case *ShellRunner:
+		shell = *sr
+	default:
+		return r
+	}
+	sandbox := Sandbox{}
+	if shell.Sandbox != nil {
+		sandbox = *shell.Sandbox
+	}
+	sandbox.NoNetwork = true
+	shell.Sandbox = &sandbox
+	return shell
+}
@@ -0,0 +1,127 @@
+package patchenv
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Changes is a list of variables to set and unset, in order, like the
+// Vars of a Result.
+type Changes []Var
+
+// Apply returns a copy of base, an environment in the "name=value" form of
+// os.Environ and exec.Cmd.Env, with changes applied, for building the
+// environment of a child process by hand:
+//
+//	cmd.Env = patchenv.Apply(os.Environ(), result.Vars)
+//
+// The result has one entry per name.  A variable that's in base keeps its
+// position, and new variables are added at the end in the order they
+// were first set.  If base has a name more than once, the last value wins,
+// as it does for exec.Cmd.  On Windows, names are case-insensitive, and a
+// change keeps the spelling of the name in base.  Entries without a name,
+// like Windows' "=C:=C:\dir" entries, are kept as they are.
+func Apply(base []string, changes Changes) []string {
+	return applyEnv(base, changes, runtime.GOOS == "windows")
+}
+
+// applyEnv implements Apply, comparing names case-insensitively if
+// foldCase is true.
+func applyEnv(base []string, changes Changes, foldCase bool) []string {
+	type entry struct {
+		name, value string
+
+		// raw is an entry of base kept as it is, or empty.
+		raw string
+
+		removed bool
+	}
+	entries := make([]entry, 0, len(base)+len(changes))
+	index := make(map[string]int, len(base))
+	set := func(name, value string, removed bool) {
+		key := name
+		if foldCase {
+			key = strings.ToUpper(name)
+		}
+		if i, ok := index[key]; ok {
+			entries[i].value, entries[i].removed = value, removed
+			return
+		}
+		if !removed {
+			index[key] = len(entries)
+			entries = append(entries, entry{name: name, value: value})
+		}
+	}
+
+	for _, kv := range base {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			entries = append(entries, entry{raw: kv})
+			continue
+		}
+		set(kv[:i], kv[i+1:], false)
+	}
+	for _, v := range changes {
+		set(v.Name, v.Value, v.Unset)
+	}
+
+	env := make([]string, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case e.raw != "":
+			env = append(env, e.raw)
+		case !e.removed:
+			env = append(env, e.name+"="+e.value)
+		}
+	}
+	return env
+}
+
+// pathListVars are the variables EnvironFor treats as lists of paths.
+var pathListVars = []string{
+	"PATH", "CLASSPATH", "GOPATH", "LD_LIBRARY_PATH", "MANPATH",
+	"NODE_PATH", "PERL5LIB", "PKG_CONFIG_PATH", "PSModulePath", "PYTHONPATH",
+}
+
+// EnvironFor returns the result's variables in "name=value" form for a
+// process on the operating system goos (using the values of
+// runtime.GOOS), for tools that build environments for remote execution on
+// another platform.  Like Apply, it keeps one entry per name, compares names
+// case-insensitively if goos is "windows", and leaves unset variables out.
+//
+// The values of variables that hold lists of paths, like PATH, GOPATH, and
+// PYTHONPATH, have their list separators changed from this platform's to
+// goos's.  The paths themselves aren't converted; use a Transform like
+// WindowsToWSLPath for that.
+func (r *Result) EnvironFor(goos string) []string {
+	foldCase := goos == "windows"
+	env := applyEnv(nil, r.Vars, foldCase)
+	from, to := listSeparator(runtime.GOOS), listSeparator(goos)
+	if from == to {
+		return env
+	}
+	for i, kv := range env {
+		eq := strings.Index(kv, "=")
+		name := kv[:eq]
+		for _, list := range pathListVars {
+			if name == list || (foldCase && strings.EqualFold(name, list)) {
+				env[i] = name + "=" + strings.ReplaceAll(kv[eq+1:], from, to)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// listSeparator returns the path list separator of the operating system
+// goos, like os.PathListSeparator.
+func listSeparator(goos string) string {
+	switch goos {
+	case "windows":
+		return ";"
+	case "plan9":
+		return "\x00"
+	default:
+		return ":"
+	}
+}
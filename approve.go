@@ -0,0 +1,123 @@
+package patchenv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// approveVar is the environment variable that, when set to "1", makes
+// PatchWith ask for confirmation on the terminal, like
+// WithInteractiveApproval.
+const approveVar = "PATCH_ENV_APPROVE"
+
+// ErrNotApproved is returned by PatchWith when the changes it was about to
+// make weren't approved.  The environment is left as it was.
+var ErrNotApproved = errors.New("patchenv: the changes to the environment were not approved")
+
+// WithApproval makes PatchWith call approve with the changes it's about to
+// make to the environment, and make them only if it returns true.
+// Otherwise, PatchWith returns ErrNotApproved, or the error approve
+// returned, without changing anything.  Variables that already have the
+// values they'd be set to aren't passed to approve, and if nothing would
+// change, it isn't called.  Resolve doesn't call it, since it doesn't
+// change the environment.
+func WithApproval(approve func(Changes) (bool, error)) Option {
+	return func(cfg *config) {
+		cfg.approve = approve
+	}
+}
+
+// WithInteractiveApproval makes PatchWith show the changes it's about to
+// make on stderr and ask for confirmation on stdin, as PromptApproval does,
+// guarding against surprises from the configuration of a project you
+// don't trust yet.  It's meant for command-line tools and development.
+// Setting the PATCH_ENV_APPROVE environment variable to "1" has the same
+// effect.
+func WithInteractiveApproval() Option {
+	return WithApproval(PromptApproval(os.Stdin, os.Stderr))
+}
+
+// PromptApproval returns a function for WithApproval that writes the
+// changes to out, as WriteChanges does, and asks whether to apply them.  It
+// reads the answer from in, and approves if it's "y" or "yes".
+func PromptApproval(in io.Reader, out io.Writer) func(Changes) (bool, error) {
+	return func(changes Changes) (bool, error) {
+		fmt.Fprintln(out, "patchenv will change these environment variables:")
+		if err := WriteChanges(out, changes); err != nil {
+			return false, err
+		}
+		fmt.Fprint(out, "Apply these changes? [y/N] ")
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !(err == io.EOF && answer != "") {
+			fmt.Fprintln(out)
+			return false, fmt.Errorf("patchenv: can't read the answer: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
+// WriteChanges writes a summary of changes to w for a person to review, one
+// line per variable, compared with the current environment: "+" for a
+// variable that will be added, "~" for one that will change, and "-" for
+// one that will be unset.  Secret values, and the values they replace,
+// are redacted.
+func WriteChanges(w io.Writer, changes Changes) error {
+	var b strings.Builder
+	for _, v := range changes {
+		old, ok := os.LookupEnv(v.Name)
+		switch {
+		case v.Unset:
+			fmt.Fprintf(&b, "  - %s\n", v.Name)
+		case v.Secret && ok:
+			fmt.Fprintf(&b, "  ~ %s = (secret, %d bytes)\n", v.Name, len(v.Value))
+		case v.Secret:
+			fmt.Fprintf(&b, "  + %s = (secret, %d bytes)\n", v.Name, len(v.Value))
+		case ok:
+			fmt.Fprintf(&b, "  ~ %s = %q (was %q)\n", v.Name, v.Value, old)
+		default:
+			fmt.Fprintf(&b, "  + %s = %q\n", v.Name, v.Value)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// approveChanges asks the approval function, if there is one, whether vars
+// may be applied to the environment.
+func (cfg *config) approveChanges(vars []Var) error {
+	if cfg.approve == nil {
+		return nil
+	}
+	var changes Changes
+	for _, v := range vars {
+		old, ok := os.LookupEnv(v.Name)
+		if v.Unset && !ok || !v.Unset && ok && old == v.Value {
+			continue
+		}
+		changes = append(changes, v)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	var ok bool
+	err := cfg.guard("approval", func() (err error) {
+		ok, err = cfg.approve(changes)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotApproved
+	}
+	cfg.trace.printf("%d changes were approved", len(changes))
+	return nil
+}
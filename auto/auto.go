@@ -0,0 +1,21 @@
+// Package auto patches the running process's environment as a side effect of
+// being imported.  Programs that only need the default behavior of
+// patchenv.Patch() can adopt patchenv with a single blank import:
+//
+//	import _ "github.com/arpio/patchenv/auto"
+//
+// The environment is patched in the package's init() function, so it is
+// updated before the importing package's own init() functions and main()
+// run.
+//
+// By default, a failure to patch the environment panics.  Build with the
+// patchenv_nopanic tag to log the error and continue instead.
+package auto
+
+import "github.com/arpio/patchenv"
+
+func init() {
+	if err := patchenv.Patch(); err != nil {
+		handleError(err)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build patchenv_nopanic
+// +build patchenv_nopanic
+
+package auto
+
+import "log"
+
+// handleError logs the error returned by patchenv.Patch() so the program can
+// continue running with its unpatched environment.
+func handleError(err error) {
+	log.Printf("[WARNING] patchenv: %s", err)
+}
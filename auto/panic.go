@@ -0,0 +1,9 @@
+//go:build !patchenv_nopanic
+// +build !patchenv_nopanic
+
+package auto
+
+// handleError panics with the error returned by patchenv.Patch().
+func handleError(err error) {
+	panic(err)
+}
@@ -0,0 +1,393 @@
+package patchenv
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// bundleFormat identifies a snapshot bundle, and prefixes the message that
+// its signature covers, so a bundle's signature can't be used for anything
+// else signed with the same key.
+const bundleFormat = "patchenv-bundle"
+
+// bundleVersion is the version of the snapshot bundle format.
+const bundleVersion = 1
+
+// EncryptionKeySize is the size in bytes of the AES-256 keys used to
+// encrypt snapshot bundles.
+const EncryptionKeySize = 32
+
+// bundleFile is the JSON document a snapshot bundle is stored as.
+type bundleFile struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+
+	// Algorithm names the signature algorithm, like "ed25519" or
+	// "ecdsa-p256-sha256".
+	Algorithm string `json:"algorithm"`
+
+	// Body is the JSON-encoded bundleBody that Signature covers.
+	Body      []byte `json:"body"`
+	Signature []byte `json:"signature"`
+}
+
+// bundleBody is the signed part of a snapshot bundle.
+type bundleBody struct {
+	Created time.Time `json:"created"`
+
+	// Nonce is the AES-GCM nonce if Payload is encrypted, or empty.
+	Nonce []byte `json:"nonce,omitempty"`
+
+	// Payload is a JSON envelope holding the variables, encrypted if Nonce
+	// is set.
+	Payload []byte `json:"payload"`
+}
+
+// WriteBundle writes a snapshot bundle of the result's variables to w:
+// a file that BundleSource can load later, on a host that can't reach the
+// sources the variables came from.  The bundle is signed with key, an
+// Ed25519 or ECDSA (P-256 or P-384) private key, so BundleSource can check
+// that it hasn't been tampered with; only ECDSA is allowed in FIPSMode.  If
+// encryptionKey isn't nil, it must be EncryptionKeySize bytes long, and the
+// variables are encrypted with it using AES-GCM; otherwise they're stored
+// in the clear, so the bundle should be protected like the secrets it
+// holds.  The contents of File variables are included, and written to new
+// temporary files when the bundle is loaded.
+func (r *Result) WriteBundle(w io.Writer, key crypto.Signer, encryptionKey []byte) error {
+	algorithm, hash, err := signatureAlgorithm(key.Public())
+	if err != nil {
+		return fmt.Errorf("patchenv: can't sign the bundle: %w", err)
+	}
+	payload, err := r.bundlePayload()
+	if err != nil {
+		return err
+	}
+
+	body := bundleBody{Created: time.Now().UTC().Truncate(time.Second), Payload: payload}
+	if encryptionKey != nil {
+		aead, err := newBundleCipher(encryptionKey)
+		if err != nil {
+			return err
+		}
+		body.Nonce = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(body.Nonce); err != nil {
+			return err
+		}
+		body.Payload = aead.Seal(nil, body.Nonce, payload, nil)
+	}
+
+	signed, err := json.Marshal(&body)
+	if err != nil {
+		return err
+	}
+	signature, err := key.Sign(rand.Reader, digest(bundleMessage(signed), hash), hash)
+	if err != nil {
+		return fmt.Errorf("patchenv: can't sign the bundle: %w", err)
+	}
+	data, err := json.MarshalIndent(&bundleFile{
+		Format:    bundleFormat,
+		Version:   bundleVersion,
+		Algorithm: algorithm,
+		Body:      signed,
+		Signature: signature,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// bundlePayload returns the result's variables as a JSON envelope.
+func (r *Result) bundlePayload() ([]byte, error) {
+	env := struct {
+		Version int            `json:"version"`
+		Vars    []envelopeVar  `json:"vars"`
+		Unset   []string       `json:"unset,omitempty"`
+		Files   []envelopeFile `json:"files,omitempty"`
+	}{Version: protocolVersion, Vars: []envelopeVar{}}
+	for _, v := range r.finalVars() {
+		switch {
+		case v.Unset:
+			env.Unset = append(env.Unset, v.Name)
+		case v.File:
+			content, err := os.ReadFile(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("patchenv: can't read the file for %s: %w", v.Name, err)
+			}
+			env.Files = append(env.Files, envelopeFile{
+				Name:    v.Name,
+				Content: base64.StdEncoding.EncodeToString(content),
+				Base64:  true,
+				Secret:  v.Secret,
+			})
+		default:
+			env.Vars = append(env.Vars, envelopeVar{
+				Name:    v.Name,
+				Value:   v.Value,
+				Secret:  v.Secret,
+				Expires: v.Expires,
+			})
+		}
+	}
+	return json.Marshal(&env)
+}
+
+// bundleMessage returns the message that a bundle's signature covers.
+func bundleMessage(body []byte) []byte {
+	return append([]byte(bundleFormat+"\x00"), body...)
+}
+
+// digest returns the hash of message, or message itself if hash is zero,
+// for signature algorithms like Ed25519 that hash the message themselves.
+func digest(message []byte, hash crypto.Hash) []byte {
+	if hash == 0 {
+		return message
+	}
+	h := hash.New()
+	h.Write(message)
+	return h.Sum(nil)
+}
+
+// verifySignature checks the signature of a bundle made with algorithm.
+func verifySignature(key crypto.PublicKey, algorithm string, message, signature []byte) error {
+	want, hash, err := signatureAlgorithm(key)
+	if err != nil {
+		return err
+	}
+	if algorithm != want {
+		return fmt.Errorf("bundle is signed with %s, but the public key is for %s", algorithm, want)
+	}
+	var ok bool
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, message, signature)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, digest(message, hash), signature)
+	}
+	if !ok {
+		return errors.New("bundle signature is invalid")
+	}
+	return nil
+}
+
+// newBundleCipher returns the AES-GCM cipher for key.
+func newBundleCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("patchenv: bundle encryption key must be %d bytes, not %d",
+			EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// BundleSource is a Source that loads the variables from a snapshot bundle
+// written by Result.WriteBundle, for hosts that can't reach the sources the
+// environment was resolved from.  Load fails unless the bundle is signed
+// with the private key for PublicKey.
+type BundleSource struct {
+	// Path is the path of the bundle.
+	Path string
+
+	// PublicKey verifies the bundle's signature.  It's an
+	// ed25519.PublicKey or an *ecdsa.PublicKey.
+	PublicKey crypto.PublicKey
+
+	// EncryptionKey decrypts the bundle, if it's encrypted.
+	EncryptionKey []byte
+
+	// MaxAge rejects bundles created more than MaxAge ago, or is zero to
+	// accept bundles of any age.
+	MaxAge time.Duration
+
+	// FileDir is the directory that File variables' contents are written
+	// to, or empty to use the default directory for temporary files.
+	FileDir string
+}
+
+// Load implements the Source interface.
+func (s *BundleSource) Load(ctx context.Context) ([]Var, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read bundle: %w", err)
+	}
+	payload, err := s.open(data)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: %s: %w", s.Path, err)
+	}
+	return (&Parser{FileDir: s.FileDir}).parseEnvelope(bytes.NewReader(payload))
+}
+
+// open verifies and decrypts the bundle in data and returns its payload.
+func (s *BundleSource) open(data []byte) ([]byte, error) {
+	var f bundleFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Format != bundleFormat {
+		return nil, errors.New("not a patchenv bundle")
+	}
+	if f.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", f.Version)
+	}
+	if s.PublicKey == nil {
+		return nil, errors.New("no public key to verify the bundle with")
+	}
+	if err := verifySignature(s.PublicKey, f.Algorithm, bundleMessage(f.Body), f.Signature); err != nil {
+		return nil, err
+	}
+
+	var body bundleBody
+	if err := json.Unmarshal(f.Body, &body); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if s.MaxAge > 0 && time.Since(body.Created) > s.MaxAge {
+		return nil, fmt.Errorf("bundle created at %s is older than %s",
+			body.Created.Format(time.RFC3339), s.MaxAge)
+	}
+	if len(body.Nonce) == 0 {
+		return body.Payload, nil
+	}
+	if s.EncryptionKey == nil {
+		return nil, errors.New("bundle is encrypted, but there's no key to decrypt it")
+	}
+	aead, err := newBundleCipher(s.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := aead.Open(nil, body.Nonce, body.Payload, nil)
+	if err != nil {
+		return nil, errors.New("can't decrypt the bundle with the given key")
+	}
+	return payload, nil
+}
+
+// openBundle is the SourceFactory for
+// "bundle:PATH?key=KEYFILE&encryption-key=KEYFILE&max-age=DURATION" URIs.
+// key names a PEM file holding the public key, and encryption-key
+// a file holding the base64-encoded encryption key.
+func openBundle(uri string) (Source, error) {
+	rest := uriRest(uri)
+	path, query := rest, ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+	if path == "" {
+		return nil, errors.New("no path")
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &BundleSource{Path: path}
+	if src.PublicKey, err = readPublicKey(params.Get("key")); err != nil {
+		return nil, err
+	}
+	if keyFile := params.Get("encryption-key"); keyFile != "" {
+		if src.EncryptionKey, err = ReadEncryptionKey(keyFile); err != nil {
+			return nil, err
+		}
+	}
+	if maxAge := params.Get("max-age"); maxAge != "" {
+		if src.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// readPublicKey reads an Ed25519 or ECDSA public key from the PEM file at
+// path, as written by "openssl pkey -pubout".
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	if path == "" {
+		return nil, errors.New("no public key")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s isn't a PEM file", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, _, err := signatureAlgorithm(key); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ReadSigningKey reads an Ed25519 or ECDSA private key for
+// Result.WriteBundle from the PEM file at path, as written by
+// "openssl genpkey -algorithm ed25519" or
+// "openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256".
+func ReadSigningKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("patchenv: %s isn't a PEM file", path)
+	}
+	var key interface{}
+	if block.Type == "EC PRIVATE KEY" {
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("patchenv: %s isn't an Ed25519 or ECDSA private key", path)
+	}
+	if _, _, err := signatureAlgorithm(signer.Public()); err != nil {
+		return nil, fmt.Errorf("patchenv: %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// ReadEncryptionKey reads a bundle encryption key from the file at path,
+// which holds the key encoded in base64, as written by
+// "openssl rand -base64 32".
+func ReadEncryptionKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: %s isn't base64-encoded: %w", path, err)
+	}
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("patchenv: %s holds a %d-byte key, not %d bytes",
+			path, len(key), EncryptionKeySize)
+	}
+	return key, nil
+}
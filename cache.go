@@ -0,0 +1,140 @@
+package patchenv
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedSource is a Source that wraps another Source and reuses the
+// variables it loaded until they're older than TTL or one of them expires,
+// so refreshing the environment doesn't call a rate-limited API every time.
+// If the wrapped Source is a Watcher, so is the CachedSource, and a change
+// it reports discards the cached variables.
+type CachedSource struct {
+	// Source is the wrapped Source.
+	Source Source
+
+	// TTL is how long the variables are reused.  If it's zero, they're
+	// reused until one of them expires or the Source reports a change.
+	TTL time.Duration
+
+	// StaleOnError makes Load return the cached variables, if none of them
+	// have expired, when the wrapped Source fails, logging a warning.
+	StaleOnError bool
+
+	mu     sync.Mutex
+	vars   []Var
+	loaded time.Time
+	valid  bool
+}
+
+// Load implements the Source interface.
+func (c *CachedSource) Load(ctx context.Context) ([]Var, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	fresh := c.valid && (c.TTL <= 0 || now.Sub(c.loaded) < c.TTL)
+	if fresh && !expired(c.vars, now) {
+		atomic.AddUint64(&statCacheHits, 1)
+		traceFrom(ctx).printf("using %d cached variables loaded %s ago",
+			len(c.vars), now.Sub(c.loaded).Round(time.Millisecond))
+		return cloneVars(c.vars), nil
+	}
+
+	atomic.AddUint64(&statCacheMisses, 1)
+	vars, err := c.Source.Load(ctx)
+	if err != nil {
+		if c.StaleOnError && c.valid && !expired(c.vars, now) {
+			log.Printf("[WARNING] patchenv: using cached variables: %s", err)
+			return cloneVars(c.vars), nil
+		}
+		return nil, err
+	}
+	c.vars, c.loaded, c.valid = cloneVars(vars), now, true
+	return vars, nil
+}
+
+// Wait implements the Watcher interface if the wrapped Source is a
+// Watcher.  Otherwise it returns after the cached variables go stale.
+func (c *CachedSource) Wait(ctx context.Context) error {
+	if w, ok := c.Source.(Watcher); ok {
+		if err := w.Wait(ctx); err != nil {
+			return err
+		}
+		c.Invalidate()
+		return nil
+	}
+
+	c.mu.Lock()
+	next := c.staleAt()
+	c.mu.Unlock()
+	if next.IsZero() {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Invalidate discards the cached variables, so the next Load calls the
+// wrapped Source.
+func (c *CachedSource) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vars, c.valid = nil, false
+}
+
+// staleAt returns the time the cached variables go stale, or the zero time
+// if they never do.  Variables that have never been loaded are stale now.
+func (c *CachedSource) staleAt() time.Time {
+	if !c.valid {
+		return time.Now()
+	}
+	var at time.Time
+	if c.TTL > 0 {
+		at = c.loaded.Add(c.TTL)
+	}
+	for _, v := range c.vars {
+		if !v.Expires.IsZero() && (at.IsZero() || v.Expires.Before(at)) {
+			at = v.Expires
+		}
+	}
+	return at
+}
+
+// expired reports whether any of vars has expired at now.
+func expired(vars []Var, now time.Time) bool {
+	for _, v := range vars {
+		if !v.Expires.IsZero() && !now.Before(v.Expires) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneVars returns a copy of vars, so callers can't modify the cache.
+func cloneVars(vars []Var) []Var {
+	return append([]Var(nil), vars...)
+}
+
+// UsesNetwork implements the NetworkUser interface, reporting whether the
+// wrapped Source uses the network.
+func (c *CachedSource) UsesNetwork() bool {
+	return usesNetwork(c.Source)
+}
+
+// Kind implements the Kinded interface, returning the kind of the wrapped
+// Source.
+func (c *CachedSource) Kind() string {
+	return sourceKind(c.Source)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/providers/agent"
+)
+
+// runAgent serves the variables on a Unix domain socket until it's
+// interrupted, caching them so clients get them quickly.
+func runAgent(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("agent")
+	socket := fs.String("socket", agent.DefaultSocket(), "`path` of the socket to listen on")
+	ttl := fs.Duration("ttl", 5*time.Minute,
+		"how long to serve cached variables before reloading them (0 means until they expire)")
+	_ = fs.Parse(args)
+	if sf.command == "" && sf.credentialProcess == "" && sf.plugin == "" && len(sf.sources) == 0 {
+		return errors.New("patchenv: the agent has no command to run (set -command or PATCH_ENV_COMMAND)")
+	}
+
+	l, err := agent.Listen(*socket)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	log.Printf("patchenv: agent listening on %s", *socket)
+	server := &agent.Server{
+		Source:  &patchenv.CachedSource{Source: &resolveSource{&sf}, TTL: *ttl},
+		Timeout: sf.timeout,
+	}
+	return server.ServeContext(ctx, l)
+}
+
+// resolveSource is a patchenv.Source that resolves the variables as
+// configured by the source flags, including the fallback and handshake.
+type resolveSource struct {
+	flags *sourceFlags
+}
+
+// Load implements the patchenv.Source interface.
+func (s *resolveSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	result, err := s.flags.resolveContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result.NoChanges {
+		return nil, patchenv.ErrNoChanges
+	}
+	return result.Vars, nil
+}
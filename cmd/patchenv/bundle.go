@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/arpio/patchenv"
+)
+
+// runBundle writes a snapshot bundle of the variables, signed with the key
+// given by the -key flag, to stdout or to the file given by the -o flag.
+func runBundle(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("bundle")
+	keyFile := fs.String("key", "", "sign the bundle with the Ed25519 or ECDSA private key in the PEM `file`")
+	encryptionKeyFile := fs.String("encryption-key", "",
+		"encrypt the bundle with the base64-encoded AES-256 key in `file`")
+	output := fs.String("o", "", "write to `file` (readable only by its owner) instead of stdout")
+	_ = fs.Parse(args)
+
+	if *keyFile == "" {
+		return errors.New("patchenv: -key is required")
+	}
+	key, err := patchenv.ReadSigningKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	var encryptionKey []byte
+	if *encryptionKeyFile != "" {
+		if encryptionKey, err = patchenv.ReadEncryptionKey(*encryptionKeyFile); err != nil {
+			return err
+		}
+	}
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return result.WriteBundle(os.Stdout, key, encryptionKey)
+	}
+	var b bytes.Buffer
+	if err := result.WriteBundle(&b, key, encryptionKey); err != nil {
+		return err
+	}
+	return writeFile(*output, &b, 0o600)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/arpio/patchenv/providers/aws"
+)
+
+// runCredentialProcess writes the AWS credentials in the variables to
+// stdout in the JSON format that the AWS SDKs expect from a
+// credential_process helper, so patchenv can be used in an AWS config file:
+//
+//	[profile dev]
+//	credential_process = patchenv credential-process -command "aws-vault exec dev -- env"
+func runCredentialProcess(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("credential-process")
+	_ = fs.Parse(args)
+
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	creds, err := aws.CredentialsFromResult(result)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(creds)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// runExplain writes a JSON array describing where each variable comes
+// from, without the variables' values.
+func runExplain(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("explain")
+	_ = fs.Parse(args)
+
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result.Explain())
+}
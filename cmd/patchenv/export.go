@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/arpio/patchenv"
+)
+
+// runExport writes the variables to stdout, or to the file given by the -o
+// flag, in the format given by the -format flag.
+func runExport(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("export")
+	formatName := fs.String("format", "dotenv",
+		"output `format`: dotenv, json, shell, powershell, cmd, docker, systemd, or systemd-dropin")
+	output := fs.String("o", "",
+		"write to `file` (readable only by its owner) instead of stdout, creating its directory if needed")
+	_ = fs.Parse(args)
+
+	format, err := patchenv.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return result.Export(os.Stdout, format)
+	}
+	var b bytes.Buffer
+	if err := result.Export(&b, format); err != nil {
+		return err
+	}
+	return writeFile(*output, &b, 0o600)
+}
+
+// writeFile writes r to the file at path with the permissions perm,
+// creating the file's directory (such as a systemd unit's ".d" drop-in
+// directory) if it doesn't exist.  perm should only let the owner read the
+// file, since it may hold secrets.  The file is written to a temporary file
+// and renamed over path, so an existing file's permissions never apply.
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(perm)
+	if err == nil {
+		_, err = io.Copy(f, r)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+module github.com/arpio/patchenv/cmd/patchenv
+
+go 1.17
+
+require (
+	github.com/arpio/patchenv v1.0.0
+	github.com/arpio/patchenv/providers/agent v1.0.0
+	github.com/arpio/patchenv/providers/aws v1.0.0
+)
+
+replace (
+	github.com/arpio/patchenv => ../..
+	github.com/arpio/patchenv/providers/agent => ../../providers/agent
+	github.com/arpio/patchenv/providers/aws => ../../providers/aws
+)
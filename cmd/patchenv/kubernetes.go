@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+
+	"github.com/arpio/patchenv"
+)
+
+// runKubernetes writes the variables as the env block of a Kubernetes
+// container spec, or with -manifest, as a Secret manifest.
+func runKubernetes(args []string) error {
+	var sf sourceFlags
+	var opts patchenv.KubernetesOptions
+	fs := sf.newFlagSet("kubernetes")
+	fs.StringVar(&opts.SecretName, "secret", "",
+		"`name` of the Secret to reference the values from (or to generate with -manifest)")
+	fs.StringVar(&opts.Namespace, "namespace", "", "`namespace` of the generated Secret")
+	fs.BoolVar(&opts.EnvFrom, "env-from", false, "reference the whole Secret with envFrom")
+	manifest := fs.Bool("manifest", false, "write a Secret manifest instead of an env block")
+	_ = fs.Parse(args)
+
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	if *manifest {
+		return result.WriteKubernetesSecret(os.Stdout, opts)
+	}
+	return result.WriteKubernetesEnv(os.Stdout, opts)
+}
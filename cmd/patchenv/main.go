@@ -0,0 +1,153 @@
+// Command patchenv computes an environment the same way the patchenv
+// library does, by running PATCH_ENV_COMMAND (or the command given with
+// -command), and writes it in a format other tools understand.
+//
+// Usage:
+//
+//	patchenv <mode> [flags]
+//
+// The modes are:
+//
+//	export              write the variables as dotenv, JSON, shell, etc.
+//	explain             describe where each variable comes from, as JSON
+//	trampoline          write a script that sets the variables and runs a command
+//	bundle              write a signed snapshot bundle of the variables
+//	credential-process  act as an AWS credential_process helper
+//	terraform           act as a Terraform external data source program
+//	kubernetes          write a Kubernetes env block or Secret manifest
+//	agent               serve cached variables on a local socket
+//	plugins             list the provider plugins that are installed
+//
+// Run "patchenv <mode> -h" for the flags each mode accepts.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/providers/agent"
+	"github.com/arpio/patchenv/providers/aws"
+)
+
+// mode is one of the ways the command can be run.
+type mode struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// modes lists the modes in the order they're shown in the usage message.
+var modes = []*mode{
+	{"export", "write the variables as dotenv, JSON, shell, etc.", runExport},
+	{"explain", "describe where each variable comes from, as JSON", runExplain},
+	{"trampoline", "write a script that sets the variables and runs a command", runTrampoline},
+	{"bundle", "write a signed snapshot bundle of the variables", runBundle},
+	{"credential-process", "act as an AWS credential_process helper", runCredentialProcess},
+	{"terraform", "act as a Terraform external data source program", runTerraform},
+	{"kubernetes", "write a Kubernetes env block or Secret manifest", runKubernetes},
+	{"agent", "serve cached variables on a local socket", runAgent},
+	{"plugins", "list the provider plugins that are installed", runPlugins},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	// Every mode's stdout is its output, which other programs read, so a
+	// failed command's output goes to stderr instead.
+	patchenv.SetFailureOutput(os.Stderr)
+	for _, m := range modes {
+		if m.name == os.Args[1] {
+			if err := m.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "patchenv: unknown mode %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+// usage writes the list of modes to stderr.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: patchenv <mode> [flags]")
+	fmt.Fprintln(os.Stderr, "\nmodes:")
+	for _, m := range modes {
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", m.name, m.summary)
+	}
+}
+
+// runPlugins lists the names of the installed provider plugins.
+func runPlugins(args []string) error {
+	fs := flag.NewFlagSet("patchenv plugins", flag.ExitOnError)
+	_ = fs.Parse(args)
+	for _, name := range patchenv.Plugins() {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// sourceFlags are the flags, common to all modes, that control where the
+// variables come from.
+type sourceFlags struct {
+	command           string
+	credentialProcess string
+	agentSocket       string
+	plugin            string
+	sources           []string
+	timeout           time.Duration
+}
+
+// newFlagSet returns a flag set for the named mode with the common flags
+// registered in f.
+func (f *sourceFlags) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("patchenv "+name, flag.ExitOnError)
+	fs.StringVar(&f.command, "command", os.Getenv("PATCH_ENV_COMMAND"),
+		"command that outputs the variables (default $PATCH_ENV_COMMAND)")
+	fs.StringVar(&f.credentialProcess, "credential-process", "",
+		"AWS credential_process `helper` to load AWS_* variables from instead of -command")
+	fs.StringVar(&f.agentSocket, "agent", "",
+		"load the variables from the agent listening on `socket` instead of -command")
+	fs.StringVar(&f.plugin, "plugin", "",
+		"load the variables from the provider plugin `name` instead of -command")
+	fs.Func("source", "load the variables from the source `URI`, like file:///etc/myapp.env (repeatable)",
+		func(uri string) error {
+			f.sources = append(f.sources, uri)
+			return nil
+		})
+	fs.DurationVar(&f.timeout, "timeout", 0, "maximum time the command may run (0 means no limit)")
+	return fs
+}
+
+// resolve computes the variables as configured by the flags.
+func (f *sourceFlags) resolve() (*patchenv.Result, error) {
+	return f.resolveContext(context.Background())
+}
+
+// resolveContext is like resolve, but loads the variables with ctx.
+func (f *sourceFlags) resolveContext(ctx context.Context) (*patchenv.Result, error) {
+	opts := []patchenv.Option{
+		patchenv.WithCommand(f.command),
+		patchenv.WithTimeout(f.timeout),
+		patchenv.WithContext(ctx),
+	}
+	if len(f.sources) > 0 {
+		opts = append(opts, patchenv.WithSourceURI(f.sources...))
+	} else if f.plugin != "" {
+		opts = append(opts, patchenv.WithSource(&patchenv.PluginSource{Name: f.plugin}))
+	} else if f.agentSocket != "" {
+		opts = append(opts, patchenv.WithSource(&agent.Source{Socket: f.agentSocket}))
+	} else if f.credentialProcess != "" {
+		opts = append(opts, patchenv.WithSource(&aws.CredentialProcessSource{
+			Command: f.credentialProcess,
+		}))
+	}
+	return patchenv.Resolve(opts...)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runTerraform implements Terraform's external data source protocol: it
+// reads a JSON object of strings (the data source's query) on stdin and
+// writes the variables to stdout as a JSON object of strings.
+//
+//	data "external" "env" {
+//	  program = ["patchenv", "terraform"]
+//	  query = {
+//	    command = "aws-vault exec dev -- env"
+//	  }
+//	}
+//
+// The query may set "command" and "timeout", overriding the flags of the
+// same names.  Unset variables are left out of the output, since Terraform
+// requires every value to be a string.
+func runTerraform(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("terraform")
+	_ = fs.Parse(args)
+
+	var query map[string]string
+	if err := json.NewDecoder(os.Stdin).Decode(&query); err != nil {
+		return fmt.Errorf("patchenv: can't read the Terraform query: %w", err)
+	}
+	for key, value := range query {
+		switch key {
+		case "command":
+			sf.command = value
+		case "timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("patchenv: invalid timeout %q in the Terraform query: %w", value, err)
+			}
+			sf.timeout = d
+		default:
+			return fmt.Errorf("patchenv: unknown key %q in the Terraform query", key)
+		}
+	}
+
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	out := make(map[string]string, len(result.Vars))
+	for _, v := range result.Vars {
+		if v.Unset {
+			delete(out, v.Name)
+		} else {
+			out[v.Name] = v.Value
+		}
+	}
+	return json.NewEncoder(os.Stdout).Encode(out)
+}
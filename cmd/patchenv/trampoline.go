@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/arpio/patchenv"
+)
+
+// runTrampoline writes a script that sets the variables and runs its
+// arguments to stdout, or to the executable file given by the -o flag.
+func runTrampoline(args []string) error {
+	var sf sourceFlags
+	fs := sf.newFlagSet("trampoline")
+	powerShell := fs.Bool("powershell", false, "write a PowerShell script instead of a POSIX shell script")
+	output := fs.String("o", "",
+		"write to `file` (executable and readable only by its owner) instead of stdout")
+	_ = fs.Parse(args)
+
+	format := patchenv.FormatShell
+	if *powerShell {
+		format = patchenv.FormatPowerShell
+	}
+	result, err := sf.resolve()
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return result.WriteTrampoline(os.Stdout, format)
+	}
+	var b bytes.Buffer
+	if err := result.WriteTrampoline(&b, format); err != nil {
+		return err
+	}
+	return writeFile(*output, &b, 0o700)
+}
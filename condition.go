@@ -0,0 +1,225 @@
+package patchenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// condition restricts an entry of a payload to the machines it applies to,
+// so one payload can serve a fleet of different ones.  In a JSON envelope
+// or a JSON Lines record, it's the entry's "when" object:
+//
+//	{"name": "JAVA_HOME", "value": "/usr/lib/jvm/java-17", "when": {"goos": "linux"}}
+//	{"name": "CACHE_DIR", "value": "/mnt/ssd", "when": {"hostname": "build-*", "env": {"CI": "true"}}}
+//
+// In the line protocol, it follows the value after " #when ":
+//
+//	JAVA_HOME=/usr/lib/jvm/java-17 #when goos=linux goarch=amd64,arm64
+//
+// Every field that's given must match.  A field that lists several values
+// matches if any of them do.
+type condition struct {
+	// GOOS and GOARCH are the operating systems and architectures the
+	// entry applies to, as in runtime.GOOS and runtime.GOARCH.
+	GOOS   stringList `json:"goos"`
+	GOARCH stringList `json:"goarch"`
+
+	// Hostname are patterns, as in path.Match, that the machine's host
+	// name must match, ignoring case.
+	Hostname stringList `json:"hostname"`
+
+	// Env maps the names of environment variables to patterns that their
+	// values must match.  The variables must be set, although "*" matches
+	// an empty value.
+	Env map[string]stringList `json:"env"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.  Unknown fields
+// are rejected, since ignoring one would apply the entry more widely than
+// intended.
+func (c *condition) UnmarshalJSON(data []byte) error {
+	type plain condition
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode((*plain)(c)); err != nil {
+		return fmt.Errorf("invalid condition: %w", err)
+	}
+	return nil
+}
+
+// stringList is a list of strings in JSON, given either as a list or as a
+// single string.
+type stringList []string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// matches reports whether the condition holds for the running process.  A
+// nil condition always holds.
+func (c *condition) matches() (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	if len(c.GOOS) > 0 && !contains(c.GOOS, runtime.GOOS) {
+		return false, nil
+	}
+	if len(c.GOARCH) > 0 && !contains(c.GOARCH, runtime.GOARCH) {
+		return false, nil
+	}
+	if len(c.Hostname) > 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return false, fmt.Errorf("patchenv: can't evaluate condition: %w", err)
+		}
+		if ok, err := matchAny(c.Hostname, strings.ToLower(hostname), true); !ok || err != nil {
+			return false, err
+		}
+	}
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return false, nil
+		}
+		if ok, err := matchAny(c.Env[name], value, false); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether s matches any of patterns, ignoring case if
+// fold is true.
+func matchAny(patterns []string, s string, fold bool) (bool, error) {
+	for _, pattern := range patterns {
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+		ok, err := path.Match(pattern, s)
+		if err != nil {
+			return false, fmt.Errorf("patchenv: invalid condition pattern %q: %w", pattern, err)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// conditionPrefix introduces a condition at the end of a line of the line
+// protocol.
+const conditionPrefix = "#when "
+
+// cutCondition splits value, from a line of the line protocol, into the
+// value itself and the condition at its end, if there is one.  The
+// condition is "#when" followed by blank-separated FIELD=VALUE terms, where
+// FIELD is "goos", "goarch", "hostname", or "env.NAME", and VALUE can list
+// alternatives separated by commas.  It must be separated from the value
+// by a blank, and follow the closing quote of a quoted value, so a quoted
+// value like "run #when ready" can contain the prefix.  If any of the terms
+// doesn't parse, the suffix isn't a condition, and value is returned as it
+// is, so values like "deploy #when ready" that happen to contain the
+// prefix are kept.
+func cutCondition(value string) (string, *condition) {
+	start := quotedEnd(value)
+	i := strings.LastIndex(value[start:], conditionPrefix)
+	if i >= 0 {
+		i += start
+	}
+	if i < 0 || (i > 0 && !strings.ContainsAny(value[i-1:i], blanks)) {
+		return value, nil
+	}
+	c, ok := parseCondition(strings.Fields(value[i+len(conditionPrefix):]))
+	if !ok {
+		return value, nil
+	}
+	return strings.TrimRight(value[:i], blanks), c
+}
+
+// parseCondition parses the terms of a line protocol condition, or returns
+// false if there are none or one of them doesn't parse.
+func parseCondition(terms []string) (*condition, bool) {
+	if len(terms) == 0 {
+		return nil, false
+	}
+	c := &condition{}
+	for _, term := range terms {
+		j := strings.Index(term, "=")
+		if j < 0 || j == len(term)-1 {
+			return nil, false
+		}
+		field, list := term[:j], stringList(strings.Split(term[j+1:], ","))
+		switch {
+		case field == "goos":
+			c.GOOS = append(c.GOOS, list...)
+		case field == "goarch":
+			c.GOARCH = append(c.GOARCH, list...)
+		case field == "hostname":
+			c.Hostname = append(c.Hostname, list...)
+		case strings.HasPrefix(field, "env.") && len(field) > len("env."):
+			if c.Env == nil {
+				c.Env = make(map[string]stringList)
+			}
+			name := field[len("env."):]
+			c.Env[name] = append(c.Env[name], list...)
+		default:
+			return nil, false
+		}
+	}
+	return c, true
+}
+
+// quotedEnd returns the index in value just past the closing quote of the
+// single- or double-quoted string it starts with, ignoring blanks before
+// it, or 0 if it doesn't start with one.  As in unquote, a backslash
+// escapes the next character in double quotes only.
+func quotedEnd(value string) int {
+	t := strings.TrimLeft(value, blanks)
+	offset := len(value) - len(t)
+	if t == "" {
+		return 0
+	}
+	switch t[0] {
+	case '\'':
+		if j := strings.IndexByte(t[1:], '\''); j >= 0 {
+			return offset + j + 2
+		}
+	case '"':
+		for j := 1; j < len(t); j++ {
+			switch t[j] {
+			case '\\':
+				j++
+			case '"':
+				return offset + j + 1
+			}
+		}
+	}
+	return 0
+}
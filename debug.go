@@ -0,0 +1,127 @@
+package patchenv
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// debugVar is the environment variable that, when set to a true value
+	// like "1", enables the debug trace.
+	debugVar = "PATCH_ENV_DEBUG"
+
+	// debugFileVar is the environment variable that, when set, names a
+	// file the debug trace is appended to instead of stderr.
+	debugFileVar = "PATCH_ENV_DEBUG_FILE"
+)
+
+// tracer writes the debug trace.  A nil *tracer discards everything, so
+// callers don't need to check whether tracing is enabled.
+type tracer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+}
+
+// printf writes a line to the trace, prefixed with the time since the
+// tracer was created.
+func (t *tracer) printf(format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elapsed := time.Since(t.start).Seconds()
+	fmt.Fprintf(t.w, "patchenv: [%+.3fs] %s\n", elapsed, fmt.Sprintf(format, args...))
+}
+
+// tracerKey is the context key for the tracer.
+type tracerKey struct{}
+
+// withTracer returns a copy of ctx that carries t.
+func withTracer(ctx context.Context, t *tracer) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// traceFrom returns the tracer carried by ctx, or nil.
+func traceFrom(ctx context.Context) *tracer {
+	t, _ := ctx.Value(tracerKey{}).(*tracer)
+	return t
+}
+
+// debugEnabled reports whether PATCH_ENV_DEBUG is set to a true value.
+func debugEnabled() bool {
+	return envEnabled(debugVar)
+}
+
+// envEnabled reports whether the environment variable name is set to a
+// value other than "", "0", "false", "no", or "off".
+func envEnabled(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "", "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// startTrace sets cfg.trace to the tracer for cfg, or nil if tracing is
+// disabled, and returns a function that closes the trace file if one was
+// opened.
+func (cfg *config) startTrace() func() {
+	w := cfg.debug
+	closeFn := func() {}
+	if w == nil && debugEnabled() {
+		w = os.Stderr
+		if path := os.Getenv(debugFileVar); path != "" {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err == nil {
+				w, closeFn = f, func() { _ = f.Close() }
+			} else {
+				fmt.Fprintf(os.Stderr, "patchenv: can't open debug file: %s\n", err)
+			}
+		}
+	}
+	if w != nil {
+		cfg.trace = &tracer{w: w, start: time.Now()}
+	}
+	return closeFn
+}
+
+// describeVars returns a description of vars for the trace, with names but
+// not values.
+func describeVars(vars []Var) string {
+	if len(vars) == 0 {
+		return "none"
+	}
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		var flags []string
+		if v.Unset {
+			flags = append(flags, "unset")
+		} else {
+			flags = append(flags, fmt.Sprintf("%d bytes", len(v.Value)))
+		}
+		if v.Secret {
+			flags = append(flags, "secret")
+		}
+		if v.File {
+			flags = append(flags, "file")
+		}
+		if !v.Expires.IsZero() {
+			flags = append(flags, "expires "+v.Expires.Format(time.RFC3339))
+		}
+		if !v.NotBefore.IsZero() {
+			flags = append(flags, "not before "+v.NotBefore.Format(time.RFC3339))
+		}
+		names[i] = v.Name + " (" + strings.Join(flags, ", ") + ")"
+	}
+	return strings.Join(names, ", ")
+}
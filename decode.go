@@ -0,0 +1,241 @@
+package patchenv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// envTag names the struct tag that maps a field to an environment
+	// variable, optionally followed by ",required".
+	envTag = "env"
+
+	// defaultTag names the struct tag that holds a field's default value.
+	defaultTag = "envDefault"
+
+	// separatorTag names the struct tag that holds the separator between
+	// elements of a slice field.
+	separatorTag = "envSeparator"
+
+	// defaultSeparator separates elements of a slice field when the field
+	// doesn't have an envSeparator tag.
+	defaultSeparator = ","
+)
+
+// durationType is the reflect.Type of time.Duration, which is decoded with
+// time.ParseDuration() rather than as an integer.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// textUnmarshalerType is the reflect.Type of encoding.TextUnmarshaler.
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Decode patches the environment using PatchWith() with opts, then sets the
+// fields of the struct pointed to by v from environment variables.  Each
+// field with an "env" tag is set from the variable the tag names:
+//
+//	type Config struct {
+//		DatabaseURL string        `env:"DATABASE_URL,required"`
+//		Port        int           `env:"PORT" envDefault:"8080"`
+//		Debug       bool          `env:"DEBUG"`
+//		Timeout     time.Duration `env:"TIMEOUT" envDefault:"30s"`
+//		Hosts       []string      `env:"HOSTS" envSeparator:";"`
+//	}
+//
+// Strings, bools, integers, floats, time.Duration, types that implement
+// encoding.TextUnmarshaler, and slices of those are supported.  Slice
+// elements are separated by commas unless the field has an "envSeparator"
+// tag.  Fields of nested structs without an "env" tag are decoded
+// recursively.
+//
+// A variable that is unset or empty leaves its field unchanged, unless the
+// field has an "envDefault" tag, in which case the default is decoded
+// instead.  If any variables of fields tagged "required" are unset or empty,
+// Decode returns an error listing all of them.
+func Decode(v interface{}, opts ...Option) error {
+	if _, err := PatchWith(opts...); err != nil {
+		return err
+	}
+	return decodeEnv(v, os.LookupEnv)
+}
+
+// decodeEnv sets the fields of the struct pointed to by v using lookup to
+// get variable values.
+func decodeEnv(v interface{}, lookup func(string) (string, bool)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("patchenv: Decode requires a non-nil pointer to a struct, not %T", v)
+	}
+
+	var missing []string
+	if err := decodeStruct(rv.Elem(), lookup, &missing); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &MissingError{Names: missing}
+	}
+	return nil
+}
+
+// decodeStruct sets the fields of the struct sv, appending the names of
+// unset required variables to missing.
+func decodeStruct(sv reflect.Value, lookup func(string) (string, bool), missing *[]string) error {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		field := st.Field(i)
+		fv := sv.Field(i)
+		if field.PkgPath != "" {
+			// Unexported fields can't be set.
+			continue
+		}
+
+		tag, ok := field.Tag.Lookup(envTag)
+		if !ok {
+			if fv.Kind() == reflect.Struct && !reflect.PtrTo(fv.Type()).Implements(textUnmarshalerType) {
+				if err := decodeStruct(fv, lookup, missing); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		required := false
+		for _, flag := range parts[1:] {
+			switch flag {
+			case "required":
+				required = true
+			default:
+				return fmt.Errorf("patchenv: field %s.%s has unknown %s tag option %q",
+					st.Name(), field.Name, envTag, flag)
+			}
+		}
+
+		value, _ := lookup(name)
+		if value == "" {
+			if def, ok := field.Tag.Lookup(defaultTag); ok {
+				value = def
+			} else if required {
+				*missing = append(*missing, name)
+				continue
+			} else {
+				continue
+			}
+		}
+
+		sep, ok := field.Tag.Lookup(separatorTag)
+		if !ok {
+			sep = defaultSeparator
+		}
+		if err := decodeValue(fv, value, sep); err != nil {
+			return fmt.Errorf("patchenv: can't decode %s into field %s.%s: %s",
+				name, st.Name(), field.Name, err)
+		}
+	}
+	return nil
+}
+
+// decodeValue parses s and stores the result in fv.  Slices are split on
+// sep and each element is decoded separately.  The errors it returns don't
+// include s, which may be secret.
+func decodeValue(fv reflect.Value, s string, sep string) error {
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return hideValue(fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)), s)
+	}
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return hideValue(err, s)
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return hideValue(err, s)
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, fv.Type().Bits())
+		if err != nil {
+			return hideValue(err, s)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, fv.Type().Bits())
+		if err != nil {
+			return hideValue(err, s)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return hideValue(err, s)
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		elems := strings.Split(s, sep)
+		slice := reflect.MakeSlice(fv.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := decodeValue(slice.Index(i), strings.TrimSpace(elem), sep); err != nil {
+				return fmt.Errorf("element %d: %w", i+1, err)
+			}
+		}
+		fv.Set(slice)
+	default:
+		return errors.New("unsupported field type " + fv.Type().String())
+	}
+	return nil
+}
+
+// valueError is an error from parsing a value whose message leaves out the
+// value, so a secret that isn't in the expected format doesn't end up in
+// logs.
+type valueError struct {
+	err   error
+	value string
+}
+
+// hideValue returns err, returned by parsing value, as a valueError, or nil
+// if err is nil.
+func hideValue(err error, value string) error {
+	if err == nil {
+		return nil
+	}
+	return &valueError{err: err, value: value}
+}
+
+// Error implements the error interface.
+func (e *valueError) Error() string {
+	var numErr *strconv.NumError
+	if errors.As(e.err, &numErr) {
+		return "strconv." + numErr.Func + ": " + numErr.Err.Error()
+	}
+	msg := e.err.Error()
+	if e.value == "" {
+		return msg
+	}
+	if quoted := strconv.Quote(e.value); strings.Contains(msg, quoted) {
+		return strings.ReplaceAll(msg, quoted, redacted)
+	}
+	return strings.ReplaceAll(msg, e.value, redacted)
+}
+
+// Unwrap returns the error returned by the parser.
+func (e *valueError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,92 @@
+package patchenv
+
+import (
+	"log"
+	"strings"
+)
+
+// disableVar is the environment variable that, when set to "1", disables
+// patching, so operators can bypass it without changing the program's
+// configuration.
+const disableVar = "PATCH_ENV_DISABLE"
+
+// disableSourcesVar is the environment variable that lists the kinds of
+// source, separated by commas, that aren't loaded.
+const disableSourcesVar = "PATCH_ENV_DISABLE_SOURCES"
+
+// parseDisabledSources returns the set of source kinds listed in value.
+// "url" stands for both "http" and "https".
+func parseDisabledSources(value string) map[string]bool {
+	var disabled map[string]bool
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if kind == "" {
+			continue
+		}
+		if disabled == nil {
+			disabled = make(map[string]bool)
+		}
+		if kind == "url" {
+			disabled["http"], disabled["https"] = true, true
+		} else {
+			disabled[kind] = true
+		}
+	}
+	return disabled
+}
+
+// Kinded is implemented by Sources that have a kind, usually the URI
+// scheme they're opened with, so PATCH_ENV_DISABLE_SOURCES can disable them
+// when they're given with WithSource too.  The providers' Sources report
+// their package name, like "redis" or "doppler".  Sources that wrap other
+// Sources, like CachedSource, implement it by asking the Source they wrap.
+type Kinded interface {
+	// Kind returns the source's kind, or "" if it doesn't have one.
+	Kind() string
+}
+
+// sourceKind returns the kind of src: the one it reports as a Kinded, or
+// the URI scheme it would be opened with for the built-in kinds of source,
+// or "" for other kinds.
+func sourceKind(src Source) string {
+	if k, ok := src.(Kinded); ok {
+		return strings.ToLower(k.Kind())
+	}
+	switch s := src.(type) {
+	case *CommandSource:
+		return "cmd"
+	case *FileSource:
+		return "file"
+	case *URLSource:
+		if i := strings.Index(s.URL, ":"); i > 0 {
+			return strings.ToLower(s.URL[:i])
+		}
+	case *PluginSource:
+		return "plugin"
+	case *BundleSource:
+		return "bundle"
+	}
+	return ""
+}
+
+// enabled returns src, or nil (after logging a warning) if its kind is
+// listed in PATCH_ENV_DISABLE_SOURCES.
+func (cfg *config) enabled(src Source) Source {
+	if kind := sourceKind(src); kind != "" && cfg.disabledSources[kind] {
+		log.Printf("[WARNING] patchenv: skipping %s source disabled by %s", kind, disableSourcesVar)
+		return nil
+	}
+	return src
+}
+
+// openEnabledSource is OpenSource, but returns nil (after logging a
+// warning) if the scheme of uri is listed in PATCH_ENV_DISABLE_SOURCES.
+func (cfg *config) openEnabledSource(uri string) (Source, error) {
+	if i := strings.Index(uri, ":"); i > 0 {
+		if scheme := strings.ToLower(uri[:i]); cfg.disabledSources[scheme] {
+			log.Printf("[WARNING] patchenv: skipping %s source disabled by %s", scheme, disableSourcesVar)
+			return nil, nil
+		}
+	}
+	return OpenSource(uri)
+}
@@ -0,0 +1,123 @@
+package patchenv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Names of encodings that Parser.Encoding accepts.  The code pages it also
+// accepts are listed in codePages.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16   = "utf-16"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "iso-8859-1"
+)
+
+// codePages maps the names of single-byte encodings to the tables of their
+// upper halves.
+var codePages = map[string]*[128]rune{
+	"cp437":        &codePage437,
+	"ibm437":       &codePage437,
+	"cp850":        &codePage850,
+	"ibm850":       &codePage850,
+	"cp852":        &codePage852,
+	"ibm852":       &codePage852,
+	"cp866":        &codePage866,
+	"ibm866":       &codePage866,
+	"cp1250":       &windows1250,
+	"windows-1250": &windows1250,
+	"cp1251":       &windows1251,
+	"windows-1251": &windows1251,
+	"cp1252":       &windows1252,
+	"windows-1252": &windows1252,
+}
+
+// transcode returns a reader that converts the contents of r from the named
+// encoding to UTF-8.  Names are case-insensitive.
+func transcode(r io.Reader, encoding string) (io.Reader, error) {
+	name := strings.ToLower(encoding)
+	switch name {
+	case "", EncodingUTF8, "utf8":
+		return r, nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	switch name {
+	case EncodingUTF16, EncodingUTF16LE, "utf-16-le", "ucs-2":
+		out = decodeUTF16(data, name == EncodingUTF16 || name == "ucs-2", false)
+	case EncodingUTF16BE, "utf-16-be":
+		out = decodeUTF16(data, false, true)
+	case EncodingLatin1, "latin1", "iso8859-1":
+		out = decodeSingleByte(data, nil)
+	default:
+		table, ok := codePages[name]
+		if !ok {
+			return nil, fmt.Errorf("patchenv: unsupported encoding %q", encoding)
+		}
+		out = decodeSingleByte(data, table)
+	}
+	return bytes.NewReader(out), nil
+}
+
+// decodeUTF16 converts UTF-16 data to UTF-8.  If detect is true, a byte
+// order mark selects the byte order (and is removed); otherwise, or if
+// there's no byte order mark, the data is little-endian unless bigEndian is
+// true.
+func decodeUTF16(data []byte, detect, bigEndian bool) []byte {
+	if detect && len(data) >= 2 {
+		switch {
+		case data[0] == 0xFF && data[1] == 0xFE:
+			data = data[2:]
+		case data[0] == 0xFE && data[1] == 0xFF:
+			data, bigEndian = data[2:], true
+		}
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, r := range utf16.Decode(units) {
+		buf.WriteRune(r)
+	}
+	if len(data)%2 != 0 {
+		buf.WriteRune(utf8.RuneError)
+	}
+	return buf.Bytes()
+}
+
+// decodeSingleByte converts data in a single-byte encoding to UTF-8 using
+// table to map bytes 0x80-0xFF.  A nil table means ISO-8859-1, where each
+// byte is the Unicode code point with the same value.
+func decodeSingleByte(data []byte, table *[128]rune) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	for _, b := range data {
+		switch {
+		case b < 0x80:
+			buf.WriteByte(b)
+		case table == nil:
+			buf.WriteRune(rune(b))
+		default:
+			buf.WriteRune(table[b-0x80])
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,292 @@
+package patchenv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envelope is the JSON payload of protocol version 2:
+//
+//	{
+//	  "version": 2,
+//	  "vars": [
+//	    {"name": "AWS_ACCESS_KEY_ID", "value": "AKIA..."},
+//	    {"name": "AWS_SESSION_TOKEN", "value": "...", "secret": true, "ttl": "1h"},
+//	    {"name": "JAVA_HOME", "value": "/usr/lib/jvm/java-17", "when": {"goos": "linux"}}
+//	  ],
+//	  "unset": ["AWS_PROFILE"],
+//	  "files": [
+//	    {"name": "KUBECONFIG", "content": "apiVersion: v1\n...", "mode": "0600"}
+//	  ]
+//	}
+//
+// Entries of "vars" and "files" with a "when" condition that doesn't hold
+// for the running process are skipped.  "vars" may also be an object
+// mapping names to values when no metadata is needed.  Its values can be
+// nested objects and arrays, which are flattened by the Parser's rules, but
+// its names are used as written.  An envelope with "noChanges": true means
+// there's nothing to change, and its other fields are ignored.
+type envelope struct {
+	Version   int             `json:"version"`
+	Vars      json.RawMessage `json:"vars"`
+	Unset     []string        `json:"unset"`
+	Files     []envelopeFile  `json:"files"`
+	NoChanges bool            `json:"noChanges"`
+}
+
+// envelopeVar is an entry in an envelope's "vars" list.
+type envelopeVar struct {
+	Name    string       `json:"name"`
+	Value   string       `json:"value"`
+	Secret  bool         `json:"secret"`
+	TTL     jsonDuration `json:"ttl"`
+	Expires time.Time    `json:"expires"`
+	When    *condition   `json:"when"`
+
+	// NotBefore and NotAfter bound the time the value is valid, for
+	// credentials that are rotated on a schedule.
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+}
+
+// expires returns the time the entry's value expires, from its expiration
+// time, TTL, and NotAfter, whichever is earliest.
+func (e *envelopeVar) expires(now time.Time) time.Time {
+	expires := expiry(e.Expires, e.TTL, now)
+	if !e.NotAfter.IsZero() && (expires.IsZero() || e.NotAfter.Before(expires)) {
+		return e.NotAfter
+	}
+	return expires
+}
+
+// envelopeFile is an entry in an envelope's "files" list.  Its content is
+// written to a temporary file, and the variable is set to the file's path.
+type envelopeFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+
+	// Base64 means Content is base64-encoded, for binary files.
+	Base64 bool `json:"base64"`
+
+	// Mode is the file's permissions in octal; the default is "0600".
+	Mode   string       `json:"mode"`
+	Secret bool         `json:"secret"`
+	TTL    jsonDuration `json:"ttl"`
+	When   *condition   `json:"when"`
+}
+
+// jsonDuration is a duration in JSON, given either as a number of seconds
+// or as a string accepted by time.ParseDuration().
+type jsonDuration time.Duration
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		*d = jsonDuration(parsed)
+		return err
+	}
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("duration must be a string or a number of seconds, not %s", data)
+	}
+	*d = jsonDuration(seconds * float64(time.Second))
+	return nil
+}
+
+// isEnvelope reports whether data, with leading whitespace removed, looks
+// like a JSON envelope rather than "var=value" lines.
+func isEnvelope(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// parseEnvelope decodes a JSON envelope from r and returns the variables it
+// defines, writing file contents to temporary files in the Parser's FileDir
+// (or the default temporary directory if it's empty).  It returns
+// ErrNoChanges if the envelope says there's nothing to change.  The files
+// it wrote are removed if it returns an error.
+func (p *Parser) parseEnvelope(r io.Reader) ([]Var, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid JSON payload: %w", err)
+	}
+	if err := p.PayloadSchema.checkJSON(raw); err != nil {
+		return nil, err
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid JSON payload: %w", err)
+	}
+	if env.Version < 2 || env.Version > protocolVersion {
+		return nil, fmt.Errorf("patchenv: unsupported payload protocol version %d", env.Version)
+	}
+	if env.NoChanges {
+		return nil, ErrNoChanges
+	}
+
+	now := time.Now()
+	vars, err := p.envelopeVars(env.Vars, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range env.Unset {
+		vars = append(vars, Var{Name: name, Unset: true})
+	}
+	for _, f := range env.Files {
+		if ok, err := f.When.matches(); err != nil {
+			removeFiles(vars)
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		v, err := materialize(f, p.FileDir, now)
+		if err != nil {
+			removeFiles(vars)
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+
+	for _, v := range vars {
+		if v.Name == "" {
+			removeFiles(vars)
+			return nil, fmt.Errorf("patchenv: JSON payload has a variable with no name")
+		}
+	}
+	return vars, nil
+}
+
+// envelopeVars decodes an envelope's "vars", which is either a list of
+// entries or an object mapping names to values.  The variables in an object
+// are returned sorted by name, since JSON objects are unordered.
+func (p *Parser) envelopeVars(raw json.RawMessage, now time.Time) ([]Var, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	if raw[0] == '{' {
+		var m map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("patchenv: invalid JSON payload vars: %w", err)
+		}
+		flat := *p
+		flat.KeepNames = true
+		return flat.flatten(nil, "", m, 1)
+	}
+
+	var entries []envelopeVar
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid JSON payload vars: %w", err)
+	}
+	vars := make([]Var, 0, len(entries))
+	for _, e := range entries {
+		if ok, err := e.When.matches(); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+		vars = append(vars, Var{
+			Name:      e.Name,
+			Value:     e.Value,
+			Secret:    e.Secret,
+			Expires:   e.expires(now),
+			NotBefore: e.NotBefore,
+		})
+	}
+	return vars, nil
+}
+
+// expiry returns the expiration time of an entry with the given explicit
+// expiration time and TTL.  The earlier of the two wins if both are set.
+func expiry(expires time.Time, ttl jsonDuration, now time.Time) time.Time {
+	if ttl > 0 {
+		fromTTL := now.Add(time.Duration(ttl))
+		if expires.IsZero() || fromTTL.Before(expires) {
+			return fromTTL
+		}
+	}
+	return expires
+}
+
+// materialize writes the content of f to a new temporary file in dir and
+// returns a variable set to the file's path.
+func materialize(f envelopeFile, dir string, now time.Time) (Var, error) {
+	content := []byte(f.Content)
+	if f.Base64 {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(f.Content); err != nil {
+			return Var{}, fmt.Errorf("patchenv: invalid base64 content for file %s: %w", f.Name, err)
+		}
+	}
+
+	mode := os.FileMode(0600)
+	if f.Mode != "" {
+		m, err := strconv.ParseUint(f.Mode, 8, 32)
+		if err != nil {
+			return Var{}, fmt.Errorf("patchenv: invalid mode %q for file %s", f.Mode, f.Name)
+		}
+		mode = os.FileMode(m)
+	}
+
+	file, err := os.CreateTemp(dir, "patchenv-"+f.Name+"-*")
+	if err != nil {
+		return Var{}, fmt.Errorf("patchenv: can't create file for %s: %w", f.Name, err)
+	}
+	path := file.Name()
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(path, mode)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return Var{}, fmt.Errorf("patchenv: can't write file for %s: %w", f.Name, err)
+	}
+
+	return Var{
+		Name:    f.Name,
+		Value:   path,
+		Secret:  f.Secret,
+		Expires: expiry(time.Time{}, f.TTL, now),
+		File:    true,
+	}, nil
+}
+
+// removeFiles removes the files written for the File variables in vars,
+// overwriting them with zeros first.  It's used to clean up the files of
+// variables that won't be set because loading or resolving them failed.
+func removeFiles(vars []Var) {
+	dropFiles(vars, nil)
+}
+
+// dropFiles removes the files written for the File variables in loaded
+// that aren't used by a variable in kept, like ones overridden by another
+// source or removed by a transform.
+func dropFiles(loaded, kept []Var) {
+	used := make(map[string]bool)
+	for _, v := range kept {
+		if v.File {
+			used[v.Value] = true
+		}
+	}
+	for _, v := range loaded {
+		if v.File && !used[v.Value] {
+			if err := shred(v.Value); err != nil {
+				log.Printf("[WARNING] patchenv: can't remove the file for %s: %s", v.Name, err)
+			}
+		}
+	}
+}
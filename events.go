@@ -0,0 +1,124 @@
+package patchenv
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies what happened in an Event.
+type EventKind string
+
+const (
+	// EventResolveStarted means PatchWith or Resolve started computing
+	// the environment.
+	EventResolveStarted EventKind = "resolve-started"
+
+	// EventResolveFinished means PatchWith or Resolve finished computing
+	// the environment.  Result and Err are its outcome.
+	EventResolveFinished EventKind = "resolve-finished"
+
+	// EventApplied means PatchWith updated the environment with the
+	// variables in Result.
+	EventApplied EventKind = "applied"
+
+	// EventRefreshFailed means a Refresher's refresh failed with Err.
+	EventRefreshFailed EventKind = "refresh-failed"
+
+	// EventRollback means History.RollbackTo restored the environment as
+	// it was after Generation.
+	EventRollback EventKind = "rollback"
+)
+
+// Event describes something that happened to the environment, for
+// programs that integrate patchenv with their own logging, metrics, or
+// reactions to configuration changes.  Receive them with Listen or Notify.
+type Event struct {
+	Kind EventKind
+
+	// Time is when it happened.
+	Time time.Time
+
+	// Result is the Result of EventResolveFinished or EventApplied, or
+	// nil.  It must not be modified.
+	Result *Result
+
+	// Err is the error of EventResolveFinished or EventRefreshFailed, or
+	// nil.
+	Err error
+
+	// Generation is the generation rolled back to by EventRollback.
+	Generation int
+}
+
+// listener is a function registered with Listen.
+type listener struct {
+	id int
+	fn func(Event)
+}
+
+var (
+	// listenersMu guards listeners and nextListener.
+	listenersMu sync.RWMutex
+
+	// listeners are the functions registered with Listen and Notify, in
+	// the order they were registered.
+	listeners    []listener
+	nextListener int
+)
+
+// Listen calls fn with every Event until the returned function is
+// called.  Listeners are called synchronously, in the goroutine where the
+// event happened, so they should return quickly; Notify delivers events
+// without blocking.  A panic in a listener is logged as a warning.
+func Listen(fn func(Event)) (stop func()) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	id := nextListener
+	nextListener++
+	listeners = append(listeners, listener{id: id, fn: fn})
+	return func() {
+		listenersMu.Lock()
+		defer listenersMu.Unlock()
+		for i, l := range listeners {
+			if l.id == id {
+				listeners = append(listeners[:i:i], listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Notify sends every Event to ch until the returned function is called.
+// Like signal.Notify, it doesn't block sending to ch, so events are dropped
+// if ch isn't ready; give it a buffer big enough for the expected rate of
+// events.
+func Notify(ch chan<- Event) (stop func()) {
+	return Listen(func(e Event) {
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+}
+
+// emit sends an event of kind to the listeners, with the details set by
+// fill, if it's not nil.
+func emit(kind EventKind, fill func(*Event)) {
+	listenersMu.RLock()
+	targets := listeners
+	listenersMu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	e := Event{Kind: kind, Time: time.Now()}
+	if fill != nil {
+		fill(&e)
+	}
+	for _, l := range targets {
+		func() {
+			defer recoverCallback("event listener")
+			l.fn(e)
+		}()
+	}
+}
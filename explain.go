@@ -0,0 +1,166 @@
+package patchenv
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// sourceSchemaDefault is the Explanation Source of a variable set to its
+// Schema default.
+const sourceSchemaDefault = "schema default"
+
+// Explanation describes where a variable of a Result came from and what
+// happened to it on the way, like the provenance in a plan: which source
+// defined it, which transforms rewrote it, and which definitions it
+// overrode.  It doesn't hold the variable's value, so it's safe to log or
+// write out as JSON.
+type Explanation struct {
+	Name string `json:"name"`
+
+	// Source describes the source of the definition that took effect, as
+	// in Conflict.Winner, or "schema default".
+	Source string `json:"source"`
+
+	// Fallback is true if the source is the fallback, because the primary
+	// source failed.
+	Fallback bool `json:"fallback,omitempty"`
+
+	// Unset and Secret are the flags of the variable's definition.
+	Unset  bool `json:"unset,omitempty"`
+	Secret bool `json:"secret,omitempty"`
+
+	// Transforms name the functions given to WithTransform that rewrote
+	// the value, in the order they ran.
+	Transforms []string `json:"transforms,omitempty"`
+
+	// Overrides describe the sources of the definitions this one took
+	// precedence over, and Rule says why, as in Conflict.
+	Overrides []string  `json:"overrides,omitempty"`
+	Rule      MergeRule `json:"rule,omitempty"`
+
+	// Excluded says why the variable was left out of Result.Vars, like
+	// "not valid until 2024-05-01T00:00:00Z", or is empty if it wasn't.
+	Excluded string `json:"excluded,omitempty"`
+}
+
+// provenance records where a Result's variables came from, for Explain.
+type provenance struct {
+	// sources maps the names of the variables to descriptions of the
+	// sources of the definitions that took effect.
+	sources map[string]string
+
+	// transforms maps the names of the variables to the names of the
+	// transforms that rewrote them.
+	transforms map[string][]string
+
+	// expired are the variables left out because they had expired.
+	expired []Var
+}
+
+// Explain resolves the environment like Resolve, and explains each of the
+// resulting variables, as Result.Explain does.  The files written for File
+// variables are removed, since they aren't needed to explain them.
+func Explain(opts ...Option) ([]Explanation, error) {
+	cfg := newConfig(opts)
+	defer cfg.startTrace()()
+	result, err := cfg.resolve()
+	if err != nil {
+		return nil, err
+	}
+	removeFiles(result.Vars)
+	return result.Explain(), nil
+}
+
+// Explain returns an Explanation for each variable of the result: the ones
+// in Vars, in order, followed by the ones that were left out because they
+// aren't valid yet or have expired.  A variable that's defined more than
+// once has one Explanation, for the definition that took effect.
+func (r *Result) Explain() []Explanation {
+	prov := r.provenance
+	if prov == nil {
+		prov = &provenance{}
+	}
+	conflicts := make(map[string]Conflict, len(r.Conflicts))
+	for _, c := range r.Conflicts {
+		conflicts[c.Name] = c
+	}
+
+	var explanations []Explanation
+	index := make(map[string]int)
+	add := func(v Var, excluded string) {
+		e := Explanation{
+			Name:       v.Name,
+			Source:     prov.sources[v.Name],
+			Unset:      v.Unset,
+			Secret:     v.Secret,
+			Transforms: prov.transforms[v.Name],
+			Excluded:   excluded,
+		}
+		if e.Source != sourceSchemaDefault {
+			e.Fallback = r.Degraded
+		}
+		if c, ok := conflicts[v.Name]; ok {
+			e.Overrides, e.Rule = c.Losers, c.Rule
+		}
+		if i, ok := index[v.Name]; ok {
+			if excluded == "" {
+				explanations[i] = e
+			}
+			return
+		}
+		index[v.Name] = len(explanations)
+		explanations = append(explanations, e)
+	}
+	for _, v := range r.Vars {
+		add(v, "")
+	}
+	for _, v := range r.Scheduled {
+		add(v, "not valid until "+v.NotBefore.Format(time.RFC3339))
+	}
+	for _, v := range prov.expired {
+		add(v, "expired at "+v.Expires.Format(time.RFC3339))
+	}
+	return explanations
+}
+
+// recordSources remembers the source of each variable's winning
+// definition in layers, which have had the DuplicatePolicy applied.
+func (cfg *config) recordSources(layers []layer) {
+	cfg.provenance.sources = make(map[string]string)
+	for _, l := range layers {
+		for _, v := range l.vars {
+			cfg.provenance.sources[v.Name] = l.name
+		}
+	}
+}
+
+// recordDefaults remembers that vars were set to their Schema defaults.
+func (cfg *config) recordDefaults(vars []Var) {
+	if len(vars) > 0 && cfg.provenance.sources == nil {
+		cfg.provenance.sources = make(map[string]string)
+	}
+	for _, v := range vars {
+		cfg.provenance.sources[v.Name] = sourceSchemaDefault
+	}
+}
+
+// recordTransform remembers that t rewrote the variable name.
+func (cfg *config) recordTransform(name string, t Transform) {
+	if cfg.provenance.transforms == nil {
+		cfg.provenance.transforms = make(map[string][]string)
+	}
+	cfg.provenance.transforms[name] = append(cfg.provenance.transforms[name], funcName(t))
+}
+
+// funcName returns the name of the function f, without its package's
+// import path, like "patchenv.WindowsToWSLPath" or "main.main.func1".
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
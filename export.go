@@ -0,0 +1,274 @@
+package patchenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Format is a format that Result.Export can write variables in.
+type Format int
+
+const (
+	// FormatDotenv writes KEY="value" lines for .env files, with
+	// backslash escapes inside the double quotes.
+	FormatDotenv Format = iota
+
+	// FormatJSON writes a JSON object mapping names to values.  Unset
+	// variables map to null.
+	FormatJSON
+
+	// FormatShell writes POSIX shell "export KEY='value'" and "unset KEY"
+	// commands.
+	FormatShell
+
+	// FormatPowerShell writes PowerShell "$env:KEY = 'value'" and
+	// "Remove-Item Env:KEY" commands.
+	FormatPowerShell
+
+	// FormatCmd writes Windows cmd.exe `set "KEY=value"` commands for
+	// batch files.
+	FormatCmd
+
+	// FormatDockerEnvFile writes KEY=value lines for docker run's
+	// --env-file option, which doesn't support quoting.
+	FormatDockerEnvFile
+
+	// FormatSystemd writes KEY="value" lines for a systemd unit's
+	// EnvironmentFile= setting.
+	FormatSystemd
+
+	// FormatSystemdDropIn writes a systemd unit drop-in file with a
+	// [Service] section of Environment= and UnsetEnvironment= settings.
+	FormatSystemdDropIn
+)
+
+// formatNames maps Format values to the names ParseFormat accepts.
+var formatNames = map[Format]string{
+	FormatDotenv:        "dotenv",
+	FormatJSON:          "json",
+	FormatShell:         "shell",
+	FormatPowerShell:    "powershell",
+	FormatCmd:           "cmd",
+	FormatDockerEnvFile: "docker",
+	FormatSystemd:       "systemd",
+	FormatSystemdDropIn: "systemd-dropin",
+}
+
+// String returns the name of the format.
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the Format with the given name: "dotenv", "json",
+// "shell", "powershell", "cmd", "docker", "systemd", or "systemd-dropin".
+func ParseFormat(name string) (Format, error) {
+	for f, n := range formatNames {
+		if strings.EqualFold(name, n) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("patchenv: unknown export format %q", name)
+}
+
+// Export writes the result's variables to w in the given format, so the
+// computed environment can be handed to other tools and shells.  If a
+// variable appears more than once, only its last value is written.  Formats
+// that can't express unsetting a variable leave unset variables out, and
+// formats that can't represent a value (like a value with a newline in a
+// Docker env file) return an error.
+func (r *Result) Export(w io.Writer, format Format) error {
+	vars := r.finalVars()
+	var b strings.Builder
+	switch format {
+	case FormatDotenv:
+		for _, v := range vars {
+			if !v.Unset {
+				fmt.Fprintf(&b, "%s=%s\n", v.Name, dotenvQuote(v.Value))
+			}
+		}
+	case FormatJSON:
+		if err := exportJSON(&b, vars); err != nil {
+			return err
+		}
+	case FormatShell:
+		for _, v := range vars {
+			if !identifier.MatchString(v.Name) {
+				return fmt.Errorf("patchenv: can't export %s for shell: not a valid shell variable name", v.Name)
+			}
+			if v.Unset {
+				fmt.Fprintf(&b, "unset %s\n", v.Name)
+			} else {
+				fmt.Fprintf(&b, "export %s=%s\n", v.Name, shellQuote(v.Value))
+			}
+		}
+	case FormatPowerShell:
+		for _, v := range vars {
+			if v.Unset {
+				fmt.Fprintf(&b, "Remove-Item -ErrorAction SilentlyContinue %s\n",
+					powerShellQuote("Env:"+v.Name))
+			} else {
+				fmt.Fprintf(&b, "%s = %s\n", powerShellVar(v.Name), powerShellQuote(v.Value))
+			}
+		}
+	case FormatCmd:
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return fmt.Errorf("patchenv: can't export %s for cmd: value contains a newline", v.Name)
+			}
+			value := v.Value
+			if v.Unset {
+				value = ""
+			}
+			fmt.Fprintf(&b, "set \"%s=%s\"\n", v.Name, strings.ReplaceAll(value, "%", "%%"))
+		}
+	case FormatDockerEnvFile:
+		for _, v := range vars {
+			if v.Unset {
+				continue
+			}
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return fmt.Errorf("patchenv: can't export %s for docker: value contains a newline", v.Name)
+			}
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, v.Value)
+		}
+	case FormatSystemd:
+		for _, v := range vars {
+			if !v.Unset {
+				fmt.Fprintf(&b, "%s=%s\n", v.Name, systemdQuote(v.Value))
+			}
+		}
+	case FormatSystemdDropIn:
+		b.WriteString("[Service]\n")
+		for _, v := range vars {
+			if v.Unset {
+				fmt.Fprintf(&b, "UnsetEnvironment=%s\n", systemdUnitQuote(v.Name))
+			} else {
+				fmt.Fprintf(&b, "Environment=%s\n", systemdUnitQuote(v.Name+"="+v.Value))
+			}
+		}
+	default:
+		return fmt.Errorf("patchenv: unknown export format %s", format)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// finalVars returns the result's variables with only the last occurrence of
+// each name kept, in the order of those last occurrences.
+func (r *Result) finalVars() []Var {
+	last := make(map[string]int, len(r.Vars))
+	for i, v := range r.Vars {
+		last[v.Name] = i
+	}
+	vars := make([]Var, 0, len(last))
+	for i, v := range r.Vars {
+		if last[v.Name] == i {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// exportJSON writes vars to b as a JSON object, preserving their order.
+func exportJSON(b *strings.Builder, vars []Var) error {
+	b.WriteString("{")
+	for i, v := range vars {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		name, err := json.Marshal(v.Name)
+		if err != nil {
+			return err
+		}
+		value := []byte("null")
+		if !v.Unset {
+			if value, err = json.Marshal(v.Value); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(b, "\n  %s: %s", name, value)
+	}
+	if len(vars) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+// dotenvQuote returns s in double quotes, with backslashes, double quotes,
+// dollar signs, and newlines escaped.
+func dotenvQuote(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		`$`, `\$`,
+		"\n", `\n`,
+		"\r", `\r`,
+	).Replace(s) + `"`
+}
+
+// shellQuote returns s in POSIX shell single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// powerShellQuoter doubles the characters PowerShell treats as single
+// quotes: the ASCII one and the typographic ones U+2018 through U+201B.
+var powerShellQuoter = strings.NewReplacer(
+	"'", "''",
+	"\u2018", "\u2018\u2018",
+	"\u2019", "\u2019\u2019",
+	"\u201a", "\u201a\u201a",
+	"\u201b", "\u201b\u201b",
+)
+
+// powerShellQuote returns s in PowerShell single quotes, which don't
+// expand anything.
+func powerShellQuote(s string) string {
+	return "'" + powerShellQuoter.Replace(s) + "'"
+}
+
+// systemdQuote returns s in double quotes for a systemd EnvironmentFile,
+// with the characters systemd treats as escapable escaped.  Newlines are
+// kept as they are, since systemd allows them inside quotes.
+func systemdQuote(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"`", "\\`",
+		`$`, `\$`,
+	).Replace(s) + `"`
+}
+
+// systemdUnitQuote returns s in double quotes for a setting in a systemd
+// unit file, which uses C-style escapes and expands "%" specifiers.
+func systemdUnitQuote(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+		`%`, `%%`,
+	).Replace(s) + `"`
+}
+
+// identifier matches variable names that are valid in POSIX shells and
+// that can follow "$env:" in PowerShell without braces.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// powerShellVar returns the PowerShell expression for the environment
+// variable name.
+func powerShellVar(name string) string {
+	if identifier.MatchString(name) {
+		return "$env:" + name
+	}
+	return "${env:" + strings.NewReplacer("`", "``", "}", "`}").Replace(name) + "}"
+}
@@ -0,0 +1,52 @@
+package patchenv
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	_ "crypto/sha256" // for crypto.SHA256
+	_ "crypto/sha512" // for crypto.SHA384
+	"errors"
+	"fmt"
+)
+
+// fipsVar is the environment variable that, when set to "1", restricts
+// patchenv to FIPS-approved cryptography.
+const fipsVar = "PATCH_ENV_FIPS"
+
+// FIPSMode reports whether patchenv is restricted to FIPS-approved
+// cryptography.  It's enabled when the program is built with the
+// patchenv_fips build tag, when Go's own FIPS 140-3 mode is enabled (with
+// GOFIPS140 at build time or GODEBUG=fips140=on, on Go 1.24 and later), or
+// when the PATCH_ENV_FIPS environment variable is set to "1".
+//
+// In FIPS mode, snapshot bundles must be signed with ECDSA on the P-256 or
+// P-384 curve rather than Ed25519, which isn't approved by every FIPS 140
+// validated module; bundles are still encrypted with AES-GCM.  The TLS
+// connections some providers make are restricted by Go's FIPS mode itself.
+func FIPSMode() bool {
+	return fipsBuild || goFIPS() || envEnabled(fipsVar)
+}
+
+// signatureAlgorithm returns the name of the algorithm that key signs
+// bundles with, or an error if it isn't supported (or, in FIPS mode,
+// approved).
+func signatureAlgorithm(key crypto.PublicKey) (string, crypto.Hash, error) {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if FIPSMode() {
+			return "", 0, errors.New("Ed25519 keys can't be used in FIPS mode; use ECDSA P-256 or P-384")
+		}
+		return "ed25519", 0, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ecdsa-p256-sha256", crypto.SHA256, nil
+		case elliptic.P384():
+			return "ecdsa-p384-sha384", crypto.SHA384, nil
+		}
+		return "", 0, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	}
+	return "", 0, fmt.Errorf("unsupported bundle key type %T", key)
+}
@@ -0,0 +1,11 @@
+//go:build go1.24
+// +build go1.24
+
+package patchenv
+
+import "crypto/fips140"
+
+// goFIPS reports whether Go's FIPS 140-3 mode is enabled.
+func goFIPS() bool {
+	return fips140.Enabled()
+}
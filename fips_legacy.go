@@ -0,0 +1,10 @@
+//go:build !go1.24
+// +build !go1.24
+
+package patchenv
+
+// goFIPS reports whether Go's FIPS 140-3 mode is enabled, which it can't
+// be before Go 1.24.
+func goFIPS() bool {
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build !patchenv_fips
+// +build !patchenv_fips
+
+package patchenv
+
+// fipsBuild is whether the patchenv_fips build tag enables FIPS mode.
+const fipsBuild = false
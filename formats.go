@@ -0,0 +1,259 @@
+package patchenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatVar is the environment variable that names the format of the
+// command's output, when it can't be detected.
+const formatVar = "PATCH_ENV_FORMAT"
+
+// PayloadFormat is a structured payload format, like YAML, that a Parser
+// can read in addition to the "var=value" line protocol and the JSON
+// envelope.  Packages that add formats register them with RegisterFormat.
+type PayloadFormat struct {
+	// Decode decodes a payload into a tree of map[string]interface{},
+	// []interface{}, and scalar values, like json.Unmarshal does into an
+	// interface{}.  The top level must be a map.
+	Decode func(data []byte) (interface{}, error)
+
+	// Detect reports whether data looks like a payload in this format,
+	// so it's read that way without a format being named.  It's nil if
+	// the format can't be detected.
+	Detect func(data []byte) bool
+}
+
+var (
+	// formatsMu guards formats.
+	formatsMu sync.RWMutex
+
+	// formats maps the names of the registered payload formats to them.
+	formats = map[string]PayloadFormat{}
+)
+
+// RegisterFormat makes a payload format available to Parser under name,
+// like "yaml".  Packages usually call it from an init function.
+// RegisterFormat panics if name is already registered, is one of the
+// built-in formats "lines", "json", and "jsonl", or Decode is nil.
+func RegisterFormat(name string, format PayloadFormat) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	name = strings.ToLower(name)
+	if format.Decode == nil {
+		panic("patchenv: RegisterFormat Decode is nil")
+	}
+	if _, dup := formats[name]; dup || isBuiltinFormat(name) {
+		panic("patchenv: RegisterFormat called twice for " + name)
+	}
+	formats[name] = format
+}
+
+// isBuiltinFormat reports whether name is one of the payload formats that
+// Parser accepts without any being registered.
+func isBuiltinFormat(name string) bool {
+	for _, builtin := range payloadFormats {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadFormatNames returns the built-in payload formats followed by the
+// registered ones, sorted.
+func payloadFormatNames() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(append([]string(nil), payloadFormats...), names...)
+}
+
+// detectFormat returns the registered format whose Detect function
+// recognizes data, trying them in order of name.
+func detectFormat(data []byte) (PayloadFormat, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if f := formats[name]; f.Detect != nil && f.Detect(data) {
+			return f, true
+		}
+	}
+	return PayloadFormat{}, false
+}
+
+// lookupFormat returns the registered format called name.
+func lookupFormat(name string) (PayloadFormat, error) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return PayloadFormat{}, fmt.Errorf("patchenv: unknown payload format %q (is its package imported?)", name)
+	}
+	return f, nil
+}
+
+// parseFormat decodes data in format and returns the variables it defines.
+func (p *Parser) parseFormat(format PayloadFormat, data []byte) ([]Var, error) {
+	tree, err := format.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid payload: %w", err)
+	}
+	if err := p.PayloadSchema.check(tree); err != nil {
+		return nil, err
+	}
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("patchenv: payload must be a mapping, not %T", tree)
+	}
+	return p.flatten(nil, "", m, 1)
+}
+
+// ArrayPolicy controls how a Parser sets variables for the arrays in
+// structured payloads.
+type ArrayPolicy int
+
+const (
+	// ArraysJSON sets a variable to the array encoded as JSON, like
+	// HOSTS=["a","b"].  It's the default.
+	ArraysJSON ArrayPolicy = iota
+
+	// ArraysIndexed flattens arrays like maps, using each element's index
+	// as its key, like HOSTS_0=a and HOSTS_1=b.
+	ArraysIndexed
+)
+
+// flatten appends the variables for the entries of m, which is nested depth
+// levels deep, to vars, naming them after their keys, with the keys of
+// nested maps joined to prefix by the Parser's Separator.
+func (p *Parser) flatten(vars []Var, prefix string, m map[string]interface{}, depth int) ([]Var, error) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var err error
+		if vars, err = p.flattenValue(vars, p.join(prefix, key), m[key], depth); err != nil {
+			return vars, err
+		}
+	}
+	return vars, nil
+}
+
+// flattenValue appends the variables for value, named name, to vars.
+// Maps, and arrays with ArraysIndexed, are flattened unless they're nested
+// more deeply than the Parser's MaxDepth allows.
+func (p *Parser) flattenValue(vars []Var, name string, value interface{}, depth int) ([]Var, error) {
+	deeper := p.MaxDepth <= 0 || depth < p.MaxDepth
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if deeper {
+			return p.flatten(vars, name, v, depth+1)
+		}
+	case []interface{}:
+		if deeper && p.Arrays == ArraysIndexed {
+			for i, elem := range v {
+				var err error
+				if vars, err = p.flattenValue(vars, p.join(name, strconv.Itoa(i)), elem, depth+1); err != nil {
+					return vars, err
+				}
+			}
+			return vars, nil
+		}
+	case nil:
+		return append(vars, Var{Name: p.varName(name), Unset: true}), nil
+	}
+	s, err := scalarString(value)
+	if err != nil {
+		return vars, fmt.Errorf("patchenv: can't read %s: %w", name, err)
+	}
+	return append(vars, Var{Name: p.varName(name), Value: s}), nil
+}
+
+// join returns the name of the value key nested in prefix.
+func (p *Parser) join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	separator := p.Separator
+	if separator == "" {
+		separator = "_"
+	}
+	return prefix + separator + key
+}
+
+// varName returns the environment variable name for the key path name:
+// upper-cased, with characters other than letters, digits, and
+// underscores replaced by underscores, unless the Parser's KeepNames is
+// set.
+func (p *Parser) varName(name string) string {
+	if p.KeepNames {
+		return name
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// scalarString returns the value of a variable given in a structured
+// payload as a string.  Maps and arrays are encoded as JSON.
+func scalarString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// withFormatFromEnv returns p, or a copy of it with Format set from
+// PATCH_ENV_FORMAT if p doesn't name a format, for parsing a command's
+// output.
+func (p *Parser) withFormatFromEnv() *Parser {
+	format := os.Getenv(formatVar)
+	if p.Format != "" || format == "" {
+		return p
+	}
+	copied := *p
+	copied.Format = format
+	return &copied
+}
@@ -0,0 +1,113 @@
+package patchenv
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetString returns the value of the environment variable key, or def if
+// the variable is unset or empty.
+func GetString(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// GetInt parses the environment variable key as an integer (in decimal, or
+// with a 0x, 0o, or 0b prefix), returning def if the variable is unset or
+// empty.  If the value can't be parsed, GetInt returns def and a
+// *ParseError.
+func GetInt(key string, def int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(value, 0, strconv.IntSize)
+	if err != nil {
+		return def, &ParseError{Name: key, Value: value, Err: err}
+	}
+	return int(n), nil
+}
+
+// GetBool parses the environment variable key with strconv.ParseBool(),
+// returning def if the variable is unset or empty.  If the value can't be
+// parsed, GetBool returns def and a *ParseError.
+func GetBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return def, &ParseError{Name: key, Value: value, Err: err}
+	}
+	return b, nil
+}
+
+// GetDuration parses the environment variable key with time.ParseDuration(),
+// returning def if the variable is unset or empty.  If the value can't be
+// parsed, GetDuration returns def and a *ParseError.
+func GetDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return def, &ParseError{Name: key, Value: value, Err: err}
+	}
+	return d, nil
+}
+
+// GetURL parses the environment variable key with url.Parse(), or parses
+// def if the variable is unset or empty.  If the value can't be parsed, or
+// if it's an absolute URL without a host, GetURL returns a *ParseError.
+func GetURL(key, def string) (*url.URL, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		value = def
+	}
+	u, err := parseURL(value)
+	if err != nil {
+		return nil, &ParseError{Name: key, Value: value, Err: err}
+	}
+	return u, nil
+}
+
+// parseURL parses s with url.Parse(), rejecting absolute URLs that have
+// nothing after the scheme.
+func parseURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err == nil && u.Scheme != "" && u.Host == "" && u.Opaque == "" && u.Path == "" {
+		err = fmt.Errorf("URL %q has no host", s)
+	}
+	return u, err
+}
+
+// ParseError is returned by the Get functions when an environment
+// variable's value can't be parsed as the requested type.
+type ParseError struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Value is the value that couldn't be parsed.  It's left out of the
+	// error message, since it may be secret.
+	Value string
+
+	// Err is the error returned by the parser.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("patchenv: can't parse %s: %s", e.Name, hideValue(e.Err, e.Value))
+}
+
+// Unwrap returns the error returned by the parser.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
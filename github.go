@@ -0,0 +1,94 @@
+package patchenv
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	// githubActionsVar is set to "true" by GitHub Actions in every step.
+	githubActionsVar = "GITHUB_ACTIONS"
+
+	// githubEnvVar names the file that a GitHub Actions step appends
+	// variables to so later steps see them.
+	githubEnvVar = "GITHUB_ENV"
+
+	// githubExportVar is the environment variable that, when set to a true
+	// value, enables WithGitHubEnv.
+	githubExportVar = "PATCH_ENV_GITHUB_ENV"
+)
+
+// inGitHubActions reports whether the process is running in a GitHub
+// Actions step.
+func inGitHubActions() bool {
+	return os.Getenv(githubActionsVar) == "true"
+}
+
+// exportToGitHub appends vars to the file named by GITHUB_ENV so later steps
+// of the workflow see them, after asking GitHub Actions to mask the values
+// of secret variables in the log.  Variables that were unset can't be
+// exported and are skipped with a warning.
+func exportToGitHub(vars []Var) error {
+	path := os.Getenv(githubEnvVar)
+	if path == "" {
+		return fmt.Errorf("patchenv: %s is not set", githubEnvVar)
+	}
+
+	var b strings.Builder
+	for _, v := range vars {
+		if v.Unset {
+			log.Printf("[WARNING] patchenv: can't unset %s in later GitHub Actions steps", v.Name)
+			continue
+		}
+		if v.Secret {
+			for _, line := range strings.Split(v.Value, "\n") {
+				if line = strings.TrimRight(line, "\r"); line != "" {
+					// GitHub Actions reads workflow commands from stdout.
+					fmt.Printf("::add-mask::%s\n", line)
+				}
+			}
+		}
+
+		if !strings.ContainsAny(v.Value, "\r\n") {
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, v.Value)
+			continue
+		}
+		delim, err := githubDelimiter(v.Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s<<%s\n%s\n%s\n", v.Name, delim, v.Value, delim)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("patchenv: can't open %s: %w", githubEnvVar, err)
+	}
+	_, err = f.WriteString(b.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("patchenv: can't write %s: %w", githubEnvVar, err)
+	}
+	return nil
+}
+
+// githubDelimiter returns a random heredoc delimiter for a multi-line
+// value in GITHUB_ENV that doesn't appear in value.
+func githubDelimiter(value string) (string, error) {
+	for {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("patchenv: can't generate delimiter: %w", err)
+		}
+		delim := "ghadelimiter_" + hex.EncodeToString(buf)
+		if !strings.Contains(value, delim) {
+			return delim, nil
+		}
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/arpio/patchenv
 
-go 1.13
+go 1.17
@@ -0,0 +1,86 @@
+package patchenv
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Environment variables that describe patchenv's capabilities to the
+// command, so helper tools can tailor their output and degrade gracefully
+// when run by older versions of patchenv.
+const (
+	// formatsVar lists the payload formats Parser accepts.
+	formatsVar = "PATCH_ENV_FORMATS"
+
+	// featuresVar lists the optional payload features patchenv supports.
+	featuresVar = "PATCH_ENV_FEATURES"
+
+	// platformVar is the operating system and architecture of the process
+	// running the command, as "GOOS/GOARCH".
+	platformVar = "PATCH_ENV_PLATFORM"
+)
+
+// Environment variables that describe the process running the command, so
+// helper tools can make decisions (like which credentials to return)
+// without external plumbing.
+const (
+	// parentPIDVar is the process ID of the process running the command.
+	parentPIDVar = "PATCH_ENV_PARENT_PID"
+
+	// parentExeVar is the path of the executable of the process running
+	// the command.
+	parentExeVar = "PATCH_ENV_PARENT_EXE"
+
+	// invocationVar says why the command is being run.
+	invocationVar = "PATCH_ENV_INVOCATION"
+
+	// noChangesExitVar is the exit status the command can use to report
+	// that there is nothing to change.
+	noChangesExitVar = "PATCH_ENV_NO_CHANGES_EXIT"
+)
+
+// Invocation says why patchenv is running the command, and is passed to the
+// command in the PATCH_ENV_INVOCATION environment variable.
+type Invocation string
+
+const (
+	// InvocationStartup means the environment is being patched for the
+	// first time, usually as the program starts.  It's the default.
+	InvocationStartup Invocation = "startup"
+
+	// InvocationReload means an environment that was already patched is
+	// being refreshed.
+	InvocationReload Invocation = "reload"
+)
+
+// payloadFormats are the payload formats that Parser accepts without any
+// registered with RegisterFormat, as listed in PATCH_ENV_FORMATS.
+var payloadFormats = []string{"lines", "json", "jsonl"}
+
+// payloadFeatures are the optional JSON envelope features that patchenv
+// supports, as listed in PATCH_ENV_FEATURES.
+var payloadFeatures = []string{"secret", "ttl", "unset", "files", "no-changes", "when", "not-before"}
+
+// handshakeEnv returns the variables, in "name=value" form, that are added
+// to the command's environment to describe patchenv's capabilities and the
+// process running the command.
+func handshakeEnv(invocation Invocation) []string {
+	if invocation == "" {
+		invocation = InvocationStartup
+	}
+	env := []string{
+		protocolVar + "=" + strconv.Itoa(protocolVersion),
+		formatsVar + "=" + strings.Join(payloadFormatNames(), ","),
+		featuresVar + "=" + strings.Join(payloadFeatures, ","),
+		platformVar + "=" + runtime.GOOS + "/" + runtime.GOARCH,
+		parentPIDVar + "=" + strconv.Itoa(os.Getpid()),
+		invocationVar + "=" + string(invocation),
+		noChangesExitVar + "=" + strconv.Itoa(NoChangesExitCode),
+	}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, parentExeVar+"="+exe)
+	}
+	return env
+}
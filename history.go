@@ -0,0 +1,226 @@
+package patchenv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultHistoryLimit is the number of generations a History keeps if its
+// Limit is zero.
+const defaultHistoryLimit = 10
+
+// Generation is one set of changes applied to the environment, as recorded
+// by a History.
+type Generation struct {
+	// Number identifies the generation.  Numbers increase by one with
+	// each generation recorded.
+	Number int
+
+	// Applied is when the changes were applied.
+	Applied time.Time
+
+	// Vars are the variables that were set and unset.
+	Vars []Var
+
+	// Previous are the values the changed variables had before, with
+	// Unset set for variables that weren't set.
+	Previous []Var
+}
+
+// History records the generations of changes a Refresher applies, so an
+// operator can revert a bad configuration push with RollbackTo.  The zero
+// value keeps the last 10 generations in memory.
+//
+// If Path is set, the history is also saved in that file after each
+// change, and read from it when it's first used, so it survives restarts.
+// The file holds the variables' values, including secret ones, so it's
+// created readable only by its owner.
+type History struct {
+	// Limit is the number of generations kept, or zero to keep 10.
+	Limit int
+
+	// Path is the file the history is saved in, or empty to keep it only
+	// in memory.
+	Path string
+
+	mu     sync.Mutex
+	gens   []Generation
+	next   int
+	loaded bool
+}
+
+// historyFile is the JSON document History saves.
+type historyFile struct {
+	Next        int          `json:"next"`
+	Generations []Generation `json:"generations"`
+}
+
+// Generations returns the recorded generations, oldest first.
+func (h *History) Generations() []Generation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	return append([]Generation(nil), h.gens...)
+}
+
+// record saves the changes in result as a new generation, given the
+// environment before they were applied.
+func (h *History) record(result *Result, before map[string]string) {
+	if len(result.Vars) == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	gen := Generation{Number: h.next + 1, Applied: time.Now(), Vars: cloneVars(result.Vars)}
+	seen := make(map[string]bool)
+	for _, v := range result.Vars {
+		if seen[v.Name] {
+			continue
+		}
+		seen[v.Name] = true
+		value, ok := before[v.Name]
+		gen.Previous = append(gen.Previous, Var{Name: v.Name, Value: value, Unset: !ok, Secret: v.Secret})
+	}
+	h.next = gen.Number
+	h.gens = append(h.gens, gen)
+	limit := h.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if len(h.gens) > limit {
+		h.gens = append([]Generation(nil), h.gens[len(h.gens)-limit:]...)
+	}
+	h.save()
+}
+
+// RollbackTo restores the environment to what it was right after the
+// given generation was applied, by undoing the later generations newest
+// first, and removes them from the history.  Rolling back to generation 0
+// undoes every recorded generation.  The source isn't changed, so the
+// next refresh applies its changes again if they're still there.
+func (h *History) RollbackTo(generation int) error {
+	rolledBack := false
+	defer func() {
+		if rolledBack {
+			emit(EventRollback, func(e *Event) {
+				e.Generation = generation
+			})
+		}
+	}()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+
+	keep := len(h.gens)
+	for keep > 0 && h.gens[keep-1].Number > generation {
+		keep--
+	}
+	if keep == len(h.gens) {
+		if generation == h.next {
+			return nil
+		}
+		return fmt.Errorf("patchenv: no generation %d to roll back to", generation)
+	}
+	if !(generation == 0 && h.gens[0].Number == 1) && (keep == 0 || h.gens[keep-1].Number != generation) {
+		return fmt.Errorf("patchenv: generation %d is not in the history", generation)
+	}
+
+	for i := len(h.gens) - 1; i >= keep; i-- {
+		for _, v := range h.gens[i].Previous {
+			var err error
+			if v.Unset {
+				err = os.Unsetenv(v.Name)
+			} else {
+				err = os.Setenv(v.Name, v.Value)
+			}
+			if err != nil {
+				return fmt.Errorf("patchenv: can't restore %s: %w", v.Name, err)
+			}
+		}
+		h.gens = h.gens[:i]
+	}
+	h.next = generation
+	h.save()
+	rolledBack = true
+	return nil
+}
+
+// load reads the history file the first time the history is used.  The
+// caller must hold h.mu.
+func (h *History) load() {
+	if h.loaded || h.Path == "" {
+		h.loaded = true
+		return
+	}
+	h.loaded = true
+	data, err := os.ReadFile(h.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var file historyFile
+	if err == nil {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		log.Printf("[WARNING] patchenv: can't read history from %s: %s", h.Path, err)
+		return
+	}
+	h.next, h.gens = file.Next, file.Generations
+}
+
+// save writes the history file, if there is one.  The caller must hold
+// h.mu.
+func (h *History) save() {
+	if h.Path == "" {
+		return
+	}
+	data, err := json.Marshal(historyFile{Next: h.next, Generations: h.gens})
+	if err == nil {
+		err = writeFileAtomic(h.Path, data)
+	}
+	if err != nil {
+		log.Printf("[WARNING] patchenv: can't save history to %s: %s", h.Path, err)
+	}
+}
+
+// writeFileAtomic replaces the file at path with data, readable only by
+// its owner, so readers never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// environMap returns the process's environment as a map.
+func environMap() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		for i := 1; i < len(kv); i++ {
+			if kv[i] == '=' {
+				env[kv[:i]] = kv[i+1:]
+				break
+			}
+		}
+	}
+	return env
+}
@@ -0,0 +1,86 @@
+package patchenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// jsonLinesVar is a line of the JSON Lines payload format:
+//
+//	{"name": "AWS_ACCESS_KEY_ID", "value": "AKIA..."}
+//	{"name": "AWS_SESSION_TOKEN", "value": "...", "secret": true, "ttl": "1h"}
+//	{"name": "AWS_PROFILE", "unset": true}
+//
+// Each line has the fields of an entry in an envelope's "vars" list, and
+// can unset the variable instead of setting it.  Since each line stands on
+// its own, a command can write them as it computes them.
+type jsonLinesVar struct {
+	envelopeVar
+	Unset bool `json:"unset"`
+}
+
+// isJSONLines reports whether data, with leading whitespace removed, starts
+// with a JSON object that describes a variable rather than a JSON envelope.
+func isJSONLines(data []byte) bool {
+	if !isEnvelope(data) {
+		return false
+	}
+	var first map[string]json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&first); err != nil {
+		return false
+	}
+	_, hasName := first["name"]
+	_, hasVersion := first["version"]
+	return hasName && !hasVersion
+}
+
+// parseJSONLines decodes the JSON Lines payload format from r and returns
+// the variables it defines, in order.
+func (p *Parser) parseJSONLines(r io.Reader) ([]Var, error) {
+	var vars []Var
+	now := time.Now()
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return vars, nil
+		}
+		if err == nil {
+			if err := p.PayloadSchema.checkJSON(raw); err != nil {
+				var perr *PayloadError
+				if errors.As(err, &perr) {
+					perr.Record = n
+				}
+				return nil, err
+			}
+		}
+		var line jsonLinesVar
+		if err == nil {
+			err = json.Unmarshal(raw, &line)
+		}
+		if err != nil {
+			return vars, fmt.Errorf("patchenv: invalid JSON Lines payload at record %d: %w", n, err)
+		}
+		if line.Name == "" {
+			return vars, fmt.Errorf("patchenv: JSON Lines record %d has no name", n)
+		}
+		if ok, err := line.When.matches(); err != nil {
+			return vars, err
+		} else if !ok {
+			continue
+		}
+		vars = append(vars, Var{
+			Name:      line.Name,
+			Value:     line.Value,
+			Unset:     line.Unset,
+			Secret:    line.Secret,
+			Expires:   line.expires(now),
+			NotBefore: line.NotBefore,
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package patchenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// KubernetesOptions configures the YAML written by Result.WriteKubernetesEnv
+// and Result.WriteKubernetesSecret.
+type KubernetesOptions struct {
+	// SecretName is the name of the Secret that holds the variables.  If
+	// it's empty, WriteKubernetesEnv writes the values inline, and
+	// WriteKubernetesSecret returns an error.
+	SecretName string
+
+	// Namespace is the namespace in the Secret manifest's metadata.  If
+	// it's empty, the manifest doesn't set one.
+	Namespace string
+
+	// EnvFrom makes WriteKubernetesEnv reference the whole Secret with an
+	// envFrom block, instead of referencing each variable with a
+	// secretKeyRef.
+	EnvFrom bool
+}
+
+// secretKey matches the keys allowed in a Kubernetes Secret's data.
+var secretKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// WriteKubernetesEnv writes the result's variables to w as the env (or
+// envFrom) block of a Kubernetes container spec, to paste into a manifest.
+// If opts.SecretName is set, the values are referenced from that Secret,
+// which WriteKubernetesSecret can generate, rather than written inline.
+// Unset variables are left out, since a container can't unset a variable.
+func (r *Result) WriteKubernetesEnv(w io.Writer, opts KubernetesOptions) error {
+	var b strings.Builder
+	switch {
+	case opts.SecretName != "" && opts.EnvFrom:
+		fmt.Fprintf(&b, "envFrom:\n  - secretRef:\n      name: %s\n", yamlQuote(opts.SecretName))
+	default:
+		b.WriteString("env:\n")
+		for _, v := range r.finalVars() {
+			if v.Unset {
+				continue
+			}
+			fmt.Fprintf(&b, "  - name: %s\n", yamlQuote(v.Name))
+			if opts.SecretName == "" {
+				fmt.Fprintf(&b, "    value: %s\n", yamlQuote(v.Value))
+				continue
+			}
+			if !secretKey.MatchString(v.Name) {
+				return fmt.Errorf("patchenv: can't reference %s from a Secret: not a valid Secret key", v.Name)
+			}
+			fmt.Fprintf(&b, "    valueFrom:\n      secretKeyRef:\n        name: %s\n        key: %s\n",
+				yamlQuote(opts.SecretName), yamlQuote(v.Name))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteKubernetesSecret writes a Kubernetes Secret manifest named
+// opts.SecretName to w, holding the result's variables as stringData.
+// Unset variables are left out.
+func (r *Result) WriteKubernetesSecret(w io.Writer, opts KubernetesOptions) error {
+	if opts.SecretName == "" {
+		return errors.New("patchenv: a Secret manifest needs a name")
+	}
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: Secret\nmetadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", yamlQuote(opts.SecretName))
+	if opts.Namespace != "" {
+		fmt.Fprintf(&b, "  namespace: %s\n", yamlQuote(opts.Namespace))
+	}
+	b.WriteString("type: Opaque\nstringData:\n")
+	for _, v := range r.finalVars() {
+		if v.Unset {
+			continue
+		}
+		if !secretKey.MatchString(v.Name) {
+			return fmt.Errorf("patchenv: can't put %s in a Secret: not a valid Secret key", v.Name)
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", yamlQuote(v.Name), yamlQuote(v.Value))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// yamlQuote returns s as a YAML double-quoted scalar.  JSON strings are
+// valid YAML double-quoted scalars, so s is encoded as JSON.
+func yamlQuote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,50 @@
+package patchenv
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// patched is set to 1 once PatchWith has updated the environment.
+var patched int32
+
+// lazyPatch serializes the patch made on first use by EnsurePatched, and
+// records whether it's been tried, so a failing command isn't rerun.
+var lazyPatch struct {
+	sync.Mutex
+	tried bool
+}
+
+// Getenv is like os.Getenv, but patches the environment with Patch the
+// first time it's called, so packages deep in a program's dependencies can
+// rely on the patched environment without main() calling Patch early.  If
+// the program has already patched the environment with Patch or PatchWith,
+// Getenv doesn't patch it again.  If patching fails, a warning is logged and
+// Getenv returns the unpatched value.
+func Getenv(key string) string {
+	value, _ := lookupEnv(key, 1)
+	return value
+}
+
+// LookupEnv is like os.LookupEnv, but patches the environment on first use
+// as Getenv does.
+//
+// When PATCH_ENV_TRACK_READS is set to "1", Getenv and LookupEnv don't
+// patch the environment; see EarlyReads.
+func LookupEnv(key string) (string, bool) {
+	return lookupEnv(key, 1)
+}
+
+// EnsurePatched patches the environment with Patch unless it's already been
+// patched or tried, for packages that want to handle a failure themselves
+// instead of having Getenv log it.  Only the call that makes the patch
+// returns its error; later calls return nil.
+func EnsurePatched() error {
+	lazyPatch.Lock()
+	defer lazyPatch.Unlock()
+	if lazyPatch.tried || atomic.LoadInt32(&patched) != 0 {
+		return nil
+	}
+	lazyPatch.tried = true
+	return Patch()
+}
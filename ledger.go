@@ -0,0 +1,152 @@
+package patchenv
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ledgerMu guards ledger and ledgerGen.
+	ledgerMu sync.Mutex
+
+	// ledger maps the names of the variables PatchWith has set in the
+	// process's environment to their definitions, so they can be kept
+	// from child processes, scrubbed, and masked.
+	ledger = make(map[string]Var)
+
+	// ledgerGen counts the changes to ledger.
+	ledgerGen uint64
+
+	// ledgerFiles maps the paths of the files Resolve wrote for File
+	// variables to the variables' names, so Scrub can remove them.
+	ledgerFiles = make(map[string]string)
+)
+
+// recordLedger remembers the variables PatchWith set and unset.
+func recordLedger(vars []Var) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	ledgerGen++
+	for _, v := range vars {
+		if v.Unset {
+			delete(ledger, v.Name)
+		} else {
+			ledger[v.Name] = v
+		}
+	}
+}
+
+// recordFiles remembers the files Resolve wrote for the File variables in
+// vars.
+func recordFiles(vars []Var) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	for _, v := range vars {
+		if v.File {
+			ledgerFiles[v.Value] = v.Name
+		}
+	}
+}
+
+// takeFiles returns the File variables whose files Resolve wrote, and
+// forgets them.
+func takeFiles() []Var {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	vars := make([]Var, 0, len(ledgerFiles))
+	for path, name := range ledgerFiles {
+		vars = append(vars, Var{Name: name, Value: path, File: true})
+	}
+	ledgerFiles = make(map[string]string)
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Value < vars[j].Value })
+	return vars
+}
+
+// ledgerVars returns the variables PatchWith set for which keep returns
+// true, sorted by name.
+func ledgerVars(keep func(Var) bool) []Var {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	var vars []Var
+	for _, v := range ledger {
+		if keep(v) {
+			vars = append(vars, v)
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// environValue returns the value of the variable name in env, an
+// environment in the "name=value" form of os.Environ, comparing names
+// case-insensitively if foldCase is true.  As for exec.Cmd, the last entry
+// for name wins.
+func environValue(env []string, name string, foldCase bool) (string, bool) {
+	value, found := "", false
+	for _, kv := range env {
+		i := strings.Index(kv, "=")
+		if i <= 0 {
+			continue
+		}
+		if kv[:i] == name || foldCase && strings.EqualFold(kv[:i], name) {
+			value, found = kv[i+1:], true
+		}
+	}
+	return value, found
+}
+
+// InheritPolicy controls which of the variables PatchWith set are passed
+// on to a child process by Inherit.
+type InheritPolicy int
+
+const (
+	// InheritNoSecrets passes on the variables PatchWith set, except the
+	// ones whose values are secret.  It's the default.
+	InheritNoSecrets InheritPolicy = iota
+
+	// InheritAll passes on every variable, as exec.Cmd does by default.
+	InheritAll
+
+	// InheritNone passes on none of the variables PatchWith set, so the
+	// child process sees the environment the program started with, plus
+	// any changes it made on its own.
+	InheritNone
+)
+
+// Inherit sets the environment of cmd, which hasn't been started yet, to
+// its current one (cmd.Env, or the process's environment if that's nil)
+// without the variables policy keeps from it.  It keeps secrets that
+// PatchWith set, like credentials, from leaking to tools the program
+// runs:
+//
+//	cmd := exec.Command("git", "fetch")
+//	patchenv.Inherit(cmd, patchenv.InheritNoSecrets)
+//
+// Only variables that still have the values PatchWith gave them are
+// removed, so ones the program has since set itself are passed on.
+func Inherit(cmd *exec.Cmd, policy InheritPolicy) {
+	if policy == InheritAll {
+		return
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	foldCase := runtime.GOOS == "windows"
+	var changes Changes
+	for _, v := range ledgerVars(func(v Var) bool { return policy == InheritNone || v.Secret }) {
+		if value, ok := environValue(env, v.Name, foldCase); ok && value == v.Value {
+			changes = append(changes, Var{Name: v.Name, Unset: true})
+		}
+	}
+	cmd.Env = applyEnv(env, changes, foldCase)
+	if cmd.Env == nil {
+		// An empty, non-nil Env keeps exec.Cmd from using the process's
+		// environment.
+		cmd.Env = []string{}
+	}
+}
@@ -0,0 +1,48 @@
+package patchenv
+
+import (
+	"errors"
+	"time"
+)
+
+// Limits restricts the resources a command can use, so a misbehaving helper
+// can't take down the host or stall the program's startup.  The zero value
+// sets no limits.
+//
+// On Linux, the limits are resource limits, and they're inherited by the
+// processes the command starts.  They're set while the command is stopped
+// under ptrace right after it execs, so they can't be used where ptrace is
+// forbidden, as it can be by Yama, a container's seccomp profile, or
+// gVisor; the error says so.  On Windows, the command is created suspended
+// and runs in a Job Object with the limits, so they apply to each process
+// in the job from the start, and FileSize isn't supported.  On other Unix
+// systems only Nice is supported.  ShellRunner returns an error without
+// running the command if a limit isn't supported.
+type Limits struct {
+	// CPUTime is the most CPU time each process may use before it's
+	// killed, rounded up to a second on Linux.
+	CPUTime time.Duration
+
+	// Memory is the most memory, in bytes, each process may use.  On
+	// Linux this limits the address space (RLIMIT_AS), which is larger
+	// than the memory in use, especially for Go programs.
+	Memory uint64
+
+	// FileSize is the largest file, in bytes, a process may write.
+	FileSize uint64
+
+	// Nice is the niceness to run the command with, from -20 (highest
+	// priority) to 19 (lowest), where 0 leaves the priority alone.  On
+	// Windows, positive values select a below-normal or idle priority
+	// class and negative values the above-normal class.
+	Nice int
+}
+
+// errLimitUnsupported is returned when a Limits field isn't supported on
+// the running platform.
+var errLimitUnsupported = errors.New("patchenv: resource limit is not supported on this platform")
+
+// isZero reports whether l sets no limits.
+func (l Limits) isZero() bool {
+	return l == Limits{}
+}
@@ -0,0 +1,86 @@
+package patchenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// manifestVar is the environment variable that WithManifest records the
+// variables' provenance in.
+const manifestVar = "PATCH_ENV_MANIFEST"
+
+// ManifestEntry describes where a variable in the PATCH_ENV_MANIFEST
+// environment variable came from.
+type ManifestEntry struct {
+	// Source describes the source that defined the variable, as in
+	// Explanation.Source.
+	Source string `json:"source"`
+
+	// Time is when patchenv set the variable.
+	Time time.Time `json:"time"`
+
+	// Secret is true if the variable's value is secret.
+	Secret bool `json:"secret,omitempty"`
+}
+
+// WithManifest makes PatchWith record where the variables it sets came from
+// in the PATCH_ENV_MANIFEST environment variable, as a compact JSON object
+// mapping their names to ManifestEntry objects, so child processes and
+// debugging tools can see where values came from:
+//
+//	{"AWS_REGION":{"source":"file /etc/myapp.env","time":"2024-05-01T12:00:00Z"}}
+//
+// Entries recorded by earlier calls, or by a parent process, are kept, and
+// the entries of variables PatchWith unsets are removed.  It never holds
+// the variables' values.
+func WithManifest() Option {
+	return func(cfg *config) {
+		cfg.manifest = true
+	}
+}
+
+// ReadManifest returns the entries of the PATCH_ENV_MANIFEST environment
+// variable, or an empty map if it isn't set.
+func ReadManifest() (map[string]ManifestEntry, error) {
+	manifest := make(map[string]ManifestEntry)
+	data, ok := os.LookupEnv(manifestVar)
+	if !ok || data == "" {
+		return manifest, nil
+	}
+	if err := json.Unmarshal([]byte(data), &manifest); err != nil {
+		return manifest, fmt.Errorf("patchenv: invalid %s: %w", manifestVar, err)
+	}
+	return manifest, nil
+}
+
+// updateManifest records the provenance of the variables result set in
+// PATCH_ENV_MANIFEST.
+func updateManifest(result *Result, now time.Time) error {
+	manifest, err := ReadManifest()
+	if err != nil {
+		log.Printf("[WARNING] %s; replacing it", err)
+	}
+	prov := result.provenance
+	if prov == nil {
+		prov = &provenance{}
+	}
+	now = now.UTC().Truncate(time.Second)
+	for _, v := range result.Vars {
+		if v.Unset {
+			delete(manifest, v.Name)
+			continue
+		}
+		manifest[v.Name] = ManifestEntry{Source: prov.sources[v.Name], Time: now, Secret: v.Secret}
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := os.Setenv(manifestVar, string(data)); err != nil {
+		return fmt.Errorf("patchenv: can't update %s: %w", manifestVar, err)
+	}
+	return nil
+}
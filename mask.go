@@ -0,0 +1,116 @@
+package patchenv
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secret values in the strings returned by Redact.
+const redacted = "[REDACTED]"
+
+// maskCache holds the secret values and their pattern as of a generation
+// of the ledger, so logging doesn't rebuild them for every message.
+var maskCache struct {
+	sync.Mutex
+	gen     uint64
+	values  []string
+	pattern *regexp.Regexp
+	built   bool
+}
+
+// noMatch is a regular expression that matches nothing, for when there are
+// no secrets.
+var noMatch = regexp.MustCompile(`[^\s\S]`)
+
+// secrets returns the current secret values and a pattern that matches
+// them.
+func secrets() ([]string, *regexp.Regexp) {
+	ledgerMu.Lock()
+	gen := ledgerGen
+	ledgerMu.Unlock()
+
+	maskCache.Lock()
+	defer maskCache.Unlock()
+	if maskCache.built && maskCache.gen == gen {
+		return maskCache.values, maskCache.pattern
+	}
+	var values []string
+	for _, v := range ledgerVars(func(v Var) bool { return v.Secret && !v.File && v.Value != "" }) {
+		values = append(values, v.Value)
+	}
+	// Longer values go first, so a secret that contains another is masked
+	// whole.
+	sort.SliceStable(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pattern := noMatch
+	if len(values) > 0 {
+		quoted := make([]string, len(values))
+		for i, value := range values {
+			quoted[i] = regexp.QuoteMeta(value)
+		}
+		pattern = regexp.MustCompile(strings.Join(quoted, "|"))
+	}
+	maskCache.gen, maskCache.values, maskCache.pattern, maskCache.built = gen, values, pattern, true
+	return values, pattern
+}
+
+// SecretValues returns the values of the secret variables PatchWith has
+// set, longest first, for log redaction middleware that takes a list of
+// strings to mask.  It reflects the latest patch, so call it for each
+// message, or at least after each refresh, rather than once at startup.
+// The slice must not be modified.
+func SecretValues() []string {
+	values, _ := secrets()
+	return values
+}
+
+// SecretPattern returns a regular expression that matches the values of
+// the secret variables PatchWith has set, for log redaction middleware
+// that takes a pattern, like a zap or logrus hook.  When there are no
+// secrets, it matches nothing.  Like SecretValues, it reflects the latest
+// patch.
+func SecretPattern() *regexp.Regexp {
+	_, pattern := secrets()
+	return pattern
+}
+
+// Redact returns s with the values of the secret variables PatchWith has
+// set replaced by "[REDACTED]", so they don't appear in logs.
+func Redact(s string) string {
+	values, pattern := secrets()
+	if len(values) == 0 {
+		return s
+	}
+	return pattern.ReplaceAllLiteralString(s, redacted)
+}
+
+// RedactWriter returns a writer that writes to w with secret values
+// redacted, as Redact does, for loggers that write each message with one
+// call to Write, like the log package:
+//
+//	log.SetOutput(patchenv.RedactWriter(os.Stderr))
+//
+// A secret split between two calls to Write isn't redacted.
+func RedactWriter(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+// redactWriter is the writer returned by RedactWriter.
+type redactWriter struct {
+	w io.Writer
+}
+
+// Write implements the io.Writer interface.  It reports writing all of p,
+// although what w is given has a different length.
+func (rw redactWriter) Write(p []byte) (int, error) {
+	values, pattern := secrets()
+	if len(values) == 0 {
+		return rw.w.Write(p)
+	}
+	if _, err := rw.w.Write(pattern.ReplaceAllLiteral(p, []byte(redacted))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
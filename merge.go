@@ -0,0 +1,200 @@
+package patchenv
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// MergeRule says why one definition of a variable took precedence over
+// another.
+type MergeRule string
+
+const (
+	// RuleLaterSource means the variable was defined by more than one of
+	// the sources given to WithSourceURI, and the later source won.
+	RuleLaterSource MergeRule = "later source takes precedence"
+
+	// RuleLaterDefinition means a source defined the variable more than
+	// once, and its later definition won.
+	RuleLaterDefinition MergeRule = "later definition takes precedence"
+
+	// RuleFirstDefinition means a source defined the variable more than
+	// once, and its first definition won because of DuplicatesFirstWins.
+	RuleFirstDefinition MergeRule = "first definition takes precedence"
+)
+
+// Conflict describes a variable that was defined more than once while
+// loading, and which definition took effect.
+type Conflict struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Winner describes the source of the definition that took effect.
+	Winner string
+
+	// Losers describe the sources of the definitions that were
+	// overridden, in the order they were loaded.  A source appears once
+	// for each definition it made.
+	Losers []string
+
+	// Rule says why Winner took precedence over the definition before it.
+	Rule MergeRule
+}
+
+// layer is the variables loaded from one of the sources that are merged.
+type layer struct {
+	// name describes the source.
+	name string
+
+	vars []Var
+}
+
+// loadLayers loads the variables from src, keeping the ones from each of
+// a multiSource's sources separate.
+func loadLayers(ctx context.Context, src Source) ([]layer, error) {
+	m, ok := src.(multiSource)
+	if !ok {
+		vars, err := src.Load(ctx)
+		return []layer{{name: describeSource(src), vars: vars}}, err
+	}
+	return m.loadLayers(ctx)
+}
+
+// flatten returns the variables of layers in order.
+func flatten(layers []layer) []Var {
+	var vars []Var
+	for _, l := range layers {
+		vars = append(vars, l.vars...)
+	}
+	return vars
+}
+
+// conflicts returns a Conflict for each variable defined more than once in
+// layers, in the order the variables were first defined.  policy decides
+// which of a single layer's definitions wins.
+func conflicts(layers []layer, policy DuplicatePolicy) []Conflict {
+	var names []string
+	defs := make(map[string][]int)
+	for i, l := range layers {
+		for _, v := range l.vars {
+			if _, ok := defs[v.Name]; !ok {
+				names = append(names, v.Name)
+			}
+			defs[v.Name] = append(defs[v.Name], i)
+		}
+	}
+
+	var result []Conflict
+	for _, name := range names {
+		d := defs[name]
+		if len(d) < 2 {
+			continue
+		}
+		winner, rule := d[0], RuleLaterSource
+		var losers []string
+		for _, l := range d[1:] {
+			if l == winner && policy == DuplicatesFirstWins {
+				losers = append(losers, layers[l].name)
+				rule = RuleFirstDefinition
+				continue
+			}
+			losers = append(losers, layers[winner].name)
+			if l == winner {
+				rule = RuleLaterDefinition
+			} else {
+				rule = RuleLaterSource
+			}
+			winner = l
+		}
+		result = append(result, Conflict{Name: name, Winner: layers[winner].name, Losers: losers, Rule: rule})
+	}
+	return result
+}
+
+// DuplicatePolicy controls what happens when a source defines a variable
+// more than once in the same payload.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesLastWins uses the last definition, as the environment
+	// would if the definitions were applied in order.
+	DuplicatesLastWins DuplicatePolicy = iota
+
+	// DuplicatesFirstWins uses the first definition.
+	DuplicatesFirstWins
+
+	// DuplicatesError makes PatchWith and Resolve return a
+	// *DuplicateError.
+	DuplicatesError
+)
+
+// WithDuplicatePolicy sets what PatchWith and Resolve do when a source
+// defines a variable more than once; by default, the last definition wins.
+// Either way, the duplicates are listed in Result.Conflicts.  Definitions
+// of the same variable by different sources given to WithSourceURI aren't
+// affected: the later source always wins.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return func(cfg *config) {
+		cfg.duplicates = policy
+	}
+}
+
+// DuplicateError is returned by PatchWith and Resolve, with
+// DuplicatesError, when a source defines a variable more than once.
+type DuplicateError struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Source describes the source that defined it.
+	Source string
+}
+
+// Error implements the error interface.
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("patchenv: %s is defined more than once by %s", e.Name, e.Source)
+}
+
+// applyDuplicatePolicy removes the definitions policy overrides from each
+// of layers, or returns a *DuplicateError for DuplicatesError.
+func applyDuplicatePolicy(layers []layer, policy DuplicatePolicy) error {
+	if policy == DuplicatesLastWins {
+		return nil
+	}
+	for i, l := range layers {
+		seen := make(map[string]bool, len(l.vars))
+		kept := l.vars[:0:0]
+		for _, v := range l.vars {
+			if seen[v.Name] {
+				if policy == DuplicatesError {
+					return &DuplicateError{Name: v.Name, Source: l.name}
+				}
+				continue
+			}
+			seen[v.Name] = true
+			kept = append(kept, v)
+		}
+		layers[i].vars = kept
+	}
+	return nil
+}
+
+// describeSource returns a short description of src for a Conflict.
+func describeSource(src Source) string {
+	switch s := src.(type) {
+	case *CommandSource:
+		return fmt.Sprintf("command %q", s.Command)
+	case *FileSource:
+		return "file " + s.Path
+	case *URLSource:
+		if u, err := url.Parse(s.URL); err == nil {
+			return u.Redacted()
+		}
+		return "URL"
+	case *PluginSource:
+		return "plugin " + s.Name
+	case *BundleSource:
+		return "bundle " + s.Path
+	}
+	return fmt.Sprintf("%T", src)
+}
@@ -0,0 +1,86 @@
+package patchenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathListConverter converts between the colon-separated path lists of a
+// POSIX layer for Windows, like MSYS2 (including Git Bash) or Cygwin, and
+// semicolon-separated Windows path lists.  Its methods are Transforms, so
+// a payload's PATH written in one world can be used in the other:
+//
+//	patchenv.PatchWith(patchenv.WithTransform(patchenv.MSYS.ToWindows, "PATH"))
+type PathListConverter struct {
+	// DrivePrefix is the directory the drives appear under, like "/" for
+	// /c/Users or "/cygdrive/" for /cygdrive/c/Users.
+	DrivePrefix string
+
+	// Root is the Windows directory of the POSIX root, like C:\msys64.
+	// If it's empty, absolute POSIX paths that aren't on a drive (like
+	// /usr/bin) can't be converted to Windows paths.
+	Root string
+}
+
+// Converters for the default layouts of MSYS2 and Cygwin.  Set Root on a
+// copy to convert paths inside the installation.
+var (
+	MSYS   = PathListConverter{DrivePrefix: "/"}
+	Cygwin = PathListConverter{DrivePrefix: "/cygdrive/"}
+)
+
+// ToWindows converts a colon-separated list of POSIX paths to a
+// semicolon-separated list of Windows paths.
+func (c PathListConverter) ToWindows(value string) (string, error) {
+	return convertPathList(value, ":", ";", c.pathToWindows)
+}
+
+// FromWindows converts a semicolon-separated list of Windows paths to a
+// colon-separated list of POSIX paths.
+func (c PathListConverter) FromWindows(value string) (string, error) {
+	return convertPathList(value, ";", ":", c.pathFromWindows)
+}
+
+// pathToWindows converts a POSIX path to a Windows path.
+func (c PathListConverter) pathToWindows(path string) (string, error) {
+	switch {
+	case !strings.HasPrefix(path, "/"):
+		return strings.ReplaceAll(path, "/", `\`), nil
+	case strings.HasPrefix(path, "//"):
+		return strings.ReplaceAll(path, "/", `\`), nil
+	}
+	prefix := c.drivePrefix()
+	if rest := strings.TrimPrefix(path, prefix); rest != path && len(rest) > 0 &&
+		isASCIILetter(rest[0]) && (len(rest) == 1 || rest[1] == '/') {
+		return strings.ToUpper(rest[:1]) + `:\` + strings.ReplaceAll(strings.TrimPrefix(rest[1:], "/"), "/", `\`), nil
+	}
+	if c.Root == "" {
+		return "", fmt.Errorf("can't convert %q to a Windows path without a root directory", path)
+	}
+	return strings.TrimRight(c.Root, `\`) + strings.ReplaceAll(path, "/", `\`), nil
+}
+
+// pathFromWindows converts a Windows path to a POSIX path.
+func (c PathListConverter) pathFromWindows(path string) (string, error) {
+	if root := strings.TrimRight(c.Root, `\`); root != "" && len(path) >= len(root) &&
+		strings.EqualFold(path[:len(root)], root) && (len(path) == len(root) || path[len(root)] == '\\') {
+		return "/" + strings.TrimLeft(strings.ReplaceAll(path[len(root):], `\`, "/"), "/"), nil
+	}
+	if !hasDriveLetter(path) {
+		return strings.ReplaceAll(path, `\`, "/"), nil
+	}
+	prefix := c.drivePrefix()
+	converted := prefix + strings.ToLower(path[:1])
+	if rest := strings.TrimLeft(strings.ReplaceAll(path[2:], `\`, "/"), "/"); rest != "" {
+		converted += "/" + rest
+	}
+	return converted, nil
+}
+
+// drivePrefix returns DrivePrefix with one leading and trailing slash.
+func (c PathListConverter) drivePrefix() string {
+	if trimmed := strings.Trim(c.DrivePrefix, "/"); trimmed != "" {
+		return "/" + trimmed + "/"
+	}
+	return "/"
+}
@@ -0,0 +1,369 @@
+package patchenv
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+// Option customizes the behavior of PatchWith and Resolve.
+type Option func(*config)
+
+// config holds the settings that options apply to.
+type config struct {
+	// command is the command that is run to compute the new environment.
+	command string
+
+	// source loads the variables instead of the command, or is nil.
+	source Source
+
+	// sourceErr is the error opening the sources given to WithSourceURI.
+	sourceErr error
+
+	// fallbackCommand is run if the command or source fails.
+	fallbackCommand string
+
+	// fallback loads the variables instead of fallbackCommand if the
+	// command or source fails, or is nil.
+	fallback Source
+
+	// debug receives the debug trace, or is nil to use PATCH_ENV_DEBUG.
+	debug io.Writer
+
+	// trace writes the debug trace while PatchWith or Resolve runs, or is
+	// nil if tracing is disabled.
+	trace *tracer
+
+	// githubEnv enables exporting variables to GITHUB_ENV.
+	githubEnv bool
+
+	// windowsBroadcast enables announcing environment changes to other
+	// Windows programs.
+	windowsBroadcast bool
+
+	// windowsPersist enables saving variables in the Windows registry.
+	windowsPersist bool
+
+	// bestEffort makes command and source failures warnings.
+	bestEffort bool
+
+	// runner runs the command, or is nil to use DefaultRunner.
+	runner Runner
+
+	// parser parses the command's output, or is nil to use the default
+	// Parser.
+	parser *Parser
+
+	// invocation says why the command is being run.
+	invocation Invocation
+
+	// timeout is the maximum time the command may run, or zero for no limit.
+	timeout time.Duration
+
+	// ctx is the context the sources are loaded with, or nil to use
+	// context.Background.
+	ctx context.Context
+
+	// reportUnchanged enables Result.Unchanged.
+	reportUnchanged bool
+
+	// required are the names of variables that must be set after patching.
+	required []string
+
+	// schema declares the expected variables, or is nil.
+	schema *Schema
+
+	// approve decides whether PatchWith may apply its changes, or is nil
+	// to apply them without asking.
+	approve func(Changes) (bool, error)
+
+	// provenance records where the variables came from, for
+	// Result.Explain.
+	provenance provenance
+
+	// manifest enables recording the provenance in PATCH_ENV_MANIFEST.
+	manifest bool
+
+	// transforms rewrite the values of loaded variables.
+	transforms []transformRule
+
+	// disabled disables patching, because PATCH_ENV_DISABLE is set.
+	disabled bool
+
+	// disabledSources are the kinds of source listed in
+	// PATCH_ENV_DISABLE_SOURCES, by URI scheme.
+	disabledSources map[string]bool
+
+	// airGapped forbids sources that use the network.
+	airGapped bool
+
+	// sizeLimits restricts how much a source can produce.
+	sizeLimits SizeLimits
+
+	// duplicates says which definition of a variable a source defines
+	// more than once wins.
+	duplicates DuplicatePolicy
+
+	// panicPolicy says what happens when a hook panics.
+	panicPolicy PanicPolicy
+
+	// panics are the panics recovered from hooks, for Result.Panics.
+	panics []*PanicError
+}
+
+// newConfig returns the default configuration with opts applied.
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		command:         os.Getenv(patchCommandVar),
+		fallbackCommand: os.Getenv(fallbackCommandVar),
+		githubEnv:       envEnabled(githubExportVar),
+		disabled:        envEnabled(disableVar),
+		disabledSources: parseDisabledSources(os.Getenv(disableSourcesVar)),
+		airGapped:       envEnabled(airGappedVar),
+	}
+	if envEnabled(approveVar) {
+		cfg.approve = PromptApproval(os.Stdin, os.Stderr)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithCommand sets the command that is run instead of the one in the
+// PATCH_ENV_COMMAND environment variable.  An empty command disables
+// patching.
+func WithCommand(command string) Option {
+	return func(cfg *config) {
+		cfg.command = command
+	}
+}
+
+// WithSource makes PatchWith and Resolve load variables from src instead of
+// running a command.
+func WithSource(src Source) Option {
+	return func(cfg *config) {
+		cfg.source = src
+	}
+}
+
+// WithSourceURI makes PatchWith and Resolve load variables from the
+// Sources for uris, opened with OpenSource, instead of running a command.
+// If there's more than one, they're loaded in order, so later sources'
+// variables take precedence:
+//
+//	patchenv.WithSourceURI("file:///etc/myapp/defaults.env", "vault://secret/myapp")
+//
+// Sources whose schemes are listed in the PATCH_ENV_DISABLE_SOURCES
+// environment variable are skipped.
+func WithSourceURI(uris ...string) Option {
+	return func(cfg *config) {
+		srcs := make(multiSource, 0, len(uris))
+		for _, uri := range uris {
+			src, err := cfg.openEnabledSource(uri)
+			if err != nil {
+				cfg.sourceErr = err
+				return
+			}
+			if src != nil {
+				srcs = append(srcs, src)
+			}
+		}
+		if len(srcs) == 1 {
+			cfg.source = srcs[0]
+		} else {
+			cfg.source = srcs
+		}
+	}
+}
+
+// WithFallbackCommand sets the command that is run if the command or Source
+// fails, instead of the one in the PATCH_ENV_FALLBACK_COMMAND environment
+// variable.  When the fallback is used, the Result is marked Degraded.  An
+// empty command disables the fallback.
+func WithFallbackCommand(command string) Option {
+	return func(cfg *config) {
+		cfg.fallbackCommand = command
+	}
+}
+
+// WithFallback makes PatchWith and Resolve load variables from src if the
+// command or Source fails, for example from a cached copy of credentials
+// when the service that issues them is down.  When the fallback is used,
+// the Result is marked Degraded.
+func WithFallback(src Source) Option {
+	return func(cfg *config) {
+		cfg.fallback = src
+	}
+}
+
+// WithBestEffort makes PatchWith and Resolve log a warning and return
+// without an error if the command (and fallback, if any) fails, so the
+// program can continue with its unpatched environment.  The error is saved
+// in Result.IgnoredErr.  Validation failures from WithRequired and
+// WithSchema are still returned.
+func WithBestEffort() Option {
+	return func(cfg *config) {
+		cfg.bestEffort = true
+	}
+}
+
+// WithDebug writes a trace of what PatchWith and Resolve do to w: the shell
+// and arguments used to run the command, how long it took, how much output
+// it produced, and the names (but not the values) of the variables that
+// were parsed.  Without this option, the trace is enabled by setting the
+// PATCH_ENV_DEBUG environment variable to "1", and is written to stderr, or
+// appended to the file named by PATCH_ENV_DEBUG_FILE.
+func WithDebug(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.debug = w
+	}
+}
+
+// WithGitHubEnv makes PatchWith, when it's running in a GitHub Actions
+// step, also append the variables it sets to the file named by GITHUB_ENV,
+// so later steps of the workflow see them too.  The values of secret
+// variables are masked in the workflow log with ::add-mask:: commands.
+// Outside of GitHub Actions, this option has no effect.  Setting the
+// PATCH_ENV_GITHUB_ENV environment variable to "1" has the same effect.
+func WithGitHubEnv() Option {
+	return func(cfg *config) {
+		cfg.githubEnv = true
+	}
+}
+
+// WithWindowsBroadcast makes PatchWith, on Windows, broadcast the
+// WM_SETTINGCHANGE message after it updates the environment, the way the
+// System Properties dialog does.  On its own this only affects programs
+// that re-read the registry, so it's usually combined with
+// WithWindowsPersist.  On other platforms, this option has no effect.
+func WithWindowsBroadcast() Option {
+	return func(cfg *config) {
+		cfg.windowsBroadcast = true
+	}
+}
+
+// WithWindowsPersist makes PatchWith, on Windows, also save the variables it
+// sets and unsets in the user's environment in the registry
+// (HKEY_CURRENT_USER\Environment), and then broadcast WM_SETTINGCHANGE as
+// WithWindowsBroadcast does, so programs started from Explorer afterwards
+// see the new values.  Secret variables aren't saved, since the registry
+// isn't a safe place for them.  On other platforms, this option has no
+// effect.
+func WithWindowsPersist() Option {
+	return func(cfg *config) {
+		cfg.windowsPersist = true
+	}
+}
+
+// WithRunner makes PatchWith and Resolve run the command with r instead of
+// DefaultRunner.
+func WithRunner(r Runner) Option {
+	return func(cfg *config) {
+		cfg.runner = r
+	}
+}
+
+// WithParser makes PatchWith and Resolve parse the command's output with p
+// instead of the default Parser.
+func WithParser(p *Parser) Option {
+	return func(cfg *config) {
+		cfg.parser = p
+	}
+}
+
+// WithInvocation sets the value of PATCH_ENV_INVOCATION in the command's
+// environment.  Programs that refresh an already patched environment should
+// pass InvocationReload.
+func WithInvocation(invocation Invocation) Option {
+	return func(cfg *config) {
+		cfg.invocation = invocation
+	}
+}
+
+// WithTimeout limits how long the command (or Source) may run.  If the
+// command is still running after d, it is killed and PatchWith returns an
+// error.  A zero or negative duration means no limit, which is the default.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.timeout = d
+	}
+}
+
+// WithContext makes PatchWith and Resolve load the variables with ctx, so
+// canceling it stops the command (or Source), as when a server that
+// resolves the environment for a client shuts down.  The timeout set with
+// WithTimeout still applies.
+func WithContext(ctx context.Context) Option {
+	return func(cfg *config) {
+		cfg.ctx = ctx
+	}
+}
+
+// WithReportUnchanged makes PatchWith and Resolve list the variables whose
+// values are the same as the ones the process inherited in
+// Result.Unchanged.  This helps find configuration that is redundant with,
+// or shadowed by, the parent environment.
+func WithReportUnchanged() Option {
+	return func(cfg *config) {
+		cfg.reportUnchanged = true
+	}
+}
+
+// WithRequired makes PatchWith and Resolve return a *MissingError listing
+// each of the named variables that would be unset or empty after patching.
+// The environment isn't changed if any of them are missing.
+func WithRequired(names ...string) Option {
+	return func(cfg *config) {
+		cfg.required = append(cfg.required, names...)
+	}
+}
+
+// WithSchema makes PatchWith and Resolve apply the defaults declared by
+// schema and validate the resulting environment against it.  If the
+// environment doesn't satisfy the schema, a *ValidationError is returned
+// and the environment isn't changed.
+func WithSchema(schema *Schema) Option {
+	return func(cfg *config) {
+		cfg.schema = schema
+	}
+}
+
+// patchSource returns the Source that variables are loaded from, or nil if
+// there is nothing to load or patching is disabled.
+func (cfg *config) patchSource() Source {
+	if cfg.disabled {
+		return nil
+	}
+	if cfg.source != nil {
+		return cfg.enabled(cfg.source)
+	}
+	if cfg.command == "" {
+		return nil
+	}
+	return cfg.enabled(cfg.commandSource(cfg.command))
+}
+
+// fallbackSource returns the Source that variables are loaded from if the
+// primary source fails, or nil if there is no fallback.
+func (cfg *config) fallbackSource() Source {
+	if cfg.fallback != nil {
+		return cfg.enabled(cfg.fallback)
+	}
+	if cfg.fallbackCommand == "" {
+		return nil
+	}
+	return cfg.enabled(cfg.commandSource(cfg.fallbackCommand))
+}
+
+// commandSource returns a CommandSource that runs command using the
+// configured runner, parser, and invocation.
+func (cfg *config) commandSource(command string) *CommandSource {
+	return &CommandSource{
+		Command:    command,
+		Runner:     cfg.runner,
+		Parser:     cfg.parser,
+		Invocation: cfg.invocation,
+	}
+}
@@ -0,0 +1,85 @@
+package patchenv
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// PanicPolicy controls what PatchWith and Resolve do when code they call
+// back into panics: a Transform, or a Source, Runner, or payload format
+// that's loading variables.
+type PanicPolicy int
+
+const (
+	// PanicAbort recovers from the panic and returns a *PanicError, so a
+	// buggy hook can't crash the program.  It's the default.
+	PanicAbort PanicPolicy = iota
+
+	// PanicContinue recovers from the panic, logs a warning, and carries
+	// on as if the hook had made no change: a Transform leaves the value
+	// as it was.  A Source can't be skipped like that, so a panic while
+	// loading fails the load, and the fallback and WithBestEffort apply.
+	PanicContinue
+
+	// PanicCrash doesn't recover from the panic, so it crashes the program
+	// unless the caller recovers from it.
+	PanicCrash
+)
+
+// WithPanicPolicy sets what PatchWith and Resolve do when a hook panics.
+// Either way, unless the policy is PanicCrash, the panics are listed in
+// Result.Panics.
+func WithPanicPolicy(policy PanicPolicy) Option {
+	return func(cfg *config) {
+		cfg.panicPolicy = policy
+	}
+}
+
+// PanicError describes a panic that was recovered from a hook.
+type PanicError struct {
+	// Hook describes the code that panicked, like "transform of API_KEY".
+	Hook string
+
+	// Value is the value passed to panic.
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine when it panicked.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("patchenv: %s panicked: %v", e.Hook, e.Value)
+}
+
+// Unwrap returns the value passed to panic, if it's an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// guard calls fn, returning a *PanicError if it panics, unless the policy
+// is PanicCrash.  The panics are recorded for Result.Panics.
+func (cfg *config) guard(hook string, fn func() error) (err error) {
+	if cfg.panicPolicy == PanicCrash {
+		return fn()
+	}
+	defer func() {
+		if value := recover(); value != nil {
+			perr := &PanicError{Hook: hook, Value: value, Stack: debug.Stack()}
+			cfg.panics = append(cfg.panics, perr)
+			err = perr
+		}
+	}()
+	return fn()
+}
+
+// recoverCallback recovers from a panic in a callback that has nobody to
+// return an error to, like an event listener, and logs it.  It must be
+// deferred.
+func recoverCallback(callback string) {
+	if value := recover(); value != nil {
+		log.Printf("[WARNING] patchenv: %s panicked: %v\n%s", callback, value, debug.Stack())
+	}
+}
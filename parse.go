@@ -0,0 +1,395 @@
+package patchenv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// InvalidLinePolicy controls what a Parser does with lines that aren't in
+// the format "var=value".
+type InvalidLinePolicy int
+
+const (
+	// InvalidLineWarn logs a warning for each invalid line and skips it.
+	InvalidLineWarn InvalidLinePolicy = iota
+
+	// InvalidLineError makes Parse return an error for the first invalid
+	// line.
+	InvalidLineError
+
+	// InvalidLineIgnore silently skips invalid lines.
+	InvalidLineIgnore
+)
+
+// WhitespacePolicy controls what a Parser does with spaces and tabs around
+// the names and values in "var=value" lines.
+type WhitespacePolicy int
+
+const (
+	// WhitespaceTrimNames removes whitespace around names, so
+	// "VAR = value" sets VAR, but keeps values as they're written (here,
+	// " value").
+	WhitespaceTrimNames WhitespacePolicy = iota
+
+	// WhitespaceTrimAll removes whitespace around both names and values.
+	WhitespaceTrimAll
+
+	// WhitespacePreserve keeps names and values exactly as they're
+	// written, so "VAR = value" sets "VAR " to " value".
+	WhitespacePreserve
+)
+
+// blanks are the whitespace characters a WhitespacePolicy trims.
+const blanks = " \t"
+
+// Parser parses the "var=value" line protocol.  The zero value is ready to
+// use.
+type Parser struct {
+	// InvalidLines controls what happens to lines that aren't blank,
+	// aren't comments, and aren't in the format "var=value".
+	InvalidLines InvalidLinePolicy
+
+	// Whitespace controls whether spaces and tabs around names and values
+	// are removed.  By default, they're removed around names only.  A tab
+	// used as the Delimiter isn't removed.
+	Whitespace WhitespacePolicy
+
+	// Delimiter separates names from values, or is empty to use "=".
+	// Setting it to "\t" parses tab-separated output, and to "\x1f" (the
+	// ASCII unit separator) lets values contain any printable text.  Only
+	// the first delimiter on a line separates the name from the value.
+	Delimiter string
+
+	// KeepQuotes disables removing the quotes around values written as
+	// KEY="value" or KEY='value'.  By default, a value that's entirely
+	// enclosed in single quotes is used as it's written inside them, and
+	// one enclosed in double quotes can also contain the escapes \", \\,
+	// \$, \n, \r, \t, and \uXXXX (a UTF-16 code unit, so characters
+	// outside the Basic Multilingual Plane are written as surrogate pairs,
+	// as in JSON), so multi-line values fit on one line.  Other backslashes
+	// are kept.  Values with other quotes, like KEY="a" "b", are used as
+	// they're written.
+	KeepQuotes bool
+
+	// KeepCarriageReturns disables stripping carriage returns from the
+	// ends of lines, so a value can end with "\r".  By default, output
+	// with Windows line endings is parsed the same as output with Unix
+	// line endings.
+	KeepCarriageReturns bool
+
+	// KeepBOM disables removing a UTF-8 byte order mark from the start of
+	// the input.
+	KeepBOM bool
+
+	// Encoding names the character encoding of the input, which is
+	// converted to UTF-8 before it's parsed.  UTF-8 (the default), UTF-16,
+	// ISO-8859-1, and the common Windows OEM (cp437, cp850, cp852, cp866)
+	// and ANSI (windows-1250, windows-1251, windows-1252) code pages are
+	// supported.  Use Transcode for other encodings.
+	Encoding string
+
+	// Transcode, if not nil, returns a reader that converts the input to
+	// UTF-8, and is used instead of Encoding.  A golang.org/x/text
+	// encoding's decoder can be used:
+	//
+	//	parser.Transcode = japanese.ShiftJIS.NewDecoder().Reader
+	Transcode func(io.Reader) io.Reader
+
+	// FileDir is the directory that files in a JSON envelope are written
+	// to.  If it's empty, the default directory for temporary files is
+	// used.
+	FileDir string
+
+	// Format names the format of the input: "lines" for the "var=value"
+	// line protocol, "json" for a JSON envelope, "jsonl" for JSON Lines,
+	// or a format registered with RegisterFormat, like "yaml".  If it's
+	// empty, the format is detected, and the line protocol is assumed if
+	// it can't be.  A command's output can also be named with the
+	// PATCH_ENV_FORMAT environment variable.
+	Format string
+
+	// Separator joins the keys of nested maps in structured formats like
+	// YAML to make variable names, or is empty to use "_".
+	Separator string
+
+	// Arrays controls how arrays in structured formats are set.  By
+	// default, they're encoded as JSON.
+	Arrays ArrayPolicy
+
+	// MaxDepth limits how many levels of nested maps (and arrays, with
+	// ArraysIndexed) in structured formats are flattened into separate
+	// variables, or is zero for no limit.  Values nested more deeply are
+	// encoded as JSON: with a MaxDepth of 1, {"db": {"host": "h"}} sets
+	// DB to {"host":"h"}.
+	MaxDepth int
+
+	// PayloadSchema, if it's not nil, is the structure that structured
+	// payloads must have.  If a payload doesn't match it, Parse returns a
+	// *PayloadError and no variables.
+	PayloadSchema *PayloadSchema
+
+	// KeepNames disables upper-casing the names of variables from
+	// structured formats and replacing the characters in them other than
+	// letters, digits, and underscores with underscores.  By default, the
+	// key "host" nested in "db" (or the key "db.host") sets DB_HOST.
+	KeepNames bool
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark, which some Windows
+// programs write at the start of their output.
+const utf8BOM = "\uFEFF"
+
+// Parse reads lines in the format "var=value" from r with the default
+// Parser and returns the variables they define, in order.
+func Parse(r io.Reader) ([]Var, error) {
+	return (&Parser{}).Parse(r)
+}
+
+// Parse reads lines in the format "var=value" from r and returns the
+// variables they define, in order.  Blank lines and lines whose first
+// non-blank character is "#" are skipped.  Other lines that aren't in the
+// expected format are handled according to p.InvalidLines.
+//
+// If the input starts with "{", it's decoded as a JSON envelope (payload
+// protocol version 2) instead, which can also unset variables, mark them as
+// secret or expiring, and write files.  Parse returns ErrNoChanges if the
+// envelope says there's nothing to change.  If the first object describes a
+// variable, with a "name" but no "version", the input is decoded as JSON
+// Lines instead, one such object per line.  Input in a format registered
+// with RegisterFormat, like YAML, is detected the same way, or p.Format can
+// name the format of the input.
+func (p *Parser) Parse(r io.Reader) ([]Var, error) {
+	if p.Transcode != nil {
+		r = p.Transcode(r)
+	} else {
+		var err error
+		if r, err = transcode(r, p.Encoding); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read variables: %w", err)
+	}
+	start := bytes.TrimLeft(bytes.TrimPrefix(data, []byte(utf8BOM)), " \t\r\n")
+	switch strings.ToLower(p.Format) {
+	case "":
+		if isJSONLines(start) {
+			return p.parseJSONLines(bytes.NewReader(start))
+		}
+		if isEnvelope(start) {
+			return p.parseEnvelope(bytes.NewReader(start))
+		}
+		// Output in the line protocol with another delimiter, like
+		// "KEY: value", could be mistaken for a structured format.
+		if format, ok := detectFormat(start); ok && (p.Delimiter == "" || p.Delimiter == "=") {
+			return p.parseFormat(format, start)
+		}
+		return p.parseLines(data)
+	case "lines":
+		return p.parseLines(data)
+	case "json":
+		return p.parseEnvelope(bytes.NewReader(start))
+	case "jsonl":
+		return p.parseJSONLines(bytes.NewReader(start))
+	}
+	format, err := lookupFormat(p.Format)
+	if err != nil {
+		return nil, err
+	}
+	return p.parseFormat(format, start)
+}
+
+// parseLines parses the "var=value" line protocol from data.  The input is
+// converted to a string once, and the names and values are slices of it,
+// so large payloads don't cost allocations for each line.
+func (p *Parser) parseLines(data []byte) ([]Var, error) {
+	text := string(data)
+	vars := make([]Var, 0, strings.Count(text, "\n")+1)
+
+	delimiter := p.Delimiter
+	if delimiter == "" {
+		delimiter = "="
+	}
+	lineNum := 0
+	for offset := 0; offset < len(text); {
+		lineNum++
+		line := text[offset:]
+		next := len(text)
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line, next = line[:i], offset+i+1
+		}
+		lineOffset := int64(offset)
+		offset = next
+
+		if lineNum == 1 && !p.KeepBOM {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		if !p.KeepCarriageReturns {
+			line = strings.TrimRight(line, "\r")
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		name, value, ok := line, "", false
+		if i := strings.Index(line, delimiter); i >= 0 {
+			name, value, ok = line[:i], line[i+len(delimiter):], true
+		}
+		if ok && p.Whitespace != WhitespacePreserve {
+			name = strings.Trim(name, blanks)
+			if p.Whitespace == WhitespaceTrimAll {
+				value = strings.Trim(value, blanks)
+			}
+		}
+		var when *condition
+		if ok {
+			value, when = cutCondition(value)
+		}
+		if !ok || name == "" {
+			lineErr := &LineError{Line: lineNum, Offset: lineOffset, Text: line}
+			switch p.InvalidLines {
+			case InvalidLineError:
+				return vars, lineErr
+			case InvalidLineIgnore:
+			default:
+				log.Printf("[WARNING] %s", lineErr)
+			}
+			continue
+		}
+		if ok, err := when.matches(); err != nil {
+			return vars, err
+		} else if !ok {
+			continue
+		}
+		if !p.KeepQuotes {
+			if unquoted, ok := unquote(value); ok {
+				value = unquoted
+			}
+		}
+		vars = append(vars, Var{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// escapes maps the characters that can follow a backslash inside double
+// quotes, other than "u", to the characters they stand for.
+var escapes = map[byte]byte{'"': '"', '\\': '\\', '$': '$', 'n': '\n', 'r': '\r', 't': '\t'}
+
+// unquote returns the content of s if it's entirely enclosed in single or
+// double quotes, ignoring whitespace around them, resolving the escapes
+// allowed inside double quotes.
+func unquote(s string) (string, bool) {
+	t := strings.Trim(s, blanks)
+	if len(t) < 2 {
+		return s, false
+	}
+	switch t[0] {
+	case '\'':
+		inner := t[1 : len(t)-1]
+		if t[len(t)-1] == '\'' && !strings.Contains(inner, "'") {
+			return inner, true
+		}
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(t); i++ {
+			switch c := t[i]; {
+			case c == '\\' && i+1 < len(t) && t[i+1] == 'u':
+				r, n := unicodeEscape(t[i:])
+				if n == 0 {
+					b.WriteByte(c)
+					continue
+				}
+				b.WriteRune(r)
+				i += n - 1
+			case c == '\\' && i+1 < len(t) && escapes[t[i+1]] != 0:
+				i++
+				b.WriteByte(escapes[t[i]])
+			case c == '"':
+				if i == len(t)-1 {
+					return b.String(), true
+				}
+				return s, false
+			default:
+				b.WriteByte(c)
+			}
+		}
+	}
+	return s, false
+}
+
+// unicodeEscape decodes the \uXXXX escape (or surrogate pair of escapes)
+// at the start of s, returning the character and the length of the
+// escape, or a length of zero if s doesn't start with a valid escape.  An
+// unpaired surrogate decodes to U+FFFD.
+func unicodeEscape(s string) (rune, int) {
+	r, ok := hex4(s)
+	if !ok {
+		return 0, 0
+	}
+	if utf16.IsSurrogate(r) {
+		if r2, ok := hex4(s[6:]); ok {
+			if pair := utf16.DecodeRune(r, r2); pair != utf8.RuneError {
+				return pair, 12
+			}
+		}
+		return utf8.RuneError, 6
+	}
+	return r, 6
+}
+
+// hex4 decodes the \uXXXX escape at the start of s.
+func hex4(s string) (rune, bool) {
+	if len(s) < 6 || s[0] != '\\' || s[1] != 'u' {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[2:6], 16, 16)
+	return rune(n), err == nil
+}
+
+// maxPreview is the maximum number of bytes of an invalid line that a
+// LineError's message includes.
+const maxPreview = 60
+
+// LineError describes a line that isn't in the format "var=value".
+type LineError struct {
+	// Line is the line's number, starting at 1.
+	Line int
+
+	// Offset is the byte offset of the start of the line in the input
+	// (after it was converted to UTF-8).
+	Offset int64
+
+	// Text is the line's text.
+	Text string
+}
+
+// Error implements the error interface.  The message includes a quoted
+// preview of the line's text, truncated if it's long.
+func (e *LineError) Error() string {
+	preview := e.Text
+	truncated := false
+	if len(preview) > maxPreview {
+		cut := maxPreview
+		for cut > 0 && !utf8.RuneStart(preview[cut]) {
+			cut--
+		}
+		preview, truncated = preview[:cut], true
+	}
+
+	msg := fmt.Sprintf("patchenv: invalid output line %d (byte offset %d): %s",
+		e.Line, e.Offset, strconv.Quote(preview))
+	if truncated {
+		msg += fmt.Sprintf(" (truncated, %d bytes total)", len(e.Text))
+	}
+	return msg
+}
@@ -0,0 +1,83 @@
+package patchenv
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// benchmarkVars is the number of variables in the benchmark payloads, as
+// many as a large configuration dump would have.
+const benchmarkVars = 50000
+
+// benchmarkLines returns a payload in the line protocol, with comments,
+// blank lines, and quoted values mixed in.
+func benchmarkLines() []byte {
+	var b bytes.Buffer
+	for i := 0; i < benchmarkVars; i++ {
+		switch i % 10 {
+		case 0:
+			fmt.Fprintf(&b, "# section %d\n\n", i)
+		case 1:
+			fmt.Fprintf(&b, "QUOTED_%d=\"line one\\nline two %d\"\n", i, i)
+		}
+		fmt.Fprintf(&b, "VAR_%d=value-%d-abcdefghijklmnopqrstuvwxyz\n", i, i)
+	}
+	return b.Bytes()
+}
+
+// benchmarkEnvelope returns a JSON envelope with a list of variables.
+func benchmarkEnvelope() []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"version": 2, "vars": [`)
+	for i := 0; i < benchmarkVars; i++ {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		fmt.Fprintf(&b, `{"name": "VAR_%d", "value": "value-%d-abcdefghijklmnopqrstuvwxyz", "secret": %t}`,
+			i, i, i%10 == 0)
+	}
+	b.WriteString("]}\n")
+	return b.Bytes()
+}
+
+// benchmarkJSONLines returns a JSON Lines payload, one variable per line.
+func benchmarkJSONLines() []byte {
+	var b bytes.Buffer
+	for i := 0; i < benchmarkVars; i++ {
+		fmt.Fprintf(&b, `{"name": "VAR_%d", "value": "value-%d-abcdefghijklmnopqrstuvwxyz"}`+"\n", i, i)
+	}
+	return b.Bytes()
+}
+
+// benchmarkParse parses payload with p b.N times.
+func benchmarkParse(b *testing.B, p *Parser, payload []byte) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vars, err := p.Parse(bytes.NewReader(payload))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(vars) < benchmarkVars {
+			b.Fatalf("parsed %d variables, want at least %d", len(vars), benchmarkVars)
+		}
+	}
+}
+
+func BenchmarkParseLines(b *testing.B) {
+	benchmarkParse(b, &Parser{}, benchmarkLines())
+}
+
+func BenchmarkParseLinesKeepQuotes(b *testing.B) {
+	benchmarkParse(b, &Parser{KeepQuotes: true}, benchmarkLines())
+}
+
+func BenchmarkParseEnvelope(b *testing.B) {
+	benchmarkParse(b, &Parser{}, benchmarkEnvelope())
+}
+
+func BenchmarkParseJSONLines(b *testing.B) {
+	benchmarkParse(b, &Parser{}, benchmarkJSONLines())
+}
@@ -1,13 +1,13 @@
 package patchenv
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
-	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // patchCommandVar is the environment variable used by Patch that, when set,
@@ -15,9 +15,9 @@ import (
 // to set in the running process.
 const patchCommandVar = "PATCH_ENV_COMMAND"
 
-// shellVar is the name of the environment variable that indicates the user's
-// configured shell.
-const shellVar = "SHELL"
+// fallbackCommandVar is the environment variable that, when set, contains
+// the command that is run if the PATCH_ENV_COMMAND command fails.
+const fallbackCommandVar = "PATCH_ENV_FALLBACK_COMMAND"
 
 // Patch checks if the PATCH_ENV_COMMAND environment variable is set, and if it
 // is, runs it with the current shell (indicated by the SHELL environment
@@ -26,77 +26,293 @@ const shellVar = "SHELL"
 // the command could not be run or exits with an error status.
 //
 // If the command returns an error status, the command's stdout and stderr
-// are written to os.Stdout and os.Stderr respectively to help the user
-// diagnose the problem.  Otherwise, the command's stderr is discarded and
-// the command's stdout is parsed for the environment variables to set in
-// the running process.
+// are written to os.Stdout (or the writer set with SetFailureOutput) and
+// os.Stderr respectively to help the user diagnose the problem.  Otherwise,
+// the command's stderr is discarded and the command's stdout is parsed for
+// the environment variables to set in the running process.
+//
+// If PATCH_ENV_COMMAND fails and the PATCH_ENV_FALLBACK_COMMAND
+// environment variable is set, that command is run instead.
 //
 // If PATCH_ENV_COMMAND is not set, the command does nothing.
 //
+// If the PATCH_ENV_DISABLE environment variable is set to "1", Patch logs a
+// warning and does nothing, so operators can bypass patching without
+// changing the program's configuration.  PATCH_ENV_DISABLE_SOURCES disables
+// only the kinds of source it lists by URI scheme, separated by commas, like
+// "cmd,vault"; "url" stands for "http" and "https".  Sources given with
+// WithSource are disabled by the kind they report as a Kinded.
+//
 // On Windows, where SHELL is not commonly set, PATCH_ENV_COMMAND is passed
 // to exec.Command() directly.
 func Patch() error {
-	cmdString := os.Getenv(patchCommandVar)
-	if cmdString == "" {
-		return nil
+	_, err := PatchWith()
+	return err
+}
+
+// MustPatch is like Patch but panics if the environment could not be
+// patched.  It is intended for small programs where a failure to patch the
+// environment should stop the program before it does anything else.
+func MustPatch() {
+	if err := Patch(); err != nil {
+		panic(err)
 	}
+}
 
-	return patchFromCommand(cmdString)
+// PatchWith is like Patch but accepts options that customize its behavior.
+// It returns a Result describing the variables that were set.  If there is
+// no command to run (and no Schema with defaults to apply), PatchWith does
+// nothing and returns an empty Result.
+func PatchWith(opts ...Option) (*Result, error) {
+	result, err := patchWith(opts)
+	count(&statPatches, &statPatchFailures, err)
+	return result, err
 }
 
-// patchFromCommand runs the specified command string in the shell (if
-// possible) and updates the running process's environment from its output.
-func patchFromCommand(cmdString string) error {
-	outBuf, err := runWithShell(cmdString)
+// patchWith implements PatchWith.
+func patchWith(opts []Option) (*Result, error) {
+	if err := checkSealed(); err != nil {
+		return &Result{}, err
+	}
+	cfg := newConfig(opts)
+	defer cfg.startTrace()()
+
+	resolved, err := cfg.resolve()
 	if err != nil {
-		return err
+		return resolved, err
 	}
-	scanner := bufio.NewScanner(outBuf)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 || parts[0] == "" {
-			log.Printf("[WARNING] patchenv: invalid output line: %s", line)
+	if err := cfg.approveChanges(resolved.Vars); err != nil {
+		cfg.trace.printf("%s", err)
+		removeFiles(resolved.Vars)
+		return resolved, err
+	}
+
+	result := *resolved
+	result.Vars = nil
+	for _, v := range resolved.Vars {
+		if v.Unset {
+			err = os.Unsetenv(v.Name)
+		} else {
+			err = os.Setenv(v.Name, v.Value)
+		}
+		if err != nil {
+			log.Printf("[WARNING] patchenv: can't update %s in the environment: %s",
+				v.Name, err)
 			continue
 		}
+		result.Vars = append(result.Vars, v)
+	}
+	cfg.trace.printf("updated %d variables in the environment", len(result.Vars))
+	// The files of File variables that a later definition replaced, or that
+	// couldn't be set, are no longer used.
+	dropFiles(resolved.Vars, result.finalVars())
+	recordLedger(result.Vars)
+	atomic.AddUint64(&statVarsApplied, uint64(len(result.Vars)))
+	emit(EventApplied, func(e *Event) {
+		e.Result = &result
+	})
+	atomic.StoreInt32(&patched, 1)
+	warnEarlyReads(result.Vars)
+	recordValidity(&result)
 
-		err := os.Setenv(parts[0], parts[1])
-		if err != nil {
-			log.Printf("[WARNING] patchenv: os.Setenv(%q, %q) returned error: %s",
-				parts[0], parts[1], err)
+	if cfg.manifest {
+		if err := updateManifest(&result, time.Now()); err != nil {
+			return &result, err
 		}
+		cfg.trace.printf("recorded the variables' sources in %s", manifestVar)
 	}
-	return nil
+
+	if cfg.githubEnv && inGitHubActions() {
+		if err := exportToGitHub(result.Vars); err != nil {
+			return &result, err
+		}
+		cfg.trace.printf("exported %d variables to %s", len(result.Vars), githubEnvVar)
+	}
+	if (cfg.windowsBroadcast || cfg.windowsPersist) && windowsEnvSupported {
+		if err := notifyWindows(result.Vars, cfg.windowsPersist); err != nil {
+			return &result, err
+		}
+		cfg.trace.printf("announced the environment change to other programs")
+	}
+	return &result, nil
+}
+
+// Resolve runs the command like PatchWith but doesn't change the running
+// process's environment.  The returned Result holds the variables that
+// PatchWith would set.  The files written for File variables are left for
+// the caller to use, and are removed by Scrub.
+func Resolve(opts ...Option) (*Result, error) {
+	cfg := newConfig(opts)
+	defer cfg.startTrace()()
+	result, err := cfg.resolve()
+	if err == nil {
+		recordFiles(result.Vars)
+	}
+	return result, err
 }
 
-// runWithShell runs the specified command with the user's shell, as indicated
-// by the SHELL environment variable.  The shell program is assumed to accept
-// the POSIX "-c" command-line option.  If SHELL isn't set, the command string
-// is passed as the first argument to exec.Command (on Windows SHELL usually
-// isn't set, but programs parse their own command-line arguments, so this is
-// the expected behavior there).
-func runWithShell(cmdString string) (*bytes.Buffer, error) {
-	var cmd *exec.Cmd
-
-	shell := os.Getenv(shellVar)
-	if shell == "" {
-		cmd = exec.Command(cmdString)
+// resolve computes the Result for PatchWith and Resolve, announcing it with
+// events.  If it fails, the files written for File variables are removed.
+func (cfg *config) resolve() (*Result, error) {
+	emit(EventResolveStarted, nil)
+	result, err := cfg.resolveResult()
+	if err != nil {
+		removeFiles(result.Vars)
+	}
+	result.Panics = cfg.panics
+	emit(EventResolveFinished, func(e *Event) {
+		e.Result, e.Err = result, err
+	})
+	return result, err
+}
+
+// resolveResult implements resolve.
+func (cfg *config) resolveResult() (*Result, error) {
+	result := &Result{provenance: &cfg.provenance}
+	if cfg.sourceErr != nil {
+		return result, cfg.sourceErr
+	}
+	if cfg.source == nil {
+		result.Command = cfg.command
+	}
+	if src := cfg.patchSource(); src != nil {
+		vars, merged, err := cfg.resolveSource(src)
+		if err != nil && !errors.Is(err, ErrNoChanges) {
+			if fallback := cfg.fallbackSource(); fallback != nil {
+				log.Printf("[WARNING] patchenv: using fallback: %s", err)
+				result.Degraded = true
+				result.PrimaryErr = err
+				vars, merged, err = cfg.resolveSource(fallback)
+				if err != nil && !errors.Is(err, ErrNoChanges) {
+					err = fmt.Errorf("patchenv: fallback failed: %w (after: %s)",
+						err, result.PrimaryErr)
+				}
+			}
+		}
+		if errors.Is(err, ErrNoChanges) {
+			cfg.trace.printf("source reported no changes")
+			result.NoChanges = true
+			vars, err = nil, nil
+		}
+		if err != nil && cfg.bestEffort {
+			log.Printf("[WARNING] patchenv: continuing without patching: command=%q error=%q",
+				result.Command, err.Error())
+			result.IgnoredErr = err
+			vars, err = nil, nil
+		}
+		if err != nil {
+			cfg.trace.printf("failed: %s", err)
+			return result, err
+		}
+		loaded := vars
+		if vars, err = cfg.applyTransforms(vars); err != nil {
+			cfg.trace.printf("%s", err)
+			removeFiles(loaded)
+			return result, err
+		}
+		result.Vars, result.Scheduled = cfg.applyValidity(vars, time.Now())
+		dropFiles(loaded, result.Vars)
+		result.Conflicts = merged
+		if cfg.reportUnchanged {
+			result.Unchanged = unchangedNames(result.Vars)
+		}
+	} else if cfg.disabled {
+		log.Printf("[WARNING] patchenv: patching is disabled by %s", disableVar)
 	} else {
-		cmd = exec.Command(shell, "-c", cmdString)
+		cfg.trace.printf("no command to run (%s is not set)", patchCommandVar)
 	}
 
-	outBuf := new(bytes.Buffer)
-	errBuf := new(bytes.Buffer)
-	cmd.Stdout = outBuf
-	cmd.Stderr = errBuf
+	if cfg.schema != nil {
+		loaded := len(result.Vars)
+		err := cfg.schema.apply(result)
+		cfg.recordDefaults(result.Vars[loaded:])
+		if err != nil {
+			cfg.trace.printf("schema validation failed: %s", err)
+			return result, err
+		}
+	}
+	if err := checkRequired(cfg.required, result.lookup); err != nil {
+		cfg.trace.printf("%s", err)
+		return result, err
+	}
+	return result, nil
+}
+
+// resolveSource loads the variables from src, subject to the configured
+// timeout, and reports the variables that were defined more than once.
+func (cfg *config) resolveSource(src Source) ([]Var, []Conflict, error) {
+	if err := cfg.checkAirGapped(src); err != nil {
+		return nil, nil, err
+	}
+	ctx := cfg.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = withAirGapped(withTracer(ctx, cfg.trace), cfg.airGapped)
+	ctx = withSizeLimits(ctx, cfg.sizeLimits)
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
 
-	err := cmd.Run()
+	if cs, ok := src.(*CommandSource); ok {
+		cfg.trace.printf("running command %q", cs.Command)
+	} else {
+		cfg.trace.printf("loading from source %T", src)
+	}
+	start := time.Now()
+	var layers []layer
+	err := cfg.guard("loading from "+describeSource(src), func() error {
+		var err error
+		layers, err = loadLayers(ctx, src)
+		return err
+	})
+	if errors.Is(err, ErrNoChanges) {
+		count(&statLoads, &statLoadFailures, nil)
+	} else {
+		count(&statLoads, &statLoadFailures, err)
+	}
+	atomic.AddInt64(&statLoadNanos, int64(time.Since(start)))
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("patchenv: timed out after %s: %w", cfg.timeout, err)
+	}
 	if err != nil {
-		_, _ = os.Stdout.Write(outBuf.Bytes())
-		_, _ = os.Stderr.Write(errBuf.Bytes())
-		return nil, fmt.Errorf("patchenv command %q failed: %q",
-			cmdString, err.Error())
+		removeFiles(flatten(layers))
+		return nil, nil, err
+	}
+	vars := flatten(layers)
+	if err := cfg.sizeLimits.check(vars); err != nil {
+		removeFiles(vars)
+		return nil, nil, err
 	}
+	cfg.trace.printf("loaded %d variables in %s: %s",
+		len(vars), time.Since(start).Round(time.Microsecond), describeVars(vars))
+	merged := conflicts(layers, cfg.duplicates)
+	for _, c := range merged {
+		cfg.trace.printf("%s from %s overrides %s: %s", c.Name, c.Winner, c.Losers, c.Rule)
+	}
+	if err := applyDuplicatePolicy(layers, cfg.duplicates); err != nil {
+		removeFiles(vars)
+		return nil, nil, err
+	}
+	cfg.recordSources(layers)
+	kept := flatten(layers)
+	dropFiles(vars, kept)
+	return kept, merged, nil
+}
 
-	return outBuf, nil
+// unchangedNames returns the names of the variables in vars whose values
+// are the same as the ones already in the environment.
+func unchangedNames(vars []Var) []string {
+	var names []string
+	for _, v := range vars {
+		if v.Unset {
+			continue
+		}
+		if value, ok := os.LookupEnv(v.Name); ok && value == v.Value {
+			names = append(names, v.Name)
+		}
+	}
+	return names
 }
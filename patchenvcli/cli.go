@@ -0,0 +1,32 @@
+// Package patchenvcli patches the environment before a urfave/cli app runs
+// its commands.
+//
+// Set the app's Before hook to the function returned by Before:
+//
+//	app := &cli.App{
+//		Name:   "mytool",
+//		Before: patchenvcli.Before(),
+//	}
+package patchenvcli
+
+import (
+	"github.com/arpio/patchenv"
+	"github.com/urfave/cli/v2"
+)
+
+// exitCode is the status the app exits with when the environment can't be
+// patched.
+const exitCode = 1
+
+// Before returns a cli.BeforeFunc that patches the environment using
+// patchenv.PatchWith() with opts.  If the environment can't be patched, the
+// returned function returns the error wrapped with cli.Exit so the app
+// prints it and exits with a non-zero status.
+func Before(opts ...patchenv.Option) cli.BeforeFunc {
+	return func(*cli.Context) error {
+		if _, err := patchenv.PatchWith(opts...); err != nil {
+			return cli.Exit(err.Error(), exitCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+// Package patchenvcobra patches the environment before a cobra command runs.
+//
+// Call Install on the root command:
+//
+//	rootCmd := &cobra.Command{Use: "mytool"}
+//	patchenvcobra.Install(rootCmd)
+//
+// Install adds two persistent flags to the command: --no-patch-env, which
+// skips patching, and --patch-env-timeout, which limits how long the patch
+// command may run.
+package patchenvcobra
+
+import (
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// noPatchFlag is the name of the flag that disables patching.
+	noPatchFlag = "no-patch-env"
+
+	// timeoutFlag is the name of the flag that limits how long the patch
+	// command may run.
+	timeoutFlag = "patch-env-timeout"
+)
+
+// Install adds the --no-patch-env and --patch-env-timeout persistent flags
+// to cmd and sets cmd's PersistentPreRunE to patch the environment using
+// patchenv.PatchWith() with opts before cmd or any of its subcommands run.
+// An existing PersistentPreRunE or PersistentPreRun on cmd is still called
+// after the environment has been patched.
+//
+// Cobra only runs the nearest PersistentPreRunE, so a subcommand that sets
+// its own hook prevents the environment from being patched for that
+// subcommand unless cobra.EnableTraverseRunHooks is set.
+func Install(cmd *cobra.Command, opts ...patchenv.Option) {
+	var noPatch bool
+	var timeout time.Duration
+	flags := cmd.PersistentFlags()
+	flags.BoolVar(&noPatch, noPatchFlag, false,
+		"don't patch the environment using PATCH_ENV_COMMAND")
+	flags.DurationVar(&timeout, timeoutFlag, 0,
+		"maximum time PATCH_ENV_COMMAND may run (0 means no limit)")
+
+	preRunE := cmd.PersistentPreRunE
+	preRun := cmd.PersistentPreRun
+	cmd.PersistentPreRun = nil
+	cmd.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+		if !noPatch {
+			patchOpts := opts
+			if timeout > 0 {
+				patchOpts = append(patchOpts[:len(patchOpts):len(patchOpts)],
+					patchenv.WithTimeout(timeout))
+			}
+			if _, err := patchenv.PatchWith(patchOpts...); err != nil {
+				return err
+			}
+		}
+
+		if preRunE != nil {
+			return preRunE(c, args)
+		}
+		if preRun != nil {
+			preRun(c, args)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/arpio/patchenv/patchenvcobra
+
+go 1.15
+
+require (
+	github.com/arpio/patchenv v1.0.0
+	github.com/spf13/cobra v1.10.2
+)
+
+replace github.com/arpio/patchenv => ../
@@ -0,0 +1,168 @@
+// Package patchenvfsnotify watches patchenv's file sources with fsnotify, so
+// long-running services pick up edits to a dotenv or JSON file without a
+// restart.
+//
+// FileSource is a patchenv.Watcher, so a patchenv.Refresher applies the file
+// again as soon as it changes.  Watch sets that up and reports each change:
+//
+//	err := patchenvfsnotify.Watch(ctx, "/etc/myapp/env", func(result *patchenv.Result, err error) {
+//		if err != nil {
+//			log.Printf("can't reload environment: %s", err)
+//			return
+//		}
+//		log.Printf("reloaded %d variables", len(result.Vars))
+//	})
+package patchenvfsnotify
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultDebounce is how long the file must be quiet before a change is
+// reported, if FileSource.Debounce is zero.
+const defaultDebounce = 100 * time.Millisecond
+
+// configMapDataLink is the link in a mounted Kubernetes ConfigMap or Secret
+// volume that points to the current version of its files.
+const configMapDataLink = "..data"
+
+// FileSource is a patchenv.Source like patchenv.FileSource whose Wait
+// method returns when the file changes.  It watches the file's directory,
+// so it sees the file being replaced by an editor or by a Kubernetes
+// ConfigMap update, as well as being written in place.  Call Close when it's
+// no longer needed to stop watching.
+type FileSource struct {
+	// Path is the path of the file.
+	Path string
+
+	// Parser parses the file, or is nil to use the default Parser.
+	Parser *patchenv.Parser
+
+	// Debounce is how long the file must go without changing before a
+	// change is reported, so a write in several steps is reported once.
+	// If it's zero, 100ms is used.
+	Debounce time.Duration
+
+	mu      sync.Mutex
+	watcher *fsnotify.Watcher
+}
+
+// Load implements the patchenv.Source interface.  It starts watching the
+// file before reading it, so changes made after Load aren't missed.
+func (s *FileSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	if _, err := s.watch(); err != nil {
+		return nil, err
+	}
+	return (&patchenv.FileSource{Path: s.Path, Parser: s.Parser}).Load(ctx)
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "file", like
+// the patchenv.FileSource it reads the file with.
+func (s *FileSource) Kind() string {
+	return "file"
+}
+
+// Wait implements the patchenv.Watcher interface.
+func (s *FileSource) Wait(ctx context.Context) error {
+	w, err := s.watch()
+	if err != nil {
+		return err
+	}
+	name := filepath.Clean(s.Path)
+	debounce := s.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+
+	// quiet is nil until the file changes, and then fires after the file
+	// has been quiet for the debounce time.
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-w.Events:
+			if !ok {
+				return fmt.Errorf("patchenv: stopped watching %s", s.Path)
+			}
+			if s.affects(event, name) {
+				quiet = time.After(debounce)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return fmt.Errorf("patchenv: stopped watching %s", s.Path)
+			}
+			return fmt.Errorf("patchenv: can't watch %s: %w", s.Path, err)
+		case <-quiet:
+			return nil
+		}
+	}
+}
+
+// affects reports whether event may have changed the file with the
+// cleaned path name.  Kubernetes updates a mounted ConfigMap by replacing
+// the "..data" link that the files' links point through, so a change to
+// that link counts too.
+func (s *FileSource) affects(event fsnotify.Event, name string) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) {
+		return false
+	}
+	cleaned := filepath.Clean(event.Name)
+	return cleaned == name || cleaned == filepath.Join(filepath.Dir(name), configMapDataLink)
+}
+
+// Close stops watching the file.
+func (s *FileSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+	s.watcher = nil
+	return err
+}
+
+// watch returns the watcher of the file's directory, starting it if
+// needed.
+func (s *FileSource) watch() (*fsnotify.Watcher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watcher != nil {
+		return s.watcher, nil
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't watch %s: %w", s.Path, err)
+	}
+	if err := w.Add(filepath.Dir(s.Path)); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("patchenv: can't watch %s: %w", s.Path, err)
+	}
+	s.watcher = w
+	return w, nil
+}
+
+// Watch patches the environment from the file at path, and then patches
+// it again each time the file changes until ctx is done, calling onChange
+// with the Result and error of each change.  opts are passed to
+// patchenv.PatchWith along with the file source.  Watch returns an error
+// if the file can't be applied at first, and ctx.Err() when ctx is done.
+func Watch(ctx context.Context, path string, onChange func(*patchenv.Result, error), opts ...patchenv.Option) error {
+	src := &FileSource{Path: path}
+	defer src.Close()
+	opts = append(opts, patchenv.WithSource(src))
+	if _, err := patchenv.PatchWith(opts...); err != nil {
+		return err
+	}
+	r := patchenv.NewRefresher(0, opts...)
+	r.OnRefresh = onChange
+	return r.Run(ctx)
+}
@@ -0,0 +1,125 @@
+// Package patchenvgrpc consumes environments from a central gRPC service
+// that implements the EnvService defined in proto/patchenv/v1/patchenv.proto.
+//
+// Source is a patchenv.Source that calls the service's Resolve method:
+//
+//	conn, err := grpc.NewClient("env.internal:443", grpc.WithTransportCredentials(creds))
+//	...
+//	patchenv.PatchWith(patchenv.WithSource(&patchenvgrpc.Source{
+//		Conn:   conn,
+//		Labels: map[string]string{"app": "billing", "env": "prod"},
+//	}))
+//
+// NewServer serves any patchenv.Source as an EnvService, which is a starting
+// point for implementing the service.
+package patchenvgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/patchenvgrpc/patchenvpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Source is a patchenv.Source that loads the variables from an
+// EnvService.
+type Source struct {
+	// Conn is the connection to the service.
+	Conn grpc.ClientConnInterface
+
+	// Labels are passed to the service to select the environment.
+	Labels map[string]string
+
+	// Invocation says why the environment is being patched.  If it's
+	// empty, patchenv.InvocationStartup is used.
+	Invocation patchenv.Invocation
+
+	// CallOptions are passed to each call, for example to attach
+	// per-call credentials.
+	CallOptions []grpc.CallOption
+}
+
+// Load implements the patchenv.Source interface.  It returns
+// patchenv.ErrNoChanges if the service reports that there's nothing to
+// change.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	invocation := s.Invocation
+	if invocation == "" {
+		invocation = patchenv.InvocationStartup
+	}
+	payload, err := patchenvpb.NewEnvServiceClient(s.Conn).Resolve(ctx, &patchenvpb.ResolveRequest{
+		Invocation: string(invocation),
+		Platform:   runtime.GOOS + "/" + runtime.GOARCH,
+		Labels:     s.Labels,
+	}, s.CallOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: environment service failed: %w", err)
+	}
+	if payload.GetNoChanges() {
+		return nil, patchenv.ErrNoChanges
+	}
+
+	vars := make([]patchenv.Var, 0, len(payload.GetVars()))
+	for _, v := range payload.GetVars() {
+		if v.GetName() == "" {
+			return nil, errors.New("patchenv: environment service returned a variable without a name")
+		}
+		pv := patchenv.Var{Name: v.GetName(), Value: v.GetValue(), Unset: v.GetUnset(), Secret: v.GetSecret()}
+		if v.GetExpires() != nil {
+			pv.Expires = v.GetExpires().AsTime()
+		}
+		vars = append(vars, pv)
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "grpc".
+func (s *Source) Kind() string {
+	return "grpc"
+}
+
+// NewServer returns an EnvService implementation that answers every
+// request with the variables from src, ignoring its labels.  Register it
+// with patchenvpb.RegisterEnvServiceServer.
+func NewServer(src patchenv.Source) patchenvpb.EnvServiceServer {
+	return &server{src: src}
+}
+
+// server is the EnvService returned by NewServer.
+type server struct {
+	patchenvpb.UnimplementedEnvServiceServer
+	src patchenv.Source
+}
+
+// Resolve implements the EnvService's Resolve method.
+func (s *server) Resolve(ctx context.Context, req *patchenvpb.ResolveRequest) (*patchenvpb.EnvPayload, error) {
+	vars, err := s.src.Load(ctx)
+	if errors.Is(err, patchenv.ErrNoChanges) {
+		return &patchenvpb.EnvPayload{NoChanges: true}, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	payload := &patchenvpb.EnvPayload{}
+	for _, v := range vars {
+		ev := &patchenvpb.EnvVar{Name: v.Name, Value: v.Value, Unset: v.Unset, Secret: v.Secret}
+		if !v.Expires.IsZero() {
+			ev.Expires = timestamppb.New(v.Expires)
+		}
+		payload.Vars = append(payload.Vars, ev)
+	}
+	return payload, nil
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,6 @@
+// Package patchenvpb holds the Go code generated from
+// proto/patchenv/v1/patchenv.proto, which defines the EnvService that
+// patchenvgrpc.Source consumes.  Use it to implement an environment service.
+package patchenvpb
+
+//go:generate protoc -I ../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative patchenv/v1/patchenv.proto
@@ -0,0 +1,378 @@
+// The patchenv environment service lets an organization run a central
+// service that computes environments, which patchenv programs consume with
+// patchenvgrpc.Source.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: patchenv/v1/patchenv.proto
+
+package patchenvpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ResolveRequest describes the client asking for an environment.
+type ResolveRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Why the client is patching its environment: "startup" or "reload".
+	Invocation string `protobuf:"bytes,1,opt,name=invocation,proto3" json:"invocation,omitempty"`
+	// The client's operating system and architecture, like "linux/amd64".
+	Platform string `protobuf:"bytes,2,opt,name=platform,proto3" json:"platform,omitempty"`
+	// Client-supplied selectors, like the application name and deployment
+	// environment, that the service may use to choose the variables.
+	Labels map[string]string `protobuf:"bytes,3,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *ResolveRequest) Reset() {
+	*x = ResolveRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_patchenv_v1_patchenv_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ResolveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveRequest) ProtoMessage() {}
+
+func (x *ResolveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_patchenv_v1_patchenv_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveRequest.ProtoReflect.Descriptor instead.
+func (*ResolveRequest) Descriptor() ([]byte, []int) {
+	return file_patchenv_v1_patchenv_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ResolveRequest) GetInvocation() string {
+	if x != nil {
+		return x.Invocation
+	}
+	return ""
+}
+
+func (x *ResolveRequest) GetPlatform() string {
+	if x != nil {
+		return x.Platform
+	}
+	return ""
+}
+
+func (x *ResolveRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+// EnvVar is an environment variable to set or unset.
+type EnvVar struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// Remove the variable from the environment instead of setting it.
+	Unset bool `protobuf:"varint,3,opt,name=unset,proto3" json:"unset,omitempty"`
+	// The value is sensitive and shouldn't be logged or displayed.
+	Secret bool `protobuf:"varint,4,opt,name=secret,proto3" json:"secret,omitempty"`
+	// When the value stops being valid, if it expires.
+	Expires *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=expires,proto3" json:"expires,omitempty"`
+}
+
+func (x *EnvVar) Reset() {
+	*x = EnvVar{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_patchenv_v1_patchenv_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EnvVar) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnvVar) ProtoMessage() {}
+
+func (x *EnvVar) ProtoReflect() protoreflect.Message {
+	mi := &file_patchenv_v1_patchenv_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnvVar.ProtoReflect.Descriptor instead.
+func (*EnvVar) Descriptor() ([]byte, []int) {
+	return file_patchenv_v1_patchenv_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EnvVar) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *EnvVar) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *EnvVar) GetUnset() bool {
+	if x != nil {
+		return x.Unset
+	}
+	return false
+}
+
+func (x *EnvVar) GetSecret() bool {
+	if x != nil {
+		return x.Secret
+	}
+	return false
+}
+
+func (x *EnvVar) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+// EnvPayload is the environment computed for a client.
+type EnvPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The variables, applied in order.
+	Vars []*EnvVar `protobuf:"bytes,1,rep,name=vars,proto3" json:"vars,omitempty"`
+	// There's nothing to change since the client last patched its
+	// environment.  vars is empty when it's set.
+	NoChanges bool `protobuf:"varint,2,opt,name=no_changes,json=noChanges,proto3" json:"no_changes,omitempty"`
+}
+
+func (x *EnvPayload) Reset() {
+	*x = EnvPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_patchenv_v1_patchenv_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EnvPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnvPayload) ProtoMessage() {}
+
+func (x *EnvPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_patchenv_v1_patchenv_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnvPayload.ProtoReflect.Descriptor instead.
+func (*EnvPayload) Descriptor() ([]byte, []int) {
+	return file_patchenv_v1_patchenv_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EnvPayload) GetVars() []*EnvVar {
+	if x != nil {
+		return x.Vars
+	}
+	return nil
+}
+
+func (x *EnvPayload) GetNoChanges() bool {
+	if x != nil {
+		return x.NoChanges
+	}
+	return false
+}
+
+var File_patchenv_v1_patchenv_proto protoreflect.FileDescriptor
+
+var file_patchenv_v1_patchenv_proto_rawDesc = []byte{
+	0x0a, 0x1a, 0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x2f, 0x76, 0x31, 0x2f, 0x70, 0x61,
+	0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x70, 0x61,
+	0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x2e, 0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xc8, 0x01, 0x0a, 0x0e, 0x52,
+	0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a,
+	0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a,
+	0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x70, 0x6c, 0x61, 0x74, 0x66, 0x6f, 0x72, 0x6d, 0x12, 0x3f, 0x0a, 0x06, 0x6c, 0x61, 0x62,
+	0x65, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x27, 0x2e, 0x70, 0x61, 0x74, 0x63,
+	0x68, 0x65, 0x6e, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x4c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x52, 0x06, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x4c, 0x61,
+	0x62, 0x65, 0x6c, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x96, 0x01, 0x0a, 0x06, 0x45, 0x6e, 0x76, 0x56, 0x61, 0x72,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x75, 0x6e,
+	0x73, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x75, 0x6e, 0x73, 0x65, 0x74,
+	0x12, 0x16, 0x0a, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x73, 0x65, 0x63, 0x72, 0x65, 0x74, 0x12, 0x34, 0x0a, 0x07, 0x65, 0x78, 0x70, 0x69,
+	0x72, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x07, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x22, 0x54,
+	0x0a, 0x0a, 0x45, 0x6e, 0x76, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x27, 0x0a, 0x04,
+	0x76, 0x61, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x70, 0x61, 0x74,
+	0x63, 0x68, 0x65, 0x6e, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6e, 0x76, 0x56, 0x61, 0x72, 0x52,
+	0x04, 0x76, 0x61, 0x72, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x6e, 0x6f, 0x5f, 0x63, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x6e, 0x6f, 0x43, 0x68, 0x61,
+	0x6e, 0x67, 0x65, 0x73, 0x32, 0x4d, 0x0a, 0x0a, 0x45, 0x6e, 0x76, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x12, 0x3f, 0x0a, 0x07, 0x52, 0x65, 0x73, 0x6f, 0x6c, 0x76, 0x65, 0x12, 0x1b, 0x2e,
+	0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x73, 0x6f,
+	0x6c, 0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x70, 0x61, 0x74,
+	0x63, 0x68, 0x65, 0x6e, 0x76, 0x2e, 0x76, 0x31, 0x2e, 0x45, 0x6e, 0x76, 0x50, 0x61, 0x79, 0x6c,
+	0x6f, 0x61, 0x64, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f,
+	0x6d, 0x2f, 0x61, 0x72, 0x70, 0x69, 0x6f, 0x2f, 0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x6e, 0x76,
+	0x2f, 0x70, 0x61, 0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x67, 0x72, 0x70, 0x63, 0x2f, 0x70, 0x61,
+	0x74, 0x63, 0x68, 0x65, 0x6e, 0x76, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_patchenv_v1_patchenv_proto_rawDescOnce sync.Once
+	file_patchenv_v1_patchenv_proto_rawDescData = file_patchenv_v1_patchenv_proto_rawDesc
+)
+
+func file_patchenv_v1_patchenv_proto_rawDescGZIP() []byte {
+	file_patchenv_v1_patchenv_proto_rawDescOnce.Do(func() {
+		file_patchenv_v1_patchenv_proto_rawDescData = protoimpl.X.CompressGZIP(file_patchenv_v1_patchenv_proto_rawDescData)
+	})
+	return file_patchenv_v1_patchenv_proto_rawDescData
+}
+
+var file_patchenv_v1_patchenv_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_patchenv_v1_patchenv_proto_goTypes = []any{
+	(*ResolveRequest)(nil),        // 0: patchenv.v1.ResolveRequest
+	(*EnvVar)(nil),                // 1: patchenv.v1.EnvVar
+	(*EnvPayload)(nil),            // 2: patchenv.v1.EnvPayload
+	nil,                           // 3: patchenv.v1.ResolveRequest.LabelsEntry
+	(*timestamppb.Timestamp)(nil), // 4: google.protobuf.Timestamp
+}
+var file_patchenv_v1_patchenv_proto_depIdxs = []int32{
+	3, // 0: patchenv.v1.ResolveRequest.labels:type_name -> patchenv.v1.ResolveRequest.LabelsEntry
+	4, // 1: patchenv.v1.EnvVar.expires:type_name -> google.protobuf.Timestamp
+	1, // 2: patchenv.v1.EnvPayload.vars:type_name -> patchenv.v1.EnvVar
+	0, // 3: patchenv.v1.EnvService.Resolve:input_type -> patchenv.v1.ResolveRequest
+	2, // 4: patchenv.v1.EnvService.Resolve:output_type -> patchenv.v1.EnvPayload
+	4, // [4:5] is the sub-list for method output_type
+	3, // [3:4] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_patchenv_v1_patchenv_proto_init() }
+func file_patchenv_v1_patchenv_proto_init() {
+	if File_patchenv_v1_patchenv_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_patchenv_v1_patchenv_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*ResolveRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_patchenv_v1_patchenv_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*EnvVar); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_patchenv_v1_patchenv_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*EnvPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_patchenv_v1_patchenv_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_patchenv_v1_patchenv_proto_goTypes,
+		DependencyIndexes: file_patchenv_v1_patchenv_proto_depIdxs,
+		MessageInfos:      file_patchenv_v1_patchenv_proto_msgTypes,
+	}.Build()
+	File_patchenv_v1_patchenv_proto = out.File
+	file_patchenv_v1_patchenv_proto_rawDesc = nil
+	file_patchenv_v1_patchenv_proto_goTypes = nil
+	file_patchenv_v1_patchenv_proto_depIdxs = nil
+}
@@ -0,0 +1,131 @@
+// The patchenv environment service lets an organization run a central
+// service that computes environments, which patchenv programs consume with
+// patchenvgrpc.Source.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: patchenv/v1/patchenv.proto
+
+package patchenvpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EnvService_Resolve_FullMethodName = "/patchenv.v1.EnvService/Resolve"
+)
+
+// EnvServiceClient is the client API for EnvService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EnvService computes environments for patchenv clients.
+type EnvServiceClient interface {
+	// Resolve returns the variables to set in the client's environment.
+	Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*EnvPayload, error)
+}
+
+type envServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEnvServiceClient(cc grpc.ClientConnInterface) EnvServiceClient {
+	return &envServiceClient{cc}
+}
+
+func (c *envServiceClient) Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*EnvPayload, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EnvPayload)
+	err := c.cc.Invoke(ctx, EnvService_Resolve_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EnvServiceServer is the server API for EnvService service.
+// All implementations must embed UnimplementedEnvServiceServer
+// for forward compatibility.
+//
+// EnvService computes environments for patchenv clients.
+type EnvServiceServer interface {
+	// Resolve returns the variables to set in the client's environment.
+	Resolve(context.Context, *ResolveRequest) (*EnvPayload, error)
+	mustEmbedUnimplementedEnvServiceServer()
+}
+
+// UnimplementedEnvServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEnvServiceServer struct{}
+
+func (UnimplementedEnvServiceServer) Resolve(context.Context, *ResolveRequest) (*EnvPayload, error) {
+	return nil, status.Error(codes.Unimplemented, "method Resolve not implemented")
+}
+func (UnimplementedEnvServiceServer) mustEmbedUnimplementedEnvServiceServer() {}
+func (UnimplementedEnvServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeEnvServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EnvServiceServer will
+// result in compilation errors.
+type UnsafeEnvServiceServer interface {
+	mustEmbedUnimplementedEnvServiceServer()
+}
+
+func RegisterEnvServiceServer(s grpc.ServiceRegistrar, srv EnvServiceServer) {
+	// If the following call panics, it indicates UnimplementedEnvServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EnvService_ServiceDesc, srv)
+}
+
+func _EnvService_Resolve_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EnvServiceServer).Resolve(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EnvService_Resolve_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EnvServiceServer).Resolve(ctx, req.(*ResolveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EnvService_ServiceDesc is the grpc.ServiceDesc for EnvService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EnvService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "patchenv.v1.EnvService",
+	HandlerType: (*EnvServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Resolve",
+			Handler:    _EnvService_Resolve_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "patchenv/v1/patchenv.proto",
+}
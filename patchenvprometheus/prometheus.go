@@ -0,0 +1,108 @@
+// Package patchenvprometheus exports patchenv's Stats as Prometheus
+// metrics, so fleet dashboards can track how patching the environment is
+// going:
+//
+//	prometheus.MustRegister(patchenvprometheus.NewCollector())
+//
+// The metrics are:
+//
+//	patchenv_patches_total                  calls to PatchWith
+//	patchenv_patch_failures_total           calls to PatchWith that failed
+//	patchenv_vars_applied_total             variables PatchWith set or unset
+//	patchenv_load_duration_seconds          time spent loading variables (a summary)
+//	patchenv_load_failures_total            loads that failed
+//	patchenv_cache_hits_total               CachedSource loads served from the cache
+//	patchenv_cache_misses_total             CachedSource loads that called the wrapped source
+//	patchenv_cache_hit_ratio                hits divided by hits and misses
+//	patchenv_refreshes_total                refreshes done by Refreshers
+//	patchenv_refresh_failures_total         refreshes that failed
+//	patchenv_last_refresh_timestamp_seconds time of the last successful refresh
+//	patchenv_refresh_lag_seconds            time since the last successful refresh
+//
+// The last three are only reported once a refresh has succeeded, and the
+// cache hit ratio once a CachedSource has been used.
+package patchenvprometheus
+
+import (
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector for patchenv.ReadStats.
+type Collector struct {
+	patches         *prometheus.Desc
+	patchFailures   *prometheus.Desc
+	varsApplied     *prometheus.Desc
+	loadDuration    *prometheus.Desc
+	loadFailures    *prometheus.Desc
+	cacheHits       *prometheus.Desc
+	cacheMisses     *prometheus.Desc
+	cacheHitRatio   *prometheus.Desc
+	refreshes       *prometheus.Desc
+	refreshFailures *prometheus.Desc
+	lastRefresh     *prometheus.Desc
+	refreshLag      *prometheus.Desc
+}
+
+// NewCollector returns a Collector.  Only one should be registered with
+// each registry, since the stats are global to the process.
+func NewCollector() *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("patchenv_"+name, help, nil, nil)
+	}
+	return &Collector{
+		patches:         desc("patches_total", "Calls to PatchWith."),
+		patchFailures:   desc("patch_failures_total", "Calls to PatchWith that returned an error."),
+		varsApplied:     desc("vars_applied_total", "Variables PatchWith set or unset in the environment."),
+		loadDuration:    desc("load_duration_seconds", "Time spent loading variables from commands and sources."),
+		loadFailures:    desc("load_failures_total", "Loads from commands and sources that failed."),
+		cacheHits:       desc("cache_hits_total", "CachedSource loads that returned cached variables."),
+		cacheMisses:     desc("cache_misses_total", "CachedSource loads that called the wrapped source."),
+		cacheHitRatio:   desc("cache_hit_ratio", "Fraction of CachedSource loads that returned cached variables."),
+		refreshes:       desc("refreshes_total", "Refreshes done by Refreshers."),
+		refreshFailures: desc("refresh_failures_total", "Refreshes done by Refreshers that failed."),
+		lastRefresh:     desc("last_refresh_timestamp_seconds", "Time of the last successful refresh, in seconds since the epoch."),
+		refreshLag:      desc("refresh_lag_seconds", "Time since the last successful refresh."),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		c.patches, c.patchFailures, c.varsApplied, c.loadDuration, c.loadFailures,
+		c.cacheHits, c.cacheMisses, c.cacheHitRatio, c.refreshes, c.refreshFailures,
+		c.lastRefresh, c.refreshLag,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := patchenv.ReadStats()
+	counter := func(d *prometheus.Desc, value uint64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(value))
+	}
+	gauge := func(d *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, value)
+	}
+
+	counter(c.patches, s.Patches)
+	counter(c.patchFailures, s.PatchFailures)
+	counter(c.varsApplied, s.VarsApplied)
+	ch <- prometheus.MustNewConstSummary(c.loadDuration, s.Loads, s.LoadTime.Seconds(), nil)
+	counter(c.loadFailures, s.LoadFailures)
+	counter(c.cacheHits, s.CacheHits)
+	counter(c.cacheMisses, s.CacheMisses)
+	if total := s.CacheHits + s.CacheMisses; total > 0 {
+		gauge(c.cacheHitRatio, float64(s.CacheHits)/float64(total))
+	}
+	counter(c.refreshes, s.Refreshes)
+	counter(c.refreshFailures, s.RefreshFailures)
+	if !s.LastRefresh.IsZero() {
+		gauge(c.lastRefresh, float64(s.LastRefresh.UnixNano())/float64(time.Second))
+		gauge(c.refreshLag, time.Since(s.LastRefresh).Seconds())
+	}
+}
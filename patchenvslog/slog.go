@@ -0,0 +1,93 @@
+// Package patchenvslog keeps the secrets patchenv sets out of log/slog
+// logs.  Use ReplaceAttr with the standard handlers:
+//
+//	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+//		ReplaceAttr: patchenvslog.ReplaceAttr,
+//	}))
+//
+// or wrap any handler with NewHandler.  Secret values are replaced by
+// "[REDACTED]", as patchenv.Redact does, including ones patchenv sets
+// after the logger is created.
+package patchenvslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/arpio/patchenv"
+)
+
+// ReplaceAttr is a function for slog.HandlerOptions.ReplaceAttr that
+// redacts secret values in a, including the message.  Values that aren't
+// strings are redacted when their formatted text contains a secret, and
+// then logged as that text.
+func ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	a.Value = redactValue(a.Value)
+	return a
+}
+
+// redactValue returns v with secret values redacted.
+func redactValue(v slog.Value) slog.Value {
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.StringValue(patchenv.Redact(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redacted[i] = slog.Attr{Key: a.Key, Value: redactValue(a.Value)}
+		}
+		return slog.GroupValue(redacted...)
+	case slog.KindAny:
+		s := fmt.Sprint(v.Any())
+		if r := patchenv.Redact(s); r != s {
+			return slog.StringValue(r)
+		}
+	case slog.KindLogValuer:
+		return redactValue(v.Resolve())
+	}
+	return v
+}
+
+// NewHandler returns a handler that redacts secret values in the messages
+// and attributes of records before passing them to h, for handlers that
+// don't accept a ReplaceAttr function.
+func NewHandler(h slog.Handler) slog.Handler {
+	return &handler{h: h}
+}
+
+// handler is the slog.Handler returned by NewHandler.
+type handler struct {
+	h slog.Handler
+}
+
+// Enabled implements the slog.Handler interface.
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.h.Enabled(ctx, level)
+}
+
+// Handle implements the slog.Handler interface.
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, patchenv.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(ReplaceAttr(nil, a))
+		return true
+	})
+	return h.h.Handle(ctx, redacted)
+}
+
+// WithAttrs implements the slog.Handler interface.  The attributes are
+// redacted when they're added, so their secrets are the ones set then.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = ReplaceAttr(nil, a)
+	}
+	return &handler{h: h.h.WithAttrs(redacted)}
+}
+
+// WithGroup implements the slog.Handler interface.
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{h: h.h.WithGroup(name)}
+}
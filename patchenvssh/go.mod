@@ -0,0 +1,12 @@
+module github.com/arpio/patchenv/patchenvssh
+
+go 1.26.0
+
+require (
+	github.com/arpio/patchenv v1.0.0
+	golang.org/x/crypto v0.57.0
+)
+
+require golang.org/x/sys v0.48.0 // indirect
+
+replace github.com/arpio/patchenv => ../
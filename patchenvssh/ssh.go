@@ -0,0 +1,109 @@
+// Package patchenvssh passes the variables computed by patchenv to commands
+// run over SSH with golang.org/x/crypto/ssh, so tools that run remote
+// commands propagate the patched environment.
+//
+// SSH servers only accept the variables their configuration allows (with
+// OpenSSH's AcceptEnv), so there are two ways to pass them: Setenv sends
+// them with the session's "env" requests, and Command wraps the remote
+// command in a shell command line that sets them.  Run tries the first and
+// falls back to the second:
+//
+//	result, err := patchenv.Resolve()
+//	...
+//	session, err := client.NewSession()
+//	...
+//	err = patchenvssh.Run(session, "make deploy", result.Vars)
+package patchenvssh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/arpio/patchenv"
+	"golang.org/x/crypto/ssh"
+)
+
+// Setenv sends the variables that changes sets to the session with "env"
+// requests, which must be made before the remote command starts.  It
+// returns an error if the server rejects one of them, or if changes unsets
+// a variable, which the SSH protocol can't express.  Variables the server
+// accepted before the error stay set.
+func Setenv(session *ssh.Session, changes patchenv.Changes) error {
+	for _, v := range final(changes) {
+		if v.Unset {
+			return fmt.Errorf("patchenv: can't unset %s in an SSH session", v.Name)
+		}
+		if err := session.Setenv(v.Name, v.Value); err != nil {
+			return fmt.Errorf("patchenv: SSH server rejected %s: %w", v.Name, err)
+		}
+	}
+	return nil
+}
+
+// Command returns a command line for a POSIX shell on the remote host that
+// sets and unsets the variables in changes and then runs command.  The
+// values are quoted, but they do appear in the remote host's process list
+// while the shell starts, so consider Setenv for secrets.
+func Command(command string, changes patchenv.Changes) (string, error) {
+	var b strings.Builder
+	for _, v := range final(changes) {
+		if !isName(v.Name) {
+			return "", fmt.Errorf("patchenv: can't set %s in a shell: not a valid shell variable name", v.Name)
+		}
+		if v.Unset {
+			fmt.Fprintf(&b, "unset %s; ", v.Name)
+		} else {
+			fmt.Fprintf(&b, "export %s=%s; ", v.Name, shellQuote(v.Value))
+		}
+	}
+	b.WriteString(command)
+	return b.String(), nil
+}
+
+// Run runs command in the session with the variables in changes.  If the
+// server accepts them all with Setenv, the command runs as it is;
+// otherwise it runs wrapped by Command.
+func Run(session *ssh.Session, command string, changes patchenv.Changes) error {
+	if err := Setenv(session, changes); err != nil {
+		wrapped, err := Command(command, changes)
+		if err != nil {
+			return err
+		}
+		command = wrapped
+	}
+	return session.Run(command)
+}
+
+// final returns the last change for each name, in the order of those last
+// changes.
+func final(changes patchenv.Changes) []patchenv.Var {
+	last := make(map[string]int, len(changes))
+	for i, v := range changes {
+		last[v.Name] = i
+	}
+	vars := make([]patchenv.Var, 0, len(last))
+	for i, v := range changes {
+		if last[v.Name] == i {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// isName reports whether name is a valid POSIX shell variable name.
+func isName(name string) bool {
+	for i, c := range name {
+		switch {
+		case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// shellQuote returns s in POSIX shell single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
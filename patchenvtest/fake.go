@@ -0,0 +1,131 @@
+package patchenvtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/arpio/patchenv"
+)
+
+// Response is a scripted response of a FakeSource or FakeRunner.
+type Response struct {
+	// Vars are the variables a FakeSource returns.
+	Vars []patchenv.Var
+
+	// Output is the command output a FakeRunner returns.
+	Output string
+
+	// Err is the error returned instead of Vars or Output, if not nil.
+	Err error
+
+	// Delay is how long to wait before responding.  If the context is done
+	// first, its error is returned instead.
+	Delay time.Duration
+}
+
+// FakeSource is a patchenv.Source that returns scripted responses, for use
+// with patchenv.WithSource.  Each call to Load returns the next of
+// Responses; once they're used up, the last one is repeated.  If Responses
+// is empty, Load returns no variables.
+type FakeSource struct {
+	Responses []Response
+
+	script script
+}
+
+// Load implements the patchenv.Source interface.
+func (s *FakeSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	resp, err := s.script.next(ctx, s.Responses, call{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Vars, nil
+}
+
+// Calls returns the number of times Load has been called.
+func (s *FakeSource) Calls() int {
+	return len(s.script.calls())
+}
+
+// FakeRunner is a patchenv.Runner that returns scripted output instead of
+// running commands, for use with patchenv.WithRunner.  Each call to Run
+// returns the next of Responses; once they're used up, the last one is
+// repeated.  If Responses is empty, Run returns no output.
+type FakeRunner struct {
+	Responses []Response
+
+	script script
+}
+
+// Run implements the patchenv.Runner interface.
+func (r *FakeRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	resp, err := r.script.next(ctx, r.Responses, call{command: command, env: env})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Output), nil
+}
+
+// Commands returns the commands that Run has been called with, in order.
+func (r *FakeRunner) Commands() []string {
+	calls := r.script.calls()
+	commands := make([]string, len(calls))
+	for i, c := range calls {
+		commands[i] = c.command
+	}
+	return commands
+}
+
+// Env returns the variables that patchenv added to the environment of the
+// nth command (starting at 0) that Run was called with.
+func (r *FakeRunner) Env(n int) []string {
+	return r.script.calls()[n].env
+}
+
+// call records the arguments of a call to a fake.
+type call struct {
+	command string
+	env     []string
+}
+
+// script tracks the calls made to a fake.
+type script struct {
+	mu      sync.Mutex
+	history []call
+}
+
+// next records the call and returns the response to it from responses,
+// after waiting for the response's delay.
+func (s *script) next(ctx context.Context, responses []Response, c call) (Response, error) {
+	s.mu.Lock()
+	n := len(s.history)
+	s.history = append(s.history, c)
+	s.mu.Unlock()
+
+	if len(responses) == 0 {
+		return Response{}, nil
+	}
+	if n >= len(responses) {
+		n = len(responses) - 1
+	}
+	resp := responses[n]
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return Response{}, ctx.Err()
+		}
+	}
+	return resp, resp.Err
+}
+
+// calls returns a copy of the recorded calls.
+func (s *script) calls() []call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]call(nil), s.history...)
+}
@@ -0,0 +1,131 @@
+// Package patchenvtest helps test programs that use patchenv.
+//
+// The functions in this package set variables with t.Setenv, so the
+// environment is restored when the test finishes.  Like t.Setenv, they
+// can't be used in parallel tests or tests with parallel ancestors.
+package patchenvtest
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/arpio/patchenv"
+)
+
+// patchCommandVar is the environment variable that holds the command run by
+// patchenv.Patch().
+const patchCommandVar = "PATCH_ENV_COMMAND"
+
+// PatchT parses payload as patchenv.Parse() would parse a command's output
+// and sets each variable with t.Setenv.  It returns a Result describing the
+// variables that were set.
+func PatchT(t testing.TB, payload string) *patchenv.Result {
+	t.Helper()
+	vars, err := patchenv.Parse(strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("patchenvtest: can't parse payload: %s", err)
+	}
+	result := &patchenv.Result{Vars: vars}
+	setenv(t, result)
+	return result
+}
+
+// PatchWithT is like patchenv.PatchWith() but sets the variables with
+// t.Setenv.  The test fails immediately if the environment can't be
+// patched.
+func PatchWithT(t testing.TB, opts ...patchenv.Option) *patchenv.Result {
+	t.Helper()
+	result, err := patchenv.Resolve(opts...)
+	if err != nil {
+		t.Fatalf("patchenvtest: can't resolve environment: %s", err)
+	}
+	setenv(t, result)
+	return result
+}
+
+// WithFakeCommand sets PATCH_ENV_COMMAND to script with t.Setenv, so code
+// under test that calls patchenv.Patch() runs script instead of the real
+// command.  The script is run by the shell, so it can print a payload with
+// echo or printf:
+//
+//	patchenvtest.WithFakeCommand(t, "echo DATABASE_URL=postgres://localhost/test")
+//
+// Only PATCH_ENV_COMMAND itself is restored when the test finishes;
+// variables that patchenv.Patch() sets with os.Setenv are not.
+func WithFakeCommand(t testing.TB, script string) {
+	t.Helper()
+	t.Setenv(patchCommandVar, script)
+}
+
+// AssertApplied fails the test unless result set exactly the variables in
+// want, with the values in want, and the environment still holds those
+// values.  Variables that result unset are ignored.
+func AssertApplied(t testing.TB, result *patchenv.Result, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	for _, v := range result.Vars {
+		if v.Unset {
+			delete(got, v.Name)
+			continue
+		}
+		got[v.Name] = v.Value
+	}
+
+	for _, name := range sortedKeys(want) {
+		value, ok := got[name]
+		switch {
+		case !ok:
+			t.Errorf("patchenvtest: %s was not set, want %q", name, want[name])
+		case value != want[name]:
+			t.Errorf("patchenvtest: %s was set to %q, want %q", name, value, want[name])
+		}
+	}
+	for _, name := range sortedKeys(got) {
+		if _, ok := want[name]; !ok {
+			t.Errorf("patchenvtest: %s was unexpectedly set to %q", name, got[name])
+		}
+	}
+	AssertEnv(t, want)
+}
+
+// AssertEnv fails the test unless each variable in want is set to its value
+// in want in the environment.
+func AssertEnv(t testing.TB, want map[string]string) {
+	t.Helper()
+	for _, name := range sortedKeys(want) {
+		value, ok := os.LookupEnv(name)
+		switch {
+		case !ok:
+			t.Errorf("patchenvtest: %s is not in the environment, want %q", name, want[name])
+		case value != want[name]:
+			t.Errorf("patchenvtest: %s is %q in the environment, want %q", name, value, want[name])
+		}
+	}
+}
+
+// setenv sets each of result's variables with t.Setenv.
+func setenv(t testing.TB, result *patchenv.Result) {
+	t.Helper()
+	for _, v := range result.Vars {
+		if v.Unset {
+			// t.Setenv arranges for the original value to be restored.
+			t.Setenv(v.Name, "")
+			_ = os.Unsetenv(v.Name)
+			continue
+		}
+		t.Setenv(v.Name, v.Value)
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order, so failures are
+// reported in a stable order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
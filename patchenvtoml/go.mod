@@ -0,0 +1,10 @@
+module github.com/arpio/patchenv/patchenvtoml
+
+go 1.18
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/arpio/patchenv v1.0.0
+)
+
+replace github.com/arpio/patchenv => ../
@@ -0,0 +1,103 @@
+// Package patchenvtoml lets patchenv read commands, files, and URLs that
+// produce a TOML document instead of "var=value" lines, so one generator
+// can write both a program's configuration file and its environment.
+// Import it for its side effect:
+//
+//	import _ "github.com/arpio/patchenv/patchenvtoml"
+//
+// Tables are flattened, so with the default Parser this payload sets
+// DB_HOST and DB_PORT:
+//
+//	[db]
+//	host = "localhost"
+//	port = 5432
+//
+// Arrays, including arrays of tables, are set as JSON arrays.  Local dates
+// and times are set as written, without a time zone.
+//
+// TOML payloads are detected when their first line is a table header, like
+// "[db]"; otherwise, set the Parser's Format, or the PATCH_ENV_FORMAT
+// environment variable, to "toml".
+package patchenvtoml
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/arpio/patchenv"
+)
+
+func init() {
+	patchenv.RegisterFormat("toml", patchenv.PayloadFormat{Decode: Decode, Detect: Detect})
+}
+
+// Decode decodes a TOML document into the tree of maps, slices, and scalar
+// values that patchenv.PayloadFormat expects.
+func Decode(data []byte) (interface{}, error) {
+	var tree map[string]interface{}
+	if err := toml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return normalize(tree), nil
+}
+
+// localLayouts are the layouts of TOML's local date and time types, by the
+// names of the locations the decoder gives them.
+var localLayouts = map[string]string{
+	"datetime-local": "2006-01-02T15:04:05.999999999",
+	"date-local":     "2006-01-02",
+	"time-local":     "15:04:05.999999999",
+}
+
+// normalize converts the arrays of tables the decoder produces as
+// []map[string]interface{} to []interface{}, and local dates and times to
+// strings, so they aren't given the time zone of the machine decoding them.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalize(elem)
+		}
+		return v
+	case []map[string]interface{}:
+		list := make([]interface{}, len(v))
+		for i, elem := range v {
+			list[i] = normalize(elem)
+		}
+		return list
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalize(elem)
+		}
+		return v
+	case time.Time:
+		if layout, ok := localLayouts[v.Location().String()]; ok {
+			return v.Format(layout)
+		}
+	}
+	return value
+}
+
+// tableHeader matches a table or array of tables header, like "[db]" or
+// "[[servers]]", with an optional comment.
+var tableHeader = regexp.MustCompile(`^\[\[?\s*[A-Za-z0-9_."' -]+\]\]?\s*(#.*)?$`)
+
+// Detect reports whether data looks like TOML: its first line other than
+// blanks and comments is a table header.  Documents that start with
+// "key = value" pairs look like the "var=value" line protocol, so they
+// aren't detected.
+func Detect(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return tableHeader.MatchString(line)
+	}
+	return false
+}
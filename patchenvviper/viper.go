@@ -0,0 +1,115 @@
+// Package patchenvviper feeds the variables computed by patchenv into a
+// viper instance.
+//
+// Unlike viper's AutomaticEnv, which reads the process environment when a
+// key is looked up, Load sets the values in viper directly, so they're
+// available regardless of when the process environment is patched:
+//
+//	v := viper.New()
+//	err := patchenvviper.Load(v,
+//		patchenvviper.WithPrefix("MYAPP"),
+//		patchenvviper.WithKeyReplacer(strings.NewReplacer("_", ".")))
+//
+// With those options, MYAPP_DB_HOST=localhost sets the viper key "db.host".
+package patchenvviper
+
+import (
+	"strings"
+
+	"github.com/arpio/patchenv"
+	"github.com/spf13/viper"
+)
+
+// Option customizes the behavior of Load.
+type Option func(*loader)
+
+// loader holds the settings that options apply to.
+type loader struct {
+	prefix       string
+	replacer     *strings.Replacer
+	patchOptions []patchenv.Option
+}
+
+// WithPrefix makes Load ignore variables whose names don't start with prefix
+// followed by an underscore, and strips that from the names of the
+// variables it does load.  This is the reverse of viper's SetEnvPrefix.
+func WithPrefix(prefix string) Option {
+	return func(l *loader) {
+		l.prefix = prefix
+	}
+}
+
+// WithKeyReplacer applies r to each variable name (after it has been
+// lowercased and its prefix stripped) to compute its viper key.  For
+// example, strings.NewReplacer("_", ".") maps DB_HOST to "db.host".
+func WithKeyReplacer(r *strings.Replacer) Option {
+	return func(l *loader) {
+		l.replacer = r
+	}
+}
+
+// WithPatchOptions passes opts to patchenv.Resolve() when Load computes the
+// variables.
+func WithPatchOptions(opts ...patchenv.Option) Option {
+	return func(l *loader) {
+		l.patchOptions = append(l.patchOptions, opts...)
+	}
+}
+
+// Load computes the variables using patchenv.Resolve() and sets each of
+// them in v with v.Set(), so they override values from every other viper
+// configuration source.  The process environment isn't changed.
+//
+// Each variable's key is its name in lowercase, with the prefix and
+// replacements configured by opts applied.  Variables the result unsets
+// aren't set, so their keys keep the values from viper's other sources
+// rather than becoming empty strings.
+func Load(v *viper.Viper, opts ...Option) error {
+	l := &loader{}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	result, err := patchenv.Resolve(l.patchOptions...)
+	if err != nil {
+		return err
+	}
+	// A variable can be set and later unset by the result, so only each
+	// key's last definition counts.
+	var keys []string
+	last := make(map[string]patchenv.Var)
+	for _, pv := range result.Vars {
+		key, ok := l.key(pv.Name)
+		if !ok {
+			continue
+		}
+		if _, seen := last[key]; !seen {
+			keys = append(keys, key)
+		}
+		last[key] = pv
+	}
+	for _, key := range keys {
+		if pv := last[key]; !pv.Unset {
+			v.Set(key, pv.Value)
+		}
+	}
+	return nil
+}
+
+// key returns the viper key for the variable name, or false if the
+// variable should be ignored because it doesn't have the prefix.
+func (l *loader) key(name string) (string, bool) {
+	if l.prefix != "" {
+		prefix := l.prefix + "_"
+		if !strings.HasPrefix(strings.ToUpper(name), strings.ToUpper(prefix)) {
+			return "", false
+		}
+		name = name[len(prefix):]
+	}
+
+	key := strings.ToLower(name)
+	if l.replacer != nil {
+		key = l.replacer.Replace(key)
+	}
+	return key, key != ""
+}
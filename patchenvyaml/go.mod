@@ -0,0 +1,10 @@
+module github.com/arpio/patchenv/patchenvyaml
+
+go 1.17
+
+require (
+	github.com/arpio/patchenv v1.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/arpio/patchenv => ../
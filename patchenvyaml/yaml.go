@@ -0,0 +1,96 @@
+// Package patchenvyaml lets patchenv read commands, files, and URLs that
+// produce a YAML mapping instead of "var=value" lines.  Import it for its
+// side effect:
+//
+//	import _ "github.com/arpio/patchenv/patchenvyaml"
+//
+// Nested mappings are flattened, so with the default Parser this payload
+// sets DB_HOST and DB_PORT:
+//
+//	db:
+//	  host: localhost
+//	  port: 5432
+//
+// A key written with dots, like "db.host", sets the same variable.  A null
+// value unsets the variable, and a sequence is set as a JSON array.
+//
+// YAML payloads are detected when they start with a "---" document marker
+// or their first line is a "key:" mapping entry; otherwise, set the
+// Parser's Format, or the PATCH_ENV_FORMAT environment variable, to
+// "yaml".
+package patchenvyaml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arpio/patchenv"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	format := patchenv.PayloadFormat{Decode: Decode, Detect: Detect}
+	patchenv.RegisterFormat("yaml", format)
+	patchenv.RegisterFormat("yml", format)
+}
+
+// Decode decodes a YAML document into the tree of maps, slices, and scalar
+// values that patchenv.PayloadFormat expects.  Mapping keys that aren't
+// strings, like numbers, are converted to strings.
+func Decode(data []byte) (interface{}, error) {
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return normalize(tree), nil
+}
+
+// normalize converts the map[interface{}]interface{} values yaml.v3
+// produces for mappings with non-string keys to map[string]interface{}.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalize(elem)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = normalize(elem)
+		}
+		return m
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalize(elem)
+		}
+		return v
+	}
+	return value
+}
+
+// mappingKey matches a line that starts a block mapping entry, like
+// "db:" or "host: localhost", with a plain key.
+var mappingKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*:(\s|$)`)
+
+// Detect reports whether data looks like YAML: it starts with a "---"
+// document marker, or its first line other than blanks and comments is a
+// mapping entry.  A "var=value" line whose value contains ": " isn't
+// mistaken for one, because the key can't contain "=".
+func Detect(data []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(strings.TrimLeft(line, " \t"), "#") {
+			continue
+		}
+		if line == "---" || strings.HasPrefix(line, "--- ") {
+			return true
+		}
+		return mappingKey.MatchString(line)
+	}
+	return false
+}
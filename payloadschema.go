@@ -0,0 +1,410 @@
+package patchenv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// PayloadSchema describes the structure that structured payloads (JSON
+// envelopes, JSON Lines records, and registered formats like YAML) must
+// have, so a helper that produces malformed output fails with a description
+// of what's wrong instead of setting the wrong variables.  Set it as a
+// Parser's PayloadSchema.
+//
+// PayloadSchema supports the subset of JSON Schema used to describe
+// configuration documents, so one can be written in Go or read from a JSON
+// Schema document with ParsePayloadSchema:
+//
+//	{
+//	  "type": "object",
+//	  "required": ["version", "vars"],
+//	  "properties": {
+//	    "version": {"const": 2},
+//	    "vars": {"type": "object", "additionalProperties": {"type": "string"}}
+//	  }
+//	}
+//
+// Keywords it doesn't support, like "$ref" and "oneOf", are rejected by
+// ParsePayloadSchema, rather than ignored.
+type PayloadSchema struct {
+	// Type is "object", "array", "string", "number", "integer",
+	// "boolean", or "null", or empty to allow any type.
+	Type string `json:"type,omitempty"`
+
+	// Properties are the schemas of an object's entries, by key.
+	Properties map[string]*PayloadSchema `json:"properties,omitempty"`
+
+	// Required are the keys an object must have.
+	Required []string `json:"required,omitempty"`
+
+	// AdditionalProperties is the schema of an object's entries that
+	// aren't in Properties, or is nil to allow any.  Use
+	// NoAdditionalProperties to forbid them.
+	AdditionalProperties *PayloadSchema `json:"additionalProperties,omitempty"`
+
+	// Items is the schema of an array's elements, or is nil to allow any.
+	Items *PayloadSchema `json:"items,omitempty"`
+
+	// Enum, if it's not empty, lists the values allowed.
+	Enum []interface{} `json:"enum,omitempty"`
+
+	// Const, if it's not nil, is the only value allowed.
+	Const interface{} `json:"const,omitempty"`
+
+	// Pattern is a regular expression that strings must contain a match
+	// for, as in JSON Schema.  Anchor it with ^ and $ to match whole
+	// strings.
+	Pattern string `json:"pattern,omitempty"`
+
+	// MinLength and MaxLength limit the number of characters in strings,
+	// if they're not nil.
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+
+	// Minimum and Maximum limit numbers, if they're not nil.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	// MinItems and MaxItems limit the number of elements in arrays, if
+	// they're not nil.
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
+
+	// never means no value is allowed, for "additionalProperties": false.
+	never bool
+}
+
+// NoAdditionalProperties is an AdditionalProperties schema that forbids
+// entries that aren't in an object's Properties.
+var NoAdditionalProperties = &PayloadSchema{never: true}
+
+// payloadSchemaKeywords are the JSON Schema keywords ParsePayloadSchema
+// accepts.  Annotations that don't affect validation are included.
+var payloadSchemaKeywords = map[string]bool{
+	"$schema": true, "$id": true, "title": true, "description": true, "default": true,
+	"examples": true, "$comment": true,
+	"type": true, "properties": true, "required": true, "additionalProperties": true,
+	"items": true, "enum": true, "const": true, "pattern": true,
+	"minLength": true, "maxLength": true, "minimum": true, "maximum": true,
+	"minItems": true, "maxItems": true,
+}
+
+// ParsePayloadSchema reads a PayloadSchema from a JSON Schema document.
+func ParsePayloadSchema(data []byte) (*PayloadSchema, error) {
+	s, err := parsePayloadSchema(json.RawMessage(data), "")
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid payload schema: %w", err)
+	}
+	return s, nil
+}
+
+// parsePayloadSchema reads the schema at path in a JSON Schema document.
+func parsePayloadSchema(data json.RawMessage, path string) (*PayloadSchema, error) {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		if allowed {
+			return &PayloadSchema{}, nil
+		}
+		return NoAdditionalProperties, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: schema must be an object or a boolean", schemaPath(path))
+	}
+	for key := range raw {
+		if !payloadSchemaKeywords[key] {
+			return nil, fmt.Errorf("%s: unsupported keyword %q", schemaPath(path), key)
+		}
+	}
+
+	var s PayloadSchema
+	var nested struct {
+		Properties           map[string]json.RawMessage `json:"properties"`
+		AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+		Items                json.RawMessage            `json:"items"`
+	}
+	if err := json.Unmarshal(data, &nested); err != nil {
+		return nil, fmt.Errorf("%s: %w", schemaPath(path), err)
+	}
+	delete(raw, "properties")
+	delete(raw, "additionalProperties")
+	delete(raw, "items")
+	rest, _ := json.Marshal(raw)
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	dec.UseNumber()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %w", schemaPath(path), err)
+	}
+
+	var err error
+	for key, prop := range nested.Properties {
+		if s.Properties == nil {
+			s.Properties = make(map[string]*PayloadSchema)
+		}
+		if s.Properties[key], err = parsePayloadSchema(prop, path+"/properties/"+key); err != nil {
+			return nil, err
+		}
+	}
+	if nested.AdditionalProperties != nil {
+		if s.AdditionalProperties, err = parsePayloadSchema(nested.AdditionalProperties, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if nested.Items != nil {
+		if s.Items, err = parsePayloadSchema(nested.Items, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// PayloadError is returned by Parser.Parse when a structured payload
+// doesn't satisfy the Parser's PayloadSchema.
+type PayloadError struct {
+	// Record is the number of the JSON Lines record that doesn't match,
+	// starting at 1, or zero for other formats.
+	Record int
+
+	// Errors describe each problem that was found, starting with the
+	// JSON Pointer of the value, like "/vars/0/name".
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *PayloadError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	if e.Record > 0 {
+		return fmt.Sprintf("patchenv: payload record %d doesn't match schema: %s", e.Record, strings.Join(msgs, "; "))
+	}
+	return "patchenv: payload doesn't match schema: " + strings.Join(msgs, "; ")
+}
+
+// check returns a *PayloadError if payload, a tree decoded from a
+// structured payload, doesn't satisfy the schema.  A nil schema allows
+// anything.
+func (s *PayloadSchema) check(payload interface{}) error {
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	s.validate(payload, "", &errs)
+	if len(errs) > 0 {
+		return &PayloadError{Errors: errs}
+	}
+	return nil
+}
+
+// checkJSON is like check for a JSON document.
+func (s *PayloadSchema) checkJSON(data []byte) error {
+	if s == nil {
+		return nil
+	}
+	var payload interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("patchenv: invalid JSON payload: %w", err)
+	}
+	return s.check(payload)
+}
+
+// validate appends the ways value, at path, doesn't satisfy the schema to
+// errs.
+func (s *PayloadSchema) validate(value interface{}, path string, errs *[]error) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, fmt.Errorf("%s: %s", schemaPath(path), fmt.Sprintf(format, args...)))
+	}
+	if s.never {
+		fail("isn't allowed")
+		return
+	}
+
+	typ := payloadType(value)
+	if s.Type != "" && s.Type != typ && !(s.Type == "number" && typ == "integer") {
+		fail("must be %s, not %s", article(s.Type), article(typ))
+		return
+	}
+	if s.Const != nil && !payloadEqual(s.Const, value) {
+		fail("must be %s", schemaValue(s.Const))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, allowed := range s.Enum {
+			found = found || payloadEqual(allowed, value)
+		}
+		if !found {
+			values := make([]string, len(s.Enum))
+			for i, allowed := range s.Enum {
+				values[i] = schemaValue(allowed)
+			}
+			fail("must be one of %s", strings.Join(values, ", "))
+		}
+	}
+
+	switch typ {
+	case "object":
+		m := value.(map[string]interface{})
+		for _, key := range s.Required {
+			if _, ok := m[key]; !ok {
+				fail("%q is required", key)
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			elemSchema := s.Properties[key]
+			if elemSchema == nil {
+				elemSchema = s.AdditionalProperties
+			}
+			if elemSchema != nil {
+				elemSchema.validate(m[key], path+"/"+pointerEscape(key), errs)
+			}
+		}
+	case "array":
+		list := value.([]interface{})
+		if s.MinItems != nil && len(list) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(list) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, elem := range list {
+				s.Items.validate(elem, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case "string":
+		str, _ := scalarString(value)
+		n := utf8.RuneCountInString(str)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				fail("schema has invalid pattern: %s", err)
+				return
+			}
+			if !re.MatchString(str) {
+				fail("doesn't match pattern %q", s.Pattern)
+			}
+		}
+	case "number", "integer":
+		n, _ := payloadNumber(value)
+		if s.Minimum != nil && n < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+// payloadType returns the JSON Schema type of value, a value in a tree
+// decoded from a structured payload.  Times, which YAML and TOML decode,
+// are strings.
+func payloadType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string, time.Time:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64, json.Number:
+		if n, ok := payloadNumber(v); ok && n == math.Trunc(n) && !math.IsInf(n, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// payloadNumber returns value as a float64, if it's a number.
+func payloadNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// payloadEqual reports whether the values a and b are equal, comparing
+// numbers by value regardless of how they were decoded.
+func payloadEqual(a, b interface{}) bool {
+	if x, ok := payloadNumber(a); ok {
+		y, ok := payloadNumber(b)
+		return ok && x == y
+	}
+	if t, ok := b.(time.Time); ok {
+		b = t.Format(time.RFC3339Nano)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// schemaValue returns value as JSON, for an error message.
+func schemaValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// schemaPath returns the JSON Pointer path, or "/" for the whole payload.
+func schemaPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// pointerEscape escapes key for use in a JSON Pointer.
+func pointerEscape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// article returns the JSON Schema type typ with an indefinite article.
+func article(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	case "null":
+		return typ
+	}
+	return "a " + typ
+}
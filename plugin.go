@@ -0,0 +1,259 @@
+package patchenv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// pluginPrefix starts the names of plugin executables.
+	pluginPrefix = "patchenv-source-"
+
+	// pluginPathVar lists the directories plugins are discovered in.
+	pluginPathVar = "PATCH_ENV_PLUGIN_PATH"
+
+	// pluginCookieVar and pluginCookie are set in a plugin's environment,
+	// so a plugin can tell it's being run by patchenv and not by a user.
+	pluginCookieVar = "PATCH_ENV_PLUGIN_MAGIC_COOKIE"
+	pluginCookie    = "5c0b2f8e4a7d49e1b6c3f09d2e8a71c4"
+
+	// pluginProtocolVersion is the version of the plugin request format.
+	pluginProtocolVersion = 1
+)
+
+// PluginRequest is the request patchenv writes to a plugin's stdin, as a
+// JSON object.
+type PluginRequest struct {
+	// Version is the plugin protocol version, currently 1.
+	Version int `json:"version"`
+
+	// Name is the plugin's name.
+	Name string `json:"name"`
+
+	// Config is the plugin's configuration from PluginSource.Config.
+	Config map[string]string `json:"config,omitempty"`
+
+	// Invocation says why the environment is being patched.
+	Invocation Invocation `json:"invocation"`
+}
+
+// PluginSource is a Source that runs a provider plugin: a separate
+// executable named "patchenv-source-NAME", so third parties can ship
+// sources without patchenv (or the program using it) taking on their
+// dependencies.
+//
+// patchenv runs the plugin with the same handshake variables as a command,
+// plus PATCH_ENV_PLUGIN_MAGIC_COOKIE, and writes a PluginRequest to its
+// stdin.  The plugin writes a JSON envelope (payload protocol version 2) to
+// its stdout, or exits with an error status and a message on stderr.
+// ServePlugin implements the plugin side of the protocol.
+type PluginSource struct {
+	// Name is the plugin's name.  The plugin is found in the directories
+	// listed in PATCH_ENV_PLUGIN_PATH, or in "patchenv/plugins" in the
+	// user's configuration directory if it isn't set.
+	Name string
+
+	// Path is the path of the plugin executable, used instead of
+	// searching for it by name.
+	Path string
+
+	// Config is passed to the plugin in the request.
+	Config map[string]string
+
+	// Invocation says why the environment is being patched.  If it's
+	// empty, InvocationStartup is used.
+	Invocation Invocation
+
+	// Parser parses the plugin's output, or is nil to use the default
+	// Parser.
+	Parser *Parser
+}
+
+// Load implements the Source interface.
+func (s *PluginSource) Load(ctx context.Context) ([]Var, error) {
+	path := s.Path
+	if path == "" {
+		var err error
+		if path, err = FindPlugin(s.Name); err != nil {
+			return nil, err
+		}
+	}
+	invocation := s.Invocation
+	if invocation == "" {
+		invocation = InvocationStartup
+	}
+	req, err := json.Marshal(&PluginRequest{
+		Version:    pluginProtocolVersion,
+		Name:       s.Name,
+		Config:     s.Config,
+		Invocation: invocation,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trace := traceFrom(ctx)
+	trace.printf("running plugin %s", path)
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(append(os.Environ(), handshakeEnv(invocation)...), pluginCookieVar+"="+pluginCookie)
+	cmd.Stdin = bytes.NewReader(req)
+	var stdout, stderr bytes.Buffer
+	var exceeded func() error
+	cmd.Stdout, exceeded = limitWriter(ctx, &stdout)
+	cmd.Stderr = &stderr
+	start := time.Now()
+	err = RunCommand(ctx, cmd)
+	trace.printf("plugin exited after %s (%v) with %d bytes of stdout",
+		time.Since(start).Round(time.Microsecond), cmd.ProcessState, stdout.Len())
+	if err := exceeded(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: plugin %s failed: %w: %s",
+			s.label(path), err, strings.TrimSpace(stderr.String()))
+	}
+
+	parser := s.Parser
+	if parser == nil {
+		parser = &Parser{}
+	}
+	return parser.Parse(&stdout)
+}
+
+// label returns the name to use for the plugin in error messages.
+func (s *PluginSource) label(path string) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return path
+}
+
+// pluginDirs returns the directories plugins are discovered in.
+func pluginDirs() []string {
+	if path := os.Getenv(pluginPathVar); path != "" {
+		return filepath.SplitList(path)
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return []string{filepath.Join(dir, "patchenv", "plugins")}
+	}
+	return nil
+}
+
+// pluginFile returns the file name of the plugin executable for name.
+func pluginFile(name string) string {
+	if runtime.GOOS == "windows" {
+		return pluginPrefix + name + ".exe"
+	}
+	return pluginPrefix + name
+}
+
+// FindPlugin returns the path of the plugin executable with the given
+// name, searching the plugin directories in order.
+func FindPlugin(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("patchenv: invalid plugin name %q", name)
+	}
+	for _, dir := range pluginDirs() {
+		path := filepath.Join(dir, pluginFile(name))
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("patchenv: plugin %s not found in %s", name,
+		strings.Join(pluginDirs(), string(filepath.ListSeparator)))
+}
+
+// Plugins returns the names of the plugins in the plugin directories,
+// sorted.
+func Plugins() []string {
+	seen := make(map[string]bool)
+	for _, dir := range pluginDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimPrefix(entry.Name(), pluginPrefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, ".exe")
+			}
+			if name != entry.Name() && name != "" && !entry.IsDir() {
+				seen[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pluginVar is a variable in the envelope ServePlugin writes.
+type pluginVar struct {
+	Name    string     `json:"name"`
+	Value   string     `json:"value"`
+	Secret  bool       `json:"secret,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// ServePlugin implements the plugin side of the PluginSource protocol for a
+// plugin's main function: it reads the request from stdin, calls load, and
+// writes the variables to stdout.  If load returns ErrNoChanges, the plugin
+// reports that there's nothing to change.  ServePlugin returns an error if
+// the program wasn't run by patchenv, or if load fails; the plugin should
+// print it to stderr and exit with an error status.
+func ServePlugin(load func(ctx context.Context, req *PluginRequest) ([]Var, error)) error {
+	if os.Getenv(pluginCookieVar) != pluginCookie {
+		return errors.New("this program is a patchenv plugin and is meant to be run by patchenv")
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	var req PluginRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("invalid plugin request: %w", err)
+	}
+	if req.Version != pluginProtocolVersion {
+		return fmt.Errorf("unsupported plugin protocol version %d", req.Version)
+	}
+
+	vars, err := load(context.Background(), &req)
+	out := struct {
+		Version   int         `json:"version"`
+		Vars      []pluginVar `json:"vars"`
+		Unset     []string    `json:"unset,omitempty"`
+		NoChanges bool        `json:"noChanges,omitempty"`
+	}{Version: protocolVersion, Vars: []pluginVar{}}
+	if errors.Is(err, ErrNoChanges) {
+		out.NoChanges = true
+	} else if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		if v.Unset {
+			out.Unset = append(out.Unset, v.Name)
+			continue
+		}
+		pv := pluginVar{Name: v.Name, Value: v.Value, Secret: v.Secret}
+		if !v.Expires.IsZero() {
+			expires := v.Expires
+			pv.Expires = &expires
+		}
+		out.Vars = append(out.Vars, pv)
+	}
+	return json.NewEncoder(os.Stdout).Encode(&out)
+}
@@ -0,0 +1,164 @@
+package patchenv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// PollingSource is a Source that wraps another Source and makes it a
+// Watcher by polling it, for backends that can't report changes, like
+// most secret managers.  A Refresher polling a PollingSource only patches
+// the environment when the variables actually change.
+//
+// If Version is set, it's polled instead of the wrapped Source, so a
+// backend that has a cheap version check (like a secret's version ID or
+// a parameter's last-modified time) isn't asked for every value each time.
+// Otherwise the wrapped Source is loaded on each poll and the variables are
+// compared with the last ones, ignoring the expiration times set by TTLs
+// and comparing File variables by their files' contents.
+type PollingSource struct {
+	// Source is the wrapped Source.
+	Source Source
+
+	// Interval is how often Wait polls, or zero to poll every minute.
+	Interval time.Duration
+
+	// Version, if not nil, returns the version of the backend's values.
+	// Wait returns when it differs from the version at the last Load.
+	Version func(ctx context.Context) (string, error)
+
+	mu      sync.Mutex
+	version string
+	state   []varState
+
+	// pending holds variables loaded by Wait for the next Load.
+	pending []Var
+	loaded  bool
+}
+
+// Load implements the Source interface.
+func (p *PollingSource) Load(ctx context.Context) ([]Var, error) {
+	p.mu.Lock()
+	if p.loaded {
+		vars := p.pending
+		p.pending, p.loaded = nil, false
+		p.mu.Unlock()
+		return vars, nil
+	}
+	p.mu.Unlock()
+
+	var version string
+	if p.Version != nil {
+		var err error
+		if version, err = p.Version(ctx); err != nil {
+			return nil, err
+		}
+	}
+	vars, err := p.Source.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.version, p.state = version, varStates(vars)
+	p.mu.Unlock()
+	return vars, nil
+}
+
+// Wait implements the Watcher interface.  It returns when the version or
+// the variables change.
+func (p *PollingSource) Wait(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		changed, err := p.poll(ctx)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return nil
+		}
+	}
+}
+
+// poll reports whether the version or variables changed since the last
+// Load.
+func (p *PollingSource) poll(ctx context.Context) (bool, error) {
+	if p.Version != nil {
+		version, err := p.Version(ctx)
+		if err != nil {
+			return false, err
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return version != p.version, nil
+	}
+
+	vars, err := p.Source.Load(ctx)
+	if errors.Is(err, ErrNoChanges) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	state := varStates(vars)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if reflect.DeepEqual(state, p.state) {
+		// The files this load wrote won't be used.
+		removeFiles(vars)
+		return false, nil
+	}
+	p.state = state
+	p.pending, p.loaded = vars, true
+	return true, nil
+}
+
+// varState is the part of a Var that poll compares to detect changes.  The
+// expiration time, which a TTL sets relative to when the variable was
+// loaded, is left out, and a File variable is compared by the contents of
+// its file, since each load writes a new one.
+type varState struct {
+	Name, Value         string
+	Unset, Secret, File bool
+}
+
+// varStates returns the states of vars.
+func varStates(vars []Var) []varState {
+	states := make([]varState, len(vars))
+	for i, v := range vars {
+		states[i] = varState{Name: v.Name, Value: v.Value, Unset: v.Unset, Secret: v.Secret, File: v.File}
+		if v.File {
+			// An unreadable file is compared by its path, so it counts as
+			// a change.
+			if content, err := os.ReadFile(v.Value); err == nil {
+				states[i].Value = string(content)
+			}
+		}
+	}
+	return states
+}
+
+// UsesNetwork implements the NetworkUser interface, reporting whether the
+// wrapped Source uses the network.
+func (p *PollingSource) UsesNetwork() bool {
+	return usesNetwork(p.Source)
+}
+
+// Kind implements the Kinded interface, returning the kind of the wrapped
+// Source.
+func (p *PollingSource) Kind() string {
+	return sourceKind(p.Source)
+}
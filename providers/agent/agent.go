@@ -0,0 +1,274 @@
+// Package agent lets a long-running local agent serve environments to
+// programs quickly, in front of a slow source like a secrets manager that
+// requires interactive login.  Server serves a Source on a Unix domain
+// socket, which "patchenv agent" runs, and Source is the client.
+//
+// The protocol is a single exchange of JSON lines per connection.  The
+// client sends a request:
+//
+//	{"version": 1, "refresh": false}
+//
+// and the server replies with the variables, or an error:
+//
+//	{"version": 1, "vars": [{"name": "A", "value": "1", "secret": true}]}
+//	{"version": 1, "error": "..."}
+//
+// Windows 10 and later support Unix domain sockets, so the same protocol is
+// used there instead of a named pipe.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/arpio/patchenv"
+)
+
+const (
+	// protocolVersion is the version of the agent protocol.
+	protocolVersion = 1
+
+	// SocketVar is the environment variable that names the agent's socket.
+	SocketVar = "PATCH_ENV_AGENT_SOCKET"
+
+	// maxMessage is the largest request or response, in bytes.
+	maxMessage = 16 << 20
+)
+
+// request is the message a client sends.
+type request struct {
+	Version int  `json:"version"`
+	Refresh bool `json:"refresh,omitempty"`
+}
+
+// response is the message the server replies with.
+type response struct {
+	Version   int       `json:"version"`
+	Vars      []wireVar `json:"vars,omitempty"`
+	NoChanges bool      `json:"noChanges,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// wireVar is a patchenv.Var in a response.
+type wireVar struct {
+	Name    string     `json:"name"`
+	Value   string     `json:"value,omitempty"`
+	Unset   bool       `json:"unset,omitempty"`
+	Secret  bool       `json:"secret,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+	File    bool       `json:"file,omitempty"`
+}
+
+// DefaultSocket returns the path of the agent's socket: PATCH_ENV_AGENT_SOCKET
+// if it's set, or "patchenv-agent.sock" in XDG_RUNTIME_DIR, or a name with
+// the user's ID in the temporary directory.
+func DefaultSocket() string {
+	if path := os.Getenv(SocketVar); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "patchenv-agent.sock")
+	}
+	return filepath.Join(os.TempDir(), "patchenv-agent-"+strconv.Itoa(os.Getuid())+".sock")
+}
+
+// Listen listens on the Unix domain socket at path, replacing a stale
+// socket left by an agent that exited.  The socket is only accessible by
+// its owner, from the moment it appears at path.  Listen fails if path is
+// a file that isn't a socket, or a socket that accepts connections.
+func Listen(path string) (net.Listener, error) {
+	if err := checkStale(path); err != nil {
+		return nil, err
+	}
+	return listen(path)
+}
+
+// checkStale returns an error unless path doesn't exist or is a stale
+// socket, one that refuses connections, which can be replaced.
+func checkStale(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("patchenv: %s already exists and isn't a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("patchenv: an agent is already listening on %s", path)
+	}
+	return nil
+}
+
+// Server serves the variables from a Source to agent clients.
+type Server struct {
+	// Source loads the variables.  Wrap it in a patchenv.CachedSource to
+	// serve cached variables; a client's refresh request invalidates the
+	// cache.
+	Source patchenv.Source
+
+	// Timeout limits how long loading the variables may take, or is zero
+	// for no limit.
+	Timeout time.Duration
+}
+
+// Serve accepts connections on l and answers their requests until l is
+// closed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.ServeContext(context.Background(), l)
+}
+
+// ServeContext is like Serve, but loads the variables with ctx, so
+// canceling it stops the loads in progress, for example when the agent is
+// shutting down.
+func (s *Server) ServeContext(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(ctx, conn)
+	}
+}
+
+// handle answers the request on conn.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	var req request
+	resp := response{Version: protocolVersion}
+	if err := json.NewDecoder(&limitedReader{conn, maxMessage}).Decode(&req); err == io.EOF {
+		// The client connected without sending a request, for example to
+		// check whether the agent is running.
+		return
+	} else if err != nil {
+		resp.Error = "invalid request: " + err.Error()
+	} else if req.Version != protocolVersion {
+		resp.Error = fmt.Sprintf("unsupported protocol version %d", req.Version)
+	} else {
+		s.load(ctx, &req, &resp)
+	}
+	if err := json.NewEncoder(conn).Encode(&resp); err != nil {
+		log.Printf("[WARNING] patchenv: can't reply to agent client: %s", err)
+	}
+}
+
+// load fills in resp with the variables from the source.
+func (s *Server) load(ctx context.Context, req *request, resp *response) {
+	if c, ok := s.Source.(*patchenv.CachedSource); ok && req.Refresh {
+		c.Invalidate()
+	}
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	vars, err := s.Source.Load(ctx)
+	switch {
+	case errors.Is(err, patchenv.ErrNoChanges):
+		resp.NoChanges = true
+	case err != nil:
+		resp.Error = err.Error()
+	}
+	for _, v := range vars {
+		wv := wireVar{Name: v.Name, Value: v.Value, Unset: v.Unset, Secret: v.Secret, File: v.File}
+		if !v.Expires.IsZero() {
+			expires := v.Expires
+			wv.Expires = &expires
+		}
+		resp.Vars = append(resp.Vars, wv)
+	}
+}
+
+// Source is a patchenv.Source that loads the variables from an agent.  It
+// refuses to connect to a socket owned by another user.
+type Source struct {
+	// Socket is the path of the agent's socket, or empty to use
+	// DefaultSocket.
+	Socket string
+
+	// Refresh asks the agent to reload the variables instead of serving
+	// cached ones.
+	Refresh bool
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	socket := s.Socket
+	if socket == "" {
+		socket = DefaultSocket()
+	}
+	if err := checkOwner(socket); err != nil {
+		return nil, fmt.Errorf("patchenv: can't connect to the agent: %w", err)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't connect to the agent: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(conn).Encode(&request{Version: protocolVersion, Refresh: s.Refresh}); err != nil {
+		return nil, fmt.Errorf("patchenv: can't send request to the agent: %w", err)
+	}
+	var resp response
+	if err := json.NewDecoder(&limitedReader{conn, maxMessage}).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid response from the agent: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("patchenv: agent: %s", resp.Error)
+	}
+	if resp.NoChanges {
+		return nil, patchenv.ErrNoChanges
+	}
+	vars := make([]patchenv.Var, len(resp.Vars))
+	for i, wv := range resp.Vars {
+		vars[i] = patchenv.Var{Name: wv.Name, Value: wv.Value, Unset: wv.Unset, Secret: wv.Secret, File: wv.File}
+		if wv.Expires != nil {
+			vars[i].Expires = *wv.Expires
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "agent".
+func (s *Source) Kind() string {
+	return "agent"
+}
+
+// limitedReader is an io.Reader that fails after n bytes, so a misbehaving
+// peer can't make the other side buffer without limit.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the io.Reader interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errors.New("message too large")
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,24 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package agent
+
+import (
+	"net"
+	"os"
+)
+
+// listen listens on a new socket at path, replacing a stale socket left by
+// an agent that exited.  On Windows, connecting requires write access to
+// the socket's file, which inherits the ACL of its directory, and the
+// user's temporary directory is private to the user.
+func listen(path string) (net.Listener, error) {
+	_ = os.Remove(path)
+	return net.Listen("unix", path)
+}
+
+// checkOwner does nothing: file ownership can't be checked the same way
+// here, and the socket's directory controls who can create it.
+func checkOwner(path string) error {
+	return nil
+}
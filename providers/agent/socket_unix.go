@@ -0,0 +1,77 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// listen listens on a new socket at path.  The socket is created in a
+// private directory next to path and moved into place once only its owner
+// can use it, so other users can't connect to it in between, like they
+// could if it were made private after it was created.
+func listen(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".patchenv-agent-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed at its final path when the listener is closed.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	err = os.Chmod(tmp, 0o600)
+	if err == nil {
+		// Check again right before replacing path, in case something
+		// appeared there since Listen checked it.
+		err = checkStale(path)
+	}
+	if err == nil {
+		// Rename replaces a stale socket left by an agent that exited.
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		l.Close()
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return &listener{Listener: l, path: path}, nil
+}
+
+// listener is a net.Listener that removes its socket when it's closed.
+type listener struct {
+	net.Listener
+	path string
+}
+
+// Close implements the net.Listener interface.
+func (l *listener) Close() error {
+	_ = os.Remove(l.path)
+	return l.Listener.Close()
+}
+
+// checkOwner returns an error if the file at path isn't a socket owned by
+// the current user.  Another user's socket could belong to a program that
+// serves its own variables, like credentials it controls, to the client.
+func checkOwner(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s isn't a socket", path)
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by user %d, not the current user (%d)", path, st.Uid, os.Getuid())
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package aws bridges patchenv with the AWS SDK credential chain.
+//
+// CredentialProcessSource loads AWS credentials from a credential_process
+// helper, and Credentials converts patched AWS_* variables to the
+// credential_process output format, which the patchenv command uses to act
+// as a credential_process helper itself.  InstanceMetadataSource and
+// TaskMetadataSource read the identity and role credentials of the EC2
+// instance or ECS task a program is running in.
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/arpio/patchenv"
+)
+
+// Names of the environment variables that hold AWS credentials.
+const (
+	AccessKeyIDVar     = "AWS_ACCESS_KEY_ID"
+	SecretAccessKeyVar = "AWS_SECRET_ACCESS_KEY"
+	SessionTokenVar    = "AWS_SESSION_TOKEN"
+
+	// ExpirationVar holds the credentials' expiration time in RFC 3339
+	// format, as set by tools like aws-vault.
+	ExpirationVar = "AWS_CREDENTIAL_EXPIRATION"
+
+	// legacyExpirationVar is the name older tools use for ExpirationVar.
+	legacyExpirationVar = "AWS_SESSION_EXPIRATION"
+)
+
+// credentialProcessVersion is the only version of the credential_process
+// output format.
+const credentialProcessVersion = 1
+
+// Credentials is the JSON document a credential_process helper writes to
+// its standard output.
+type Credentials struct {
+	Version         int        `json:"Version"`
+	AccessKeyID     string     `json:"AccessKeyId"`
+	SecretAccessKey string     `json:"SecretAccessKey"`
+	SessionToken    string     `json:"SessionToken,omitempty"`
+	Expiration      *time.Time `json:"Expiration,omitempty"`
+}
+
+// CredentialsFromResult returns the AWS credentials in the final values of
+// the result's variables.  The expiration time comes from
+// AWS_CREDENTIAL_EXPIRATION (or AWS_SESSION_EXPIRATION) if it's set, or
+// from the expiration of the credential variables otherwise.
+func CredentialsFromResult(result *patchenv.Result) (*Credentials, error) {
+	values := make(map[string]patchenv.Var)
+	for _, v := range result.Vars {
+		if v.Unset {
+			delete(values, v.Name)
+		} else {
+			values[v.Name] = v
+		}
+	}
+
+	creds := &Credentials{
+		Version:         credentialProcessVersion,
+		AccessKeyID:     values[AccessKeyIDVar].Value,
+		SecretAccessKey: values[SecretAccessKeyVar].Value,
+		SessionToken:    values[SessionTokenVar].Value,
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("patchenv: %s and %s must be set", AccessKeyIDVar, SecretAccessKeyVar)
+	}
+
+	expVar, ok := values[ExpirationVar]
+	if !ok {
+		expVar, ok = values[legacyExpirationVar]
+	}
+	if ok && expVar.Value != "" {
+		exp, err := time.Parse(time.RFC3339, expVar.Value)
+		if err != nil {
+			return nil, fmt.Errorf("patchenv: invalid %s: %w", expVar.Name, err)
+		}
+		creds.Expiration = &exp
+	} else {
+		for _, name := range []string{AccessKeyIDVar, SecretAccessKeyVar, SessionTokenVar} {
+			exp := values[name].Expires
+			if !exp.IsZero() && (creds.Expiration == nil || exp.Before(*creds.Expiration)) {
+				creds.Expiration = &exp
+			}
+		}
+	}
+	return creds, nil
+}
+
+// Vars returns the environment variables that hold the credentials.  The
+// secret key and session token are marked secret, and all of the variables
+// expire when the credentials do.
+func (c *Credentials) Vars() []patchenv.Var {
+	var expires time.Time
+	if c.Expiration != nil {
+		expires = *c.Expiration
+	}
+	vars := []patchenv.Var{
+		{Name: AccessKeyIDVar, Value: c.AccessKeyID, Expires: expires},
+		{Name: SecretAccessKeyVar, Value: c.SecretAccessKey, Secret: true, Expires: expires},
+	}
+	if c.SessionToken != "" {
+		vars = append(vars, patchenv.Var{
+			Name: SessionTokenVar, Value: c.SessionToken, Secret: true, Expires: expires,
+		})
+	}
+	if c.Expiration != nil {
+		vars = append(vars, patchenv.Var{
+			Name: ExpirationVar, Value: c.Expiration.Format(time.RFC3339), Expires: expires,
+		})
+	}
+	return vars
+}
+
+// CredentialProcessSource is a patchenv.Source that runs an AWS
+// credential_process helper and sets the AWS_* variables from its output.
+type CredentialProcessSource struct {
+	// Command is the helper's command line, as it would appear in the
+	// credential_process setting of an AWS config file.
+	Command string
+
+	// Runner runs the command, or is nil to use patchenv.DefaultRunner.
+	Runner patchenv.Runner
+}
+
+// Load implements the patchenv.Source interface.
+func (s *CredentialProcessSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	runner := s.Runner
+	if runner == nil {
+		runner = patchenv.DefaultRunner()
+	}
+	out, err := runner.Run(ctx, s.Command, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid credential_process output: %w", err)
+	}
+	if creds.Version != credentialProcessVersion {
+		return nil, fmt.Errorf("patchenv: unsupported credential_process version %d", creds.Version)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("patchenv: credential_process output is missing AccessKeyId or SecretAccessKey")
+	}
+	return creds.Vars(), nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "aws".
+func (s *CredentialProcessSource) Kind() string {
+	return "aws"
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true, since credential_process helpers get credentials from AWS.
+func (s *CredentialProcessSource) UsesNetwork() bool {
+	return true
+}
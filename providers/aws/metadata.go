@@ -0,0 +1,358 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arpio/patchenv"
+)
+
+const (
+	// imdsURL is the address of the EC2 instance metadata service.
+	imdsURL = "http://169.254.169.254"
+
+	// imdsTokenTTL is the lifetime, in seconds, of the IMDSv2 session
+	// tokens InstanceMetadataSource requests.
+	imdsTokenTTL = "300"
+
+	// ecsCredentialsURL is the address of the ECS container credentials
+	// endpoint, which AWS_CONTAINER_CREDENTIALS_RELATIVE_URI is relative
+	// to.
+	ecsCredentialsURL = "http://169.254.170.2"
+)
+
+// defaultInstanceFields are the fields InstanceMetadataSource sets if its
+// Fields are nil.
+var defaultInstanceFields = map[string]string{
+	"AWS_REGION":  "region",
+	"INSTANCE_ID": "instance-id",
+}
+
+// defaultTaskFields are the fields TaskMetadataSource sets if its Fields
+// are nil.
+var defaultTaskFields = map[string]string{
+	"AWS_REGION": "region",
+	"TASK_ARN":   "task-arn",
+}
+
+// InstanceMetadataSource is a patchenv.Source that reads the identity, tags,
+// and IAM role credentials of the EC2 instance it's running on from the
+// instance metadata service, using IMDSv2.
+type InstanceMetadataSource struct {
+	// Fields maps environment variable names to the metadata that sets
+	// them: "region", "instance-id", "instance-type", "account-id",
+	// "availability-zone", "image-id", "private-ip", or "tag:KEY" for the
+	// value of an instance tag (which requires tags in instance metadata
+	// to be enabled).  If it's nil, AWS_REGION and INSTANCE_ID are set.
+	Fields map[string]string
+
+	// Credentials also sets AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+	// AWS_SESSION_TOKEN, and AWS_CREDENTIAL_EXPIRATION from the
+	// instance's IAM role.
+	Credentials bool
+
+	// Endpoint is the URL of the metadata service, or empty to use
+	// AWS_EC2_METADATA_SERVICE_ENDPOINT or http://169.254.169.254.
+	Endpoint string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *InstanceMetadataSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	endpoint := strings.TrimSuffix(firstNonEmpty(s.Endpoint,
+		os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), imdsURL), "/")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid metadata endpoint: %w", err)
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", imdsTokenTTL)
+	token, err := fetch(client, tokenReq)
+	if err != nil {
+		return nil, err
+	}
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return fetch(client, req)
+	}
+
+	doc, err := get("/latest/dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+	var identity struct {
+		Region           string `json:"region"`
+		InstanceID       string `json:"instanceId"`
+		InstanceType     string `json:"instanceType"`
+		AccountID        string `json:"accountId"`
+		AvailabilityZone string `json:"availabilityZone"`
+		ImageID          string `json:"imageId"`
+		PrivateIP        string `json:"privateIp"`
+	}
+	if err := json.Unmarshal(doc, &identity); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid instance identity document: %w", err)
+	}
+	values := map[string]string{
+		"region":            identity.Region,
+		"instance-id":       identity.InstanceID,
+		"instance-type":     identity.InstanceType,
+		"account-id":        identity.AccountID,
+		"availability-zone": identity.AvailabilityZone,
+		"image-id":          identity.ImageID,
+		"private-ip":        identity.PrivateIP,
+	}
+
+	fields := s.Fields
+	if fields == nil {
+		fields = defaultInstanceFields
+	}
+	vars, err := fieldVars(fields, func(field string) (string, error) {
+		if key := strings.TrimPrefix(field, "tag:"); key != field {
+			tag, err := get("/latest/meta-data/tags/instance/" + key)
+			return string(tag), err
+		}
+		value, ok := values[field]
+		if !ok {
+			return "", fmt.Errorf("patchenv: unknown instance metadata field %q", field)
+		}
+		return value, nil
+	})
+	if err != nil || !s.Credentials {
+		return vars, err
+	}
+
+	role, err := get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, err
+	}
+	roleName := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if roleName == "" {
+		return nil, errors.New("patchenv: the instance doesn't have an IAM role")
+	}
+	data, err := get("/latest/meta-data/iam/security-credentials/" + roleName)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := parseMetadataCredentials(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(vars, creds.Vars()...), nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "aws".
+func (s *InstanceMetadataSource) Kind() string {
+	return "aws"
+}
+
+// TaskMetadataSource is a patchenv.Source that reads the metadata and IAM
+// role credentials of the ECS task it's running in, from the endpoints in
+// ECS_CONTAINER_METADATA_URI_V4 and AWS_CONTAINER_CREDENTIALS_RELATIVE_URI
+// (or AWS_CONTAINER_CREDENTIALS_FULL_URI).
+type TaskMetadataSource struct {
+	// Fields maps environment variable names to the metadata that sets
+	// them: "region", "cluster", "task-arn", "family", "revision",
+	// "availability-zone", or "launch-type".  If it's nil, AWS_REGION and
+	// TASK_ARN are set.
+	Fields map[string]string
+
+	// Credentials also sets AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+	// AWS_SESSION_TOKEN, and AWS_CREDENTIAL_EXPIRATION from the task's
+	// IAM role.
+	Credentials bool
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *TaskMetadataSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	get := func(u, auth string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return fetch(client, req)
+	}
+
+	metadataURI := os.Getenv("ECS_CONTAINER_METADATA_URI_V4")
+	if metadataURI == "" {
+		return nil, errors.New("patchenv: ECS_CONTAINER_METADATA_URI_V4 is not set (not running in ECS?)")
+	}
+	data, err := get(metadataURI+"/task", "")
+	if err != nil {
+		return nil, err
+	}
+	var task struct {
+		Cluster          string
+		TaskARN          string
+		Family           string
+		Revision         string
+		AvailabilityZone string
+		LaunchType       string
+	}
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid task metadata: %w", err)
+	}
+	region := ""
+	if parts := strings.Split(task.TaskARN, ":"); len(parts) > 3 {
+		region = parts[3]
+	}
+	values := map[string]string{
+		"region":            region,
+		"cluster":           task.Cluster,
+		"task-arn":          task.TaskARN,
+		"family":            task.Family,
+		"revision":          task.Revision,
+		"availability-zone": task.AvailabilityZone,
+		"launch-type":       task.LaunchType,
+	}
+
+	fields := s.Fields
+	if fields == nil {
+		fields = defaultTaskFields
+	}
+	vars, err := fieldVars(fields, func(field string) (string, error) {
+		value, ok := values[field]
+		if !ok {
+			return "", fmt.Errorf("patchenv: unknown task metadata field %q", field)
+		}
+		return value, nil
+	})
+	if err != nil || !s.Credentials {
+		return vars, err
+	}
+
+	credsURL, auth := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		credsURL = ecsCredentialsURL + rel
+	}
+	if credsURL == "" {
+		return nil, errors.New("patchenv: the task doesn't have an IAM role")
+	}
+	if file := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		token, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("patchenv: can't read the container authorization token: %w", err)
+		}
+		auth = strings.TrimSpace(string(token))
+	}
+	if data, err = get(credsURL, auth); err != nil {
+		return nil, err
+	}
+	creds, err := parseMetadataCredentials(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(vars, creds.Vars()...), nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "aws".
+func (s *TaskMetadataSource) Kind() string {
+	return "aws"
+}
+
+// fieldVars returns a variable for each of fields, sorted by name, with
+// values from lookup.
+func fieldVars(fields map[string]string, lookup func(field string) (string, error)) ([]patchenv.Var, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := make([]patchenv.Var, 0, len(names))
+	for _, name := range names {
+		value, err := lookup(fields[name])
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, patchenv.Var{Name: name, Value: value})
+	}
+	return vars, nil
+}
+
+// parseMetadataCredentials parses the role credentials returned by the EC2
+// and ECS metadata endpoints.
+func parseMetadataCredentials(data []byte) (*Credentials, error) {
+	var c struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      *time.Time
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.AccessKeyID == "" {
+		return nil, errors.New("patchenv: invalid role credentials from the metadata service")
+	}
+	return &Credentials{
+		Version:         credentialProcessVersion,
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+		Expiration:      c.Expiration,
+	}, nil
+}
+
+// fetch sends req and returns the response body, or an error if the
+// response isn't successful.
+func fetch(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't reach the metadata service: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read from the metadata service: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("patchenv: metadata service returned %s for %s", resp.Status, req.URL.Path)
+	}
+	return body, nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *InstanceMetadataSource) UsesNetwork() bool {
+	return true
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *TaskMetadataSource) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,101 @@
+// Package bitwarden provides a patchenv.Source that reads secrets from
+// Bitwarden Secrets Manager with the bws command-line tool, which does the
+// client-side decryption Secrets Manager requires.
+package bitwarden
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Source is a patchenv.Source that sets a variable for each secret in a
+// Bitwarden Secrets Manager project, named after the secret's key.  All of
+// the variables are marked secret.
+type Source struct {
+	// AccessToken is the machine account's access token.  If it's empty,
+	// BWS_ACCESS_TOKEN is used.  It's passed to bws in its environment,
+	// not on its command line.
+	AccessToken string
+
+	// ProjectID is the ID of the project whose secrets are read, or empty
+	// to read all of the secrets the machine account can access.
+	ProjectID string
+
+	// ServerURL is the URL of a self-hosted Bitwarden server, or empty to
+	// use bws's default.
+	ServerURL string
+
+	// Prefix is prepended to each secret's key to make its variable name.
+	Prefix string
+
+	// Path is the path of the bws executable, or empty to look up "bws"
+	// in PATH.
+	Path string
+}
+
+// secret is an element of the output of "bws secret list".
+type secret struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	token := s.AccessToken
+	if token == "" {
+		token = os.Getenv("BWS_ACCESS_TOKEN")
+	}
+	if token == "" {
+		return nil, errors.New("patchenv: a Bitwarden access token is required (set BWS_ACCESS_TOKEN)")
+	}
+
+	path := s.Path
+	if path == "" {
+		path = "bws"
+	}
+	args := []string{"secret", "list"}
+	if s.ProjectID != "" {
+		args = append(args, s.ProjectID)
+	}
+	args = append(args, "--output", "json", "--color", "no")
+	if s.ServerURL != "" {
+		args = append(args, "--server-url", s.ServerURL)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), "BWS_ACCESS_TOKEN="+token)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := patchenv.RunCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("patchenv: bws failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var secrets []secret
+	if err := json.Unmarshal(stdout.Bytes(), &secrets); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid output from bws: %w", err)
+	}
+	vars := make([]patchenv.Var, 0, len(secrets))
+	for _, sec := range secrets {
+		vars = append(vars, patchenv.Var{Name: s.Prefix + sec.Key, Value: sec.Value, Secret: true})
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "bitwarden".
+func (s *Source) Kind() string {
+	return "bitwarden"
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true, since bws fetches the secrets from Bitwarden.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
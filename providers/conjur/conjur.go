@@ -0,0 +1,182 @@
+// Package conjur provides a patchenv.Source that reads variables from
+// CyberArk Conjur.
+package conjur
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Source is a patchenv.Source that retrieves Conjur variables in a single
+// batch request and sets an environment variable for each.  All of the
+// variables are marked secret.
+//
+// Source authenticates with a host's (or user's) API key, or with an access
+// token written to a file by a Conjur authenticator, such as the
+// Kubernetes authenticator sidecar.
+type Source struct {
+	// URL is the Conjur appliance URL.  If it's empty,
+	// CONJUR_APPLIANCE_URL is used.
+	URL string
+
+	// Account is the Conjur account.  If it's empty, CONJUR_ACCOUNT is
+	// used.
+	Account string
+
+	// Login and APIKey authenticate to Conjur.  Host identities have logins
+	// like "host/myapp".  If they're empty, CONJUR_AUTHN_LOGIN and
+	// CONJUR_AUTHN_API_KEY are used.
+	Login  string
+	APIKey string
+
+	// TokenFile names a file holding an access token, used instead of the
+	// login and API key.  If it's empty, CONJUR_AUTHN_TOKEN_FILE is used.
+	TokenFile string
+
+	// Variables maps environment variable names to the IDs of the Conjur
+	// variables that set them, like "myapp/db/password".
+	Variables map[string]string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	// Set it to trust the appliance's certificate.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	baseURL := strings.TrimSuffix(firstNonEmpty(s.URL, os.Getenv("CONJUR_APPLIANCE_URL")), "/")
+	account := firstNonEmpty(s.Account, os.Getenv("CONJUR_ACCOUNT"))
+	if baseURL == "" || account == "" {
+		return nil, errors.New("patchenv: a Conjur source needs a URL and an Account")
+	}
+	if len(s.Variables) == 0 {
+		return nil, nil
+	}
+	token, err := s.token(ctx, baseURL, account)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s.Variables))
+	ids := make([]string, 0, len(s.Variables))
+	for name := range s.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ids = append(ids, resourceID(account, s.Variables[name]))
+	}
+
+	u := baseURL + "/secrets?variable_ids=" + url.QueryEscape(strings.Join(ids, ","))
+	body, err := s.do(ctx, http.MethodGet, u, nil, `Token token="`+base64.StdEncoding.EncodeToString(token)+`"`)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]string
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid response from Conjur: %w", err)
+	}
+
+	vars := make([]patchenv.Var, 0, len(names))
+	for i, name := range names {
+		value, ok := values[ids[i]]
+		if !ok {
+			return nil, fmt.Errorf("patchenv: Conjur didn't return %s", ids[i])
+		}
+		vars = append(vars, patchenv.Var{Name: name, Value: value, Secret: true})
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "conjur".
+func (s *Source) Kind() string {
+	return "conjur"
+}
+
+// token returns an access token, from the token file or by authenticating
+// with the API key.
+func (s *Source) token(ctx context.Context, baseURL, account string) ([]byte, error) {
+	if file := firstNonEmpty(s.TokenFile, os.Getenv("CONJUR_AUTHN_TOKEN_FILE")); file != "" {
+		token, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("patchenv: can't read Conjur token: %w", err)
+		}
+		return token, nil
+	}
+
+	login := firstNonEmpty(s.Login, os.Getenv("CONJUR_AUTHN_LOGIN"))
+	apiKey := firstNonEmpty(s.APIKey, os.Getenv("CONJUR_AUTHN_API_KEY"))
+	if login == "" || apiKey == "" {
+		return nil, errors.New("patchenv: Conjur credentials are required (a login and API key, or a token file)")
+	}
+	u := fmt.Sprintf("%s/authn/%s/%s/authenticate", baseURL,
+		url.PathEscape(account), url.PathEscape(login))
+	return s.do(ctx, http.MethodPost, u, strings.NewReader(apiKey), "")
+}
+
+// do sends a request to Conjur and returns the response body.
+func (s *Source) do(ctx context.Context, method, u string, body io.Reader, auth string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid Conjur URL: %w", err)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't reach Conjur: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read response from Conjur: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(data) > 1024 {
+			data = data[:1024]
+		}
+		return nil, fmt.Errorf("patchenv: Conjur returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// resourceID returns the fully qualified ID of the variable id, which may
+// already be qualified.
+func resourceID(account, id string) string {
+	if strings.Count(id, ":") >= 2 {
+		return id
+	}
+	return account + ":variable:" + id
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,223 @@
+// Package consul provides a patchenv.Source that reads variables from a
+// prefix of Consul's KV store, and can watch it for changes with blocking
+// queries so a patchenv.Refresher picks them up as soon as they're made.
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/providers/internal/kv"
+)
+
+const (
+	// defaultAddress is Consul's default HTTP API address.
+	defaultAddress = "http://127.0.0.1:8500"
+
+	// defaultWaitTime is the default longest time a blocking query waits
+	// for a change.
+	defaultWaitTime = 5 * time.Minute
+)
+
+// KVSource is a patchenv.Source that sets a variable for each key under
+// Prefix in Consul's KV store.  Keys are mapped to variable names by
+// removing the prefix, upper-casing them, and replacing other characters
+// with underscores, so with the prefix "myapp/", "myapp/db/url" sets DB_URL.
+//
+// KVSource implements patchenv.Watcher with Consul's blocking queries.  A
+// KVSource must not be copied after it's first used.
+type KVSource struct {
+	// Address is the URL of the Consul HTTP API.  If it's empty,
+	// CONSUL_HTTP_ADDR or http://127.0.0.1:8500 is used.
+	Address string
+
+	// Token is the ACL token.  If it's empty, CONSUL_HTTP_TOKEN is used.
+	Token string
+
+	// Datacenter is the datacenter to query, or empty for the agent's.
+	Datacenter string
+
+	// Prefix is the prefix of the keys to read, usually ending in "/".
+	Prefix string
+
+	// Name, if not nil, maps a key (without the prefix) to a variable name
+	// instead of the default mapping.  Keys it maps to "" are skipped.
+	Name func(key string) string
+
+	// Secret marks all of the variables secret.
+	Secret bool
+
+	// WaitTime is the longest time a blocking query waits for a change
+	// before it's retried.  If it's zero, 5 minutes is used.
+	WaitTime time.Duration
+
+	// Client makes the HTTP requests, or is nil to use
+	// http.DefaultClient.  Set it to configure TLS.
+	Client *http.Client
+
+	mu      sync.Mutex
+	index   uint64
+	pending []kvPair
+}
+
+// kvPair is an entry in the response to a KV query.
+type kvPair struct {
+	Key   string
+	Value []byte
+}
+
+// Load implements the patchenv.Source interface.
+func (s *KVSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	s.mu.Lock()
+	pairs := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if pairs == nil {
+		var index uint64
+		var err error
+		if pairs, index, err = s.query(ctx, 0); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.index = index
+		s.mu.Unlock()
+	}
+	return s.vars(pairs), nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "consul".
+func (s *KVSource) Kind() string {
+	return "consul"
+}
+
+// Wait implements the patchenv.Watcher interface with blocking queries.
+func (s *KVSource) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	last := s.index
+	s.mu.Unlock()
+
+	for {
+		pairs, index, err := s.query(ctx, last)
+		if err != nil {
+			return err
+		}
+		if index != last || last == 0 {
+			s.mu.Lock()
+			s.index, s.pending = index, pairs
+			if s.pending == nil {
+				s.pending = []kvPair{}
+			}
+			s.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// query reads the keys under the prefix.  If index isn't zero, it's a
+// blocking query that waits for the keys to change after index.  query
+// returns the keys and the index of the response.
+func (s *KVSource) query(ctx context.Context, index uint64) ([]kvPair, uint64, error) {
+	address := s.Address
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = defaultAddress
+	} else if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	params := url.Values{"recurse": {"true"}}
+	if s.Datacenter != "" {
+		params.Set("dc", s.Datacenter)
+	}
+	if index != 0 {
+		wait := s.WaitTime
+		if wait <= 0 {
+			wait = defaultWaitTime
+		}
+		params.Set("index", strconv.FormatUint(index, 10))
+		params.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+	}
+	u := strings.TrimSuffix(address, "/") + "/v1/kv/" +
+		(&url.URL{Path: s.Prefix}).EscapedPath() + "?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("patchenv: invalid Consul address: %w", err)
+	}
+	token := s.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("patchenv: can't query Consul: %w", err)
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if newIndex < index {
+		// The index went backwards, so Consul's state was reset.
+		newIndex = 0
+	}
+	var pairs []kvPair
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+			return nil, 0, fmt.Errorf("patchenv: invalid response from Consul: %w", err)
+		}
+	case http.StatusNotFound:
+		// There are no keys under the prefix.
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, 0, fmt.Errorf("patchenv: Consul returned %s: %s",
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+	return pairs, newIndex, nil
+}
+
+// vars returns the variables for the KV pairs.
+func (s *KVSource) vars(pairs []kvPair) []patchenv.Var {
+	name := s.Name
+	if name == nil {
+		name = kv.Name
+	}
+	var vars []patchenv.Var
+	for _, p := range pairs {
+		key := strings.TrimPrefix(p.Key, s.Prefix)
+		if key == "" || strings.HasSuffix(key, "/") {
+			// Skip the prefix itself and folders.
+			continue
+		}
+		if n := name(key); n != "" {
+			vars = append(vars, patchenv.Var{Name: n, Value: string(p.Value), Secret: s.Secret})
+		}
+	}
+	return vars
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *KVSource) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,171 @@
+// Package container connects patchenv with containers.  Its Runners run
+// the patch command inside an existing container, with "docker exec" (or
+// podman) or "kubectl exec", for resolving the environment the way a
+// deployed service sees it.  Env and WriteEnvFile pass a patched
+// environment to containers that tools create.
+//
+// To mirror a running service's environment locally, run "env" in its
+// container:
+//
+//	patchenv.PatchWith(
+//		patchenv.WithCommand("env"),
+//		patchenv.WithRunner(&container.KubernetesRunner{Pod: "api-7d9c6", Namespace: "prod"}),
+//	)
+//
+// The "env" output is parsed with the line protocol, so values that contain
+// newlines aren't mirrored correctly.  The command runs with the shell in
+// the container, which must accept the POSIX "-c" option unless its
+// arguments are set with patchenv.RegisterShell.
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultShell is the shell that runs the command in the container.
+const defaultShell = "sh"
+
+// DockerRunner is a patchenv.Runner that runs commands in a container with
+// "docker exec".  It works with podman too, with Path set to "podman".
+// The handshake variables are passed with -e.
+type DockerRunner struct {
+	// Container is the name or ID of the container.
+	Container string
+
+	// User is the user to run the command as in the container, or empty
+	// for the container's default.
+	User string
+
+	// Dir is the working directory in the container, or empty for the
+	// container's default.
+	Dir string
+
+	// Shell is the shell that runs the command, or empty for "sh".
+	Shell string
+
+	// Path is the path of the docker executable, or empty to look up
+	// "docker" in PATH.
+	Path string
+}
+
+// Run implements the patchenv.Runner interface.
+func (r *DockerRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	if r.Container == "" {
+		return nil, errors.New("patchenv: a Docker runner needs a Container")
+	}
+	args := []string{"exec", "-i"}
+	if r.User != "" {
+		args = append(args, "--user", r.User)
+	}
+	if r.Dir != "" {
+		args = append(args, "--workdir", r.Dir)
+	}
+	for _, kv := range env {
+		args = append(args, "-e", kv)
+	}
+	shell := pathOr(r.Shell, defaultShell)
+	args = append(append(append(args, r.Container, shell), patchenv.ShellArgs(shell)...), command)
+	return run(ctx, pathOr(r.Path, "docker"), args, command, "container "+r.Container)
+}
+
+// KubernetesRunner is a patchenv.Runner that runs commands in a pod's
+// container with "kubectl exec".  kubectl can't set variables, so the
+// handshake variables are set with env(1) in the container.
+type KubernetesRunner struct {
+	// Pod is the name of the pod, or a resource like "deployment/api" to
+	// pick one of its pods.
+	Pod string
+
+	// Container is the container in the pod, or empty for the pod's
+	// default container.
+	Container string
+
+	// Namespace is the pod's namespace, or empty for the current one.
+	Namespace string
+
+	// Context is the kubeconfig context to use, or empty for the current
+	// one.
+	Context string
+
+	// Shell is the shell that runs the command, or empty for "sh".
+	Shell string
+
+	// Path is the path of the kubectl executable, or empty to look up
+	// "kubectl" in PATH.
+	Path string
+}
+
+// Run implements the patchenv.Runner interface.
+func (r *KubernetesRunner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	if r.Pod == "" {
+		return nil, errors.New("patchenv: a Kubernetes runner needs a Pod")
+	}
+	var args []string
+	if r.Context != "" {
+		args = append(args, "--context", r.Context)
+	}
+	if r.Namespace != "" {
+		args = append(args, "--namespace", r.Namespace)
+	}
+	args = append(args, "exec", "-i", r.Pod)
+	if r.Container != "" {
+		args = append(args, "--container", r.Container)
+	}
+	args = append(args, "--")
+	if len(env) > 0 {
+		args = append(append(args, "env"), env...)
+	}
+	shell := pathOr(r.Shell, defaultShell)
+	args = append(append(append(args, shell), patchenv.ShellArgs(shell)...), command)
+	return run(ctx, pathOr(r.Path, "kubectl"), args, command, "pod "+r.Pod)
+}
+
+// run runs the exec command and returns its output.  where describes the
+// container in errors.
+func run(ctx context.Context, path string, args []string, command, where string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := patchenv.RunCommand(ctx, cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("patchenv command %q in %s timed out: %w", command, where, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == patchenv.NoChangesExitCode {
+		return nil, patchenv.ErrNoChanges
+	}
+	if err != nil {
+		_, _ = patchenv.FailureOutput().Write(stdout.Bytes())
+		_, _ = os.Stderr.Write(stderr.Bytes())
+		return nil, fmt.Errorf("patchenv command %q in %s failed: %q", command, where, err.Error())
+	}
+	return stdout.Bytes(), nil
+}
+
+// pathOr returns path, or def if path is empty.
+func pathOr(path, def string) string {
+	if path == "" {
+		return def
+	}
+	return path
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true, since the command runs in the container, where air-gapped mode's
+// sandbox can't confine it.
+func (r *DockerRunner) UsesNetwork() bool {
+	return true
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true, since kubectl talks to the cluster's API server.
+func (r *KubernetesRunner) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Env returns base, the Env of a Docker container create config (one
+// "name=value" entry per variable), with the variables that changes sets,
+// for launching containers with the patched environment through the Docker
+// API:
+//
+//	config := &dockercontainer.Config{Image: "myapp", Env: []string{"PORT=8080"}}
+//	config.Env = container.Env(config.Env, result.Vars)
+//
+// Names are compared case-sensitively, as they are in Linux containers,
+// whatever the host platform.  The API can't unset a variable that the
+// image sets, so a variable that changes unsets is only removed from base.
+func Env(base []string, changes patchenv.Changes) []string {
+	changed := (&patchenv.Result{Vars: changes}).EnvironFor("linux")
+	names := make(map[string]bool, len(changes))
+	for _, v := range changes {
+		names[v.Name] = true
+	}
+	env := make([]string, 0, len(base)+len(changed))
+	for _, kv := range base {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if !names[name] {
+			env = append(env, kv)
+		}
+	}
+	return append(env, changed...)
+}
+
+// WriteEnvFile writes the variables that changes sets to a file for docker
+// run's --env-file option.  The file is created readable only by its
+// owner and replaced atomically, so a container started while it's being
+// written never sees part of it.  Docker env files can't hold values with
+// newlines, so WriteEnvFile returns an error without writing anything if
+// one does.
+func WriteEnvFile(path string, changes patchenv.Changes) error {
+	var b bytes.Buffer
+	if err := (&patchenv.Result{Vars: changes}).Export(&b, patchenv.FormatDockerEnvFile); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+// Package direnv provides a patchenv.Source that evaluates a direnv .envrc
+// file, so teams can reuse their existing .envrc files with Go programs
+// that use patchenv.
+package direnv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// envrcName is the name of the file direnv evaluates.
+const envrcName = ".envrc"
+
+// ignored are variables that bash changes on its own, which aren't part of
+// the environment the .envrc sets.
+var ignored = map[string]bool{
+	"_": true, "PWD": true, "OLDPWD": true, "SHLVL": true, "SHELLOPTS": true,
+	"BASHOPTS": true, "COLUMNS": true, "LINES": true, "PS1": true,
+}
+
+// script evaluates the .envrc named by $1 (after defining a subset of
+// direnv's standard library) and writes the environment before and after,
+// as NUL-terminated "name=value" records separated by an empty record.
+// Output from the .envrc goes to stderr.
+const script = `
+dump() { local n; for n in $(compgen -e); do printf '%s=%s\0' "$n" "${!n}"; done; }
+has() { type "$1" >/dev/null 2>&1; }
+log_status() { echo "direnv: $*" >&2; }
+log_error() { echo "direnv: error $*" >&2; }
+watch_file() { :; }
+strict_env() { set -euo pipefail; }
+unstrict_env() { set +euo pipefail; }
+expand_path() { local d=$1; [[ $d = /* ]] || d="$PWD/$d"; echo "$d"; }
+PATH_add() { local d; for d in "$@"; do PATH="$(expand_path "$d"):$PATH"; done; export PATH; }
+path_add() { local var=$1 d; shift; for d in "$@"; do d=$(expand_path "$d"); export "$var=$d${!var:+:${!var}}"; done; }
+env_vars_required() { local v; for v in "$@"; do [[ -n ${!v:-} ]] || { log_error "$v is required"; return 1; }; done; }
+dotenv() { local f=${1:-.env}; [[ -f $f ]] || { log_error "$f not found"; return 1; }; set -a; . "$f"; set +a; }
+dotenv_if_exists() { [[ -f ${1:-.env} ]] && dotenv "$@"; return 0; }
+source_env() { local f=$1; [[ -d $f ]] && f=$f/.envrc; local dir; dir=$(cd "$(dirname "$f")" && pwd); pushd "$dir" >/dev/null; . "./$(basename "$f")"; popd >/dev/null; }
+source_env_if_exists() { [[ -f $1 ]] && source_env "$1"; return 0; }
+find_up() { local d=$PWD; while [[ $d != / ]]; do [[ -f $d/$1 ]] && { echo "$d/$1"; return 0; }; d=$(dirname "$d"); done; return 1; }
+source_up() { local f; f=$(cd .. && find_up "${1:-.envrc}") && source_env "$f"; }
+source_up_if_exists() { source_up "$@"; return 0; }
+dump
+printf '\0'
+{ source_env "$1"; } >&2 || exit $?
+dump
+`
+
+// Source is a patchenv.Source that runs an .envrc file with bash, like
+// direnv does, and sets the variables it changes.  Variables the .envrc
+// unsets are unset.  The commonly used functions of direnv's standard
+// library (PATH_add, path_add, dotenv, source_env, source_up,
+// env_vars_required, has, and so on) are available; layout and use
+// aren't.
+type Source struct {
+	// Dir is the directory to look for the .envrc in, or empty for the
+	// current directory.  Like direnv, Source looks in Dir's parent
+	// directories if there isn't one in Dir.
+	Dir string
+
+	// RequireAllowed only evaluates an .envrc that's been approved with
+	// "direnv allow", as direnv itself does.
+	RequireAllowed bool
+
+	// Bash is the path of bash, or empty to look up "bash" in PATH.
+	Bash string
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	path, err := s.find()
+	if err != nil {
+		return nil, err
+	}
+	if s.RequireAllowed {
+		if err := checkAllowed(path); err != nil {
+			return nil, err
+		}
+	}
+
+	bash := s.Bash
+	if bash == "" {
+		bash = "bash"
+	}
+	cmd := exec.CommandContext(ctx, bash, "--noprofile", "--norc", "-c", script, "bash", path)
+	cmd.Dir = filepath.Dir(path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := patchenv.RunCommand(ctx, cmd); err != nil {
+		_, _ = os.Stderr.Write(stderr.Bytes())
+		return nil, fmt.Errorf("patchenv: %s failed: %w", path, err)
+	}
+
+	parts := bytes.SplitN(stdout.Bytes(), []byte("\x00\x00"), 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("patchenv: can't read the environment from %s", path)
+	}
+	before, after := records(parts[0]), records(parts[1])
+
+	var vars []patchenv.Var
+	for _, name := range after.names {
+		if ignored[name] || strings.HasPrefix(name, "DIRENV_") {
+			continue
+		}
+		if value, ok := before.values[name]; !ok || value != after.values[name] {
+			vars = append(vars, patchenv.Var{Name: name, Value: after.values[name]})
+		}
+	}
+	for _, name := range before.names {
+		if _, ok := after.values[name]; !ok && !ignored[name] {
+			vars = append(vars, patchenv.Var{Name: name, Unset: true})
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "direnv".
+func (s *Source) Kind() string {
+	return "direnv"
+}
+
+// find returns the path of the .envrc in Dir or its nearest parent.
+func (s *Source) find() (string, error) {
+	dir := s.Dir
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, envrcName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("patchenv: no %s found", envrcName)
+		}
+		dir = parent
+	}
+}
+
+// environ is an environment read from the script's output.
+type environ struct {
+	names  []string
+	values map[string]string
+}
+
+// records parses NUL-terminated "name=value" records.
+func records(data []byte) environ {
+	env := environ{values: make(map[string]string)}
+	trimmed := bytes.TrimPrefix(data, []byte{0})
+	for _, rec := range bytes.Split(trimmed, []byte{0}) {
+		parts := strings.SplitN(string(rec), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		if _, dup := env.values[parts[0]]; !dup {
+			env.names = append(env.names, parts[0])
+		}
+		env.values[parts[0]] = parts[1]
+	}
+	return env
+}
+
+// checkAllowed returns an error unless the .envrc at path has been approved
+// with "direnv allow", which records a hash of its path and contents.
+func checkAllowed(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, _ = io.WriteString(h, path+"\n")
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "direnv", "allow", hash)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("patchenv: %s is blocked; run \"direnv allow\" to approve it", path)
+		}
+		return err
+	}
+	return nil
+}
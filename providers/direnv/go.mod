@@ -0,0 +1,7 @@
+module github.com/arpio/patchenv/providers/direnv
+
+go 1.17
+
+require github.com/arpio/patchenv v1.0.0
+
+replace github.com/arpio/patchenv => ../..
@@ -0,0 +1,123 @@
+// Package doppler provides a patchenv.Source that downloads the secrets of
+// a Doppler project's config.
+package doppler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultBaseURL is the URL of Doppler's API.
+const defaultBaseURL = "https://api.doppler.com"
+
+// Source is a patchenv.Source that sets a variable for each secret in a
+// Doppler config.  All of the variables are marked secret.
+//
+// Doppler's API is rate limited, so programs that refresh their environment
+// should wrap the Source in a patchenv.CachedSource:
+//
+//	src := &patchenv.CachedSource{Source: &doppler.Source{}, TTL: time.Minute}
+type Source struct {
+	// Token authenticates to Doppler.  A service token is scoped to a
+	// single config, so Project and Config aren't needed with one.  If
+	// it's empty, DOPPLER_TOKEN is used.
+	Token string
+
+	// Project and Config select the config to download when Token isn't a
+	// service token.  If they're empty, DOPPLER_PROJECT and DOPPLER_CONFIG
+	// are used.
+	Project string
+	Config  string
+
+	// BaseURL is the URL of the Doppler API, or empty to use
+	// https://api.doppler.com.
+	BaseURL string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	token := firstNonEmpty(s.Token, os.Getenv("DOPPLER_TOKEN"))
+	if token == "" {
+		return nil, errors.New("patchenv: a Doppler token is required (set DOPPLER_TOKEN)")
+	}
+	params := url.Values{"format": {"json"}}
+	if project := firstNonEmpty(s.Project, os.Getenv("DOPPLER_PROJECT")); project != "" {
+		params.Set("project", project)
+	}
+	if config := firstNonEmpty(s.Config, os.Getenv("DOPPLER_CONFIG")); config != "" {
+		params.Set("config", config)
+	}
+	u := strings.TrimSuffix(firstNonEmpty(s.BaseURL, defaultBaseURL), "/") +
+		"/v3/configs/config/secrets/download?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid Doppler URL: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't download Doppler secrets: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("patchenv: Doppler returned %s: %s",
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var secrets map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&secrets); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid response from Doppler: %w", err)
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := make([]patchenv.Var, len(names))
+	for i, name := range names {
+		vars[i] = patchenv.Var{Name: name, Value: secrets[name], Secret: true}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "doppler".
+func (s *Source) Kind() string {
+	return "doppler"
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,83 @@
+// Package envchain provides a patchenv.Source for the secrets stored by
+// envchain (https://github.com/sorah/envchain), so its users can move to
+// patchenv without entering their secrets again.
+//
+// envchain keeps each namespace in the macOS Keychain or, on Linux, in the
+// D-Bus secret service.  Source runs envchain itself to read them, so the
+// keychain prompts and access controls envchain set up still apply.
+package envchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Source is a patchenv.Source that sets the variables stored in envchain
+// namespaces.  All of the variables are marked secret.
+type Source struct {
+	// Namespaces are the envchain namespaces to read.  If a variable is
+	// in more than one namespace, the value from the later one wins.
+	Namespaces []string
+
+	// Path is the path of the envchain executable, or empty to look up
+	// "envchain" in PATH.
+	Path string
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	if len(s.Namespaces) == 0 {
+		return nil, fmt.Errorf("patchenv: no envchain namespaces")
+	}
+	for _, ns := range s.Namespaces {
+		if ns == "" || strings.Contains(ns, ",") {
+			return nil, fmt.Errorf("patchenv: invalid envchain namespace %q", ns)
+		}
+	}
+	path := s.Path
+	if path == "" {
+		path = "envchain"
+	}
+
+	// envchain adds the namespaces' variables to the environment of the
+	// command it runs, so the secrets are the variables that differ from
+	// the environment it was given.
+	base := os.Environ()
+	cmd := exec.CommandContext(ctx, path, strings.Join(s.Namespaces, ","), "env", "-0")
+	cmd.Env = base
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := patchenv.RunCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("patchenv: envchain failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	before := make(map[string]string, len(base))
+	for _, kv := range base {
+		if i := strings.Index(kv, "="); i > 0 {
+			before[kv[:i]] = kv[i+1:]
+		}
+	}
+	var vars []patchenv.Var
+	for _, rec := range bytes.Split(stdout.Bytes(), []byte{0}) {
+		parts := strings.SplitN(string(rec), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		if value, ok := before[parts[0]]; ok && value == parts[1] {
+			continue
+		}
+		vars = append(vars, patchenv.Var{Name: parts[0], Value: parts[1], Secret: true})
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "envchain".
+func (s *Source) Kind() string {
+	return "envchain"
+}
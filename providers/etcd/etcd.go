@@ -0,0 +1,276 @@
+// Package etcd provides a patchenv.Source that reads variables from a key
+// prefix in etcd through its v3 JSON gateway, and can watch the prefix for
+// changes so a patchenv.Refresher picks them up as soon as they're made.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/providers/internal/kv"
+)
+
+// defaultEndpoint is etcd's default client URL.
+const defaultEndpoint = "http://127.0.0.1:2379"
+
+// KVSource is a patchenv.Source that sets a variable for each key under
+// Prefix in etcd.  Keys are mapped to variable names by removing the
+// prefix, upper-casing them, and replacing other characters with
+// underscores, so with the prefix "/myapp/", "/myapp/db/url" sets DB_URL.
+//
+// KVSource implements patchenv.Watcher with etcd's watch API.  A KVSource
+// must not be copied after it's first used.
+type KVSource struct {
+	// Endpoint is the URL of an etcd server.  If it's empty, the first
+	// URL in ETCDCTL_ENDPOINTS or http://127.0.0.1:2379 is used.
+	Endpoint string
+
+	// Username and Password authenticate to etcd, if Username isn't empty.
+	Username string
+	Password string
+
+	// Prefix is the prefix of the keys to read.
+	Prefix string
+
+	// Name, if not nil, maps a key (without the prefix) to a variable name
+	// instead of the default mapping.  Keys it maps to "" are skipped.
+	Name func(key string) string
+
+	// Secret marks all of the variables secret.
+	Secret bool
+
+	// Client makes the HTTP requests, or is nil to use
+	// http.DefaultClient.  Set it to configure TLS.
+	Client *http.Client
+
+	mu       sync.Mutex
+	revision int64
+}
+
+// rangeResponse is the response to a range request.
+type rangeResponse struct {
+	Header struct {
+		Revision int64 `json:"revision,string"`
+	} `json:"header"`
+	KVs []struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+// watchResponse is a message in the stream returned by a watch request.
+type watchResponse struct {
+	Result struct {
+		Created  bool              `json:"created"`
+		Canceled bool              `json:"canceled"`
+		Events   []json.RawMessage `json:"events"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Load implements the patchenv.Source interface.
+func (s *KVSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	var resp rangeResponse
+	err := s.post(ctx, "/v3/kv/range", map[string][]byte{
+		"key":       rangeKey(s.Prefix),
+		"range_end": prefixEnd(s.Prefix),
+	}, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.revision = resp.Header.Revision
+	s.mu.Unlock()
+
+	name := s.Name
+	if name == nil {
+		name = kv.Name
+	}
+	var vars []patchenv.Var
+	for _, pair := range resp.KVs {
+		key := strings.TrimPrefix(string(pair.Key), s.Prefix)
+		if key == "" {
+			continue
+		}
+		if n := name(key); n != "" {
+			vars = append(vars, patchenv.Var{Name: n, Value: string(pair.Value), Secret: s.Secret})
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "etcd".
+func (s *KVSource) Kind() string {
+	return "etcd"
+}
+
+// Wait implements the patchenv.Watcher interface.  It returns after the
+// first change to a key under the prefix since the last Load.
+func (s *KVSource) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	revision := s.revision
+	s.mu.Unlock()
+	if revision == 0 {
+		// Nothing has been loaded yet.
+		return nil
+	}
+
+	// The watch stream doesn't end on its own, so cancel it once there's
+	// an event.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req := map[string]interface{}{
+		"create_request": map[string]interface{}{
+			"key":            rangeKey(s.Prefix),
+			"range_end":      prefixEnd(s.Prefix),
+			"start_revision": strconv.FormatInt(revision+1, 10),
+		},
+	}
+	return s.post(ctx, "/v3/watch", req, func(body io.Reader) error {
+		dec := json.NewDecoder(body)
+		for {
+			var msg watchResponse
+			if err := dec.Decode(&msg); err != nil {
+				return fmt.Errorf("patchenv: etcd watch failed: %w", err)
+			}
+			switch {
+			case msg.Error != nil:
+				return fmt.Errorf("patchenv: etcd watch failed: %s", msg.Error.Message)
+			case msg.Result.Canceled:
+				// The revision was compacted, so reload everything.
+				return nil
+			case len(msg.Result.Events) > 0:
+				return nil
+			}
+		}
+	})
+}
+
+// post sends a JSON request to the etcd gateway and passes the response
+// body to read if the request succeeds.
+func (s *KVSource) post(ctx context.Context, path string, body interface{}, read func(io.Reader) error) error {
+	endpoint := s.endpoint()
+	header := http.Header{"Content-Type": {"application/json"}}
+	if s.Username != "" {
+		token, err := s.authenticate(ctx, endpoint)
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", token)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("patchenv: invalid etcd endpoint: %w", err)
+	}
+	req.Header = header
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("patchenv: can't query etcd: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("patchenv: etcd returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return read(resp.Body)
+}
+
+// authenticate returns a token for the username and password.
+func (s *KVSource) authenticate(ctx context.Context, endpoint string) (string, error) {
+	data, err := json.Marshal(map[string]string{"name": s.Username, "password": s.Password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("patchenv: invalid etcd endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("patchenv: can't authenticate to etcd: %w", err)
+	}
+	defer resp.Body.Close()
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("patchenv: can't authenticate to etcd: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil || auth.Token == "" {
+		return "", errors.New("patchenv: can't authenticate to etcd: invalid response")
+	}
+	return auth.Token, nil
+}
+
+// endpoint returns the URL of the etcd server, without a trailing slash.
+func (s *KVSource) endpoint() string {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = strings.Split(os.Getenv("ETCDCTL_ENDPOINTS"), ",")[0]
+	}
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	} else if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// rangeKey returns the first key of the range of keys that start with
+// prefix.  etcd treats an empty key as missing, so the range of all keys
+// starts at "\x00".
+func rangeKey(prefix string) []byte {
+	if prefix == "" {
+		return []byte{0}
+	}
+	return []byte(prefix)
+}
+
+// prefixEnd returns the end of the range of keys that start with prefix,
+// which is the prefix with its last byte incremented.  An empty prefix
+// ranges over all keys.
+func prefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *KVSource) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,126 @@
+// Package fly provides a patchenv.Source that reads the environment of a
+// Fly.io app's Machines with the Machines API.
+package fly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultBaseURL is the URL of the Machines API.
+const defaultBaseURL = "https://api.machines.dev"
+
+// Source is a patchenv.Source that sets the variables in the env section of
+// a Fly.io app's Machine configuration, which comes from the [env] section
+// of fly.toml.  Fly.io secrets can't be read back through the API, so
+// they aren't included.
+type Source struct {
+	// App is the name of the app.  If it's empty, FLY_APP_NAME is used.
+	App string
+
+	// Token authenticates to the API.  If it's empty, FLY_API_TOKEN is
+	// used.
+	Token string
+
+	// ProcessGroup selects the Machines of a process group, like "app" or
+	// "worker".  If it's empty, the first Machine's environment is used.
+	ProcessGroup string
+
+	// BaseURL is the URL of the Machines API, or empty to use
+	// https://api.machines.dev.
+	BaseURL string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// machine is an element of the Machines API's list of Machines.
+type machine struct {
+	Config struct {
+		Env      map[string]string `json:"env"`
+		Metadata map[string]string `json:"metadata"`
+	} `json:"config"`
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	app := firstNonEmpty(s.App, os.Getenv("FLY_APP_NAME"))
+	token := firstNonEmpty(s.Token, os.Getenv("FLY_API_TOKEN"))
+	if app == "" || token == "" {
+		return nil, errors.New("patchenv: a Fly.io source needs an app and a token (set FLY_APP_NAME and FLY_API_TOKEN)")
+	}
+
+	u := strings.TrimSuffix(firstNonEmpty(s.BaseURL, defaultBaseURL), "/") +
+		"/v1/apps/" + url.PathEscape(app) + "/machines"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid Fly.io API URL: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't reach the Fly.io API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("patchenv: Fly.io returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var machines []machine
+	if err := json.NewDecoder(resp.Body).Decode(&machines); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid response from Fly.io: %w", err)
+	}
+	for _, m := range machines {
+		if s.ProcessGroup != "" && m.Config.Metadata["fly_process_group"] != s.ProcessGroup {
+			continue
+		}
+		names := make([]string, 0, len(m.Config.Env))
+		for name := range m.Config.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		vars := make([]patchenv.Var, len(names))
+		for i, name := range names {
+			vars[i] = patchenv.Var{Name: name, Value: m.Config.Env[name]}
+		}
+		return vars, nil
+	}
+	return nil, fmt.Errorf("patchenv: Fly.io app %s has no matching Machines", app)
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "fly".
+func (s *Source) Kind() string {
+	return "fly"
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,179 @@
+// Package gcp provides a patchenv.Source that reads from the metadata
+// server available to Compute Engine, GKE, Cloud Run, and Cloud Functions
+// workloads.
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultHost is the metadata server's host name.
+const defaultHost = "metadata.google.internal"
+
+// defaultFields are the fields MetadataSource sets if its Fields are nil.
+var defaultFields = map[string]string{
+	"GOOGLE_CLOUD_PROJECT": "project-id",
+}
+
+// fieldPaths maps MetadataSource field names to their paths under
+// /computeMetadata/v1/.
+var fieldPaths = map[string]string{
+	"project-id":         "project/project-id",
+	"numeric-project-id": "project/numeric-project-id",
+	"zone":               "instance/zone",
+	"region":             "instance/region",
+	"instance-id":        "instance/id",
+	"instance-name":      "instance/name",
+	"hostname":           "instance/hostname",
+	"service-account":    "instance/service-accounts/default/email",
+}
+
+// MetadataSource is a patchenv.Source that sets variables from the GCP
+// metadata server, and can set one to an access token for the workload's
+// service account.
+type MetadataSource struct {
+	// Fields maps environment variable names to the metadata that sets
+	// them: "project-id", "numeric-project-id", "zone", "region",
+	// "instance-id", "instance-name", "hostname", "service-account",
+	// "attribute:KEY" for custom instance metadata, or
+	// "project-attribute:KEY" for custom project metadata.  If it's nil,
+	// GOOGLE_CLOUD_PROJECT is set.  Zones and regions are set to their
+	// short names, like "us-central1-a".
+	Fields map[string]string
+
+	// AccessTokenVar, if not empty, is set to an OAuth access token for
+	// the default service account, which expires when the token does.
+	AccessTokenVar string
+
+	// Scopes are the OAuth scopes to request for the access token, or
+	// empty for the service account's default scopes.
+	Scopes []string
+
+	// Host is the metadata server's host, or empty to use
+	// GCE_METADATA_HOST or metadata.google.internal.
+	Host string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *MetadataSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	fields := s.Fields
+	if fields == nil {
+		fields = defaultFields
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var vars []patchenv.Var
+	for _, name := range names {
+		field := fields[name]
+		p, ok := fieldPaths[field]
+		switch {
+		case ok:
+		case strings.HasPrefix(field, "attribute:"):
+			p = "instance/attributes/" + url.PathEscape(strings.TrimPrefix(field, "attribute:"))
+		case strings.HasPrefix(field, "project-attribute:"):
+			p = "project/attributes/" + url.PathEscape(strings.TrimPrefix(field, "project-attribute:"))
+		default:
+			return nil, fmt.Errorf("patchenv: unknown GCP metadata field %q", field)
+		}
+		value, err := s.get(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if field == "zone" || field == "region" {
+			value = path.Base(value)
+		}
+		vars = append(vars, patchenv.Var{Name: name, Value: value})
+	}
+
+	if s.AccessTokenVar != "" {
+		p := "instance/service-accounts/default/token"
+		if len(s.Scopes) > 0 {
+			p += "?scopes=" + url.QueryEscape(strings.Join(s.Scopes, ","))
+		}
+		data, err := s.get(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		var token struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := json.Unmarshal([]byte(data), &token); err != nil || token.AccessToken == "" {
+			return nil, fmt.Errorf("patchenv: invalid access token from the metadata server")
+		}
+		v := patchenv.Var{Name: s.AccessTokenVar, Value: token.AccessToken, Secret: true}
+		if token.ExpiresIn > 0 {
+			v.Expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "gcp".
+func (s *MetadataSource) Kind() string {
+	return "gcp"
+}
+
+// get returns the metadata at p, which is relative to /computeMetadata/v1/.
+func (s *MetadataSource) get(ctx context.Context, p string) (string, error) {
+	host := firstNonEmpty(s.Host, os.Getenv("GCE_METADATA_HOST"), defaultHost)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/computeMetadata/v1/"+p, nil)
+	if err != nil {
+		return "", fmt.Errorf("patchenv: invalid metadata server host: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("patchenv: can't reach the GCP metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("patchenv: can't read from the GCP metadata server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("patchenv: GCP metadata server returned %s for %s", resp.Status, req.URL.Path)
+	}
+	return string(body), nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *MetadataSource) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,110 @@
+// Package heroku provides a patchenv.Source that reads a Heroku app's
+// config vars with the Platform API, so local runs can mirror an app's
+// configuration.
+package heroku
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultBaseURL is the URL of the Heroku Platform API.
+const defaultBaseURL = "https://api.heroku.com"
+
+// Source is a patchenv.Source that sets a variable for each of a Heroku
+// app's config vars.  Config vars often hold credentials, so all of the
+// variables are marked secret.
+type Source struct {
+	// App is the name of the app.  If it's empty, HEROKU_APP is used, so
+	// setting it is all a local run needs to mirror an app's config.
+	App string
+
+	// APIKey authenticates to the API.  If it's empty, HEROKU_API_KEY is
+	// used.
+	APIKey string
+
+	// BaseURL is the URL of the Platform API, or empty to use
+	// https://api.heroku.com.
+	BaseURL string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	app := firstNonEmpty(s.App, os.Getenv("HEROKU_APP"))
+	apiKey := firstNonEmpty(s.APIKey, os.Getenv("HEROKU_API_KEY"))
+	if app == "" || apiKey == "" {
+		return nil, errors.New("patchenv: a Heroku source needs an app and an API key (set HEROKU_APP and HEROKU_API_KEY)")
+	}
+
+	u := strings.TrimSuffix(firstNonEmpty(s.BaseURL, defaultBaseURL), "/") +
+		"/apps/" + url.PathEscape(app) + "/config-vars"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid Heroku API URL: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't reach the Heroku API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("patchenv: Heroku returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var config map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid response from Heroku: %w", err)
+	}
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := make([]patchenv.Var, len(names))
+	for i, name := range names {
+		vars[i] = patchenv.Var{Name: name, Value: config[name], Secret: true}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "heroku".
+func (s *Source) Kind() string {
+	return "heroku"
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
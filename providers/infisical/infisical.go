@@ -0,0 +1,195 @@
+// Package infisical provides a patchenv.Source that reads secrets from an
+// Infisical project, authenticating as a machine identity.
+package infisical
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// defaultSiteURL is the URL of Infisical Cloud.
+const defaultSiteURL = "https://app.infisical.com"
+
+// Source is a patchenv.Source that sets a variable for each secret in an
+// Infisical project's environment.  All of the variables are marked secret.
+type Source struct {
+	// SiteURL is the URL of the Infisical instance, or empty to use
+	// Infisical Cloud.
+	SiteURL string
+
+	// ClientID and ClientSecret are a machine identity's Universal Auth
+	// credentials.  If they're empty,
+	// INFISICAL_UNIVERSAL_AUTH_CLIENT_ID and
+	// INFISICAL_UNIVERSAL_AUTH_CLIENT_SECRET are used.
+	ClientID     string
+	ClientSecret string
+
+	// Token is an access token to use instead of logging in with the
+	// client ID and secret.  If it's empty, INFISICAL_TOKEN is used.
+	Token string
+
+	// ProjectID is the ID of the project (workspace) to read.
+	ProjectID string
+
+	// Environment is the slug of the environment to read, like "dev" or
+	// "prod".
+	Environment string
+
+	// Path is the folder of the secrets to read, or empty for "/".
+	Path string
+
+	// Recursive also reads the secrets in Path's subfolders.
+	Recursive bool
+
+	// Prefix is prepended to each secret's key to make its variable name.
+	Prefix string
+
+	// Rename maps secret keys to variable names, overriding Prefix.  Keys
+	// renamed to "" are skipped.
+	Rename map[string]string
+
+	// Client makes the HTTP requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	if s.ProjectID == "" || s.Environment == "" {
+		return nil, errors.New("patchenv: an Infisical source needs a ProjectID and an Environment")
+	}
+	token, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	path := s.Path
+	if path == "" {
+		path = "/"
+	}
+	params := url.Values{
+		"workspaceId": {s.ProjectID},
+		"environment": {s.Environment},
+		"secretPath":  {path},
+	}
+	if s.Recursive {
+		params.Set("recursive", "true")
+	}
+	var resp struct {
+		Secrets []struct {
+			Key   string `json:"secretKey"`
+			Value string `json:"secretValue"`
+		} `json:"secrets"`
+	}
+	if err := s.call(ctx, http.MethodGet, "/api/v3/secrets/raw?"+params.Encode(), token, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	var vars []patchenv.Var
+	for _, secret := range resp.Secrets {
+		name, ok := s.Rename[secret.Key]
+		if !ok {
+			name = s.Prefix + secret.Key
+		}
+		if name != "" {
+			vars = append(vars, patchenv.Var{Name: name, Value: secret.Value, Secret: true})
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "infisical".
+func (s *Source) Kind() string {
+	return "infisical"
+}
+
+// token returns the access token, logging in if there isn't one.
+func (s *Source) token(ctx context.Context) (string, error) {
+	if token := firstNonEmpty(s.Token, os.Getenv("INFISICAL_TOKEN")); token != "" {
+		return token, nil
+	}
+	clientID := firstNonEmpty(s.ClientID, os.Getenv("INFISICAL_UNIVERSAL_AUTH_CLIENT_ID"))
+	clientSecret := firstNonEmpty(s.ClientSecret, os.Getenv("INFISICAL_UNIVERSAL_AUTH_CLIENT_SECRET"))
+	if clientID == "" || clientSecret == "" {
+		return "", errors.New("patchenv: Infisical machine identity credentials are required")
+	}
+
+	var login struct {
+		AccessToken string `json:"accessToken"`
+	}
+	body := map[string]string{"clientId": clientID, "clientSecret": clientSecret}
+	if err := s.call(ctx, http.MethodPost, "/api/v1/auth/universal-auth/login", "", body, &login); err != nil {
+		return "", err
+	}
+	if login.AccessToken == "" {
+		return "", errors.New("patchenv: Infisical login didn't return an access token")
+	}
+	return login.AccessToken, nil
+}
+
+// call sends a request to the Infisical API and decodes the JSON response
+// into out.
+func (s *Source) call(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	u := strings.TrimSuffix(firstNonEmpty(s.SiteURL, defaultSiteURL), "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("patchenv: invalid Infisical URL: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("patchenv: can't reach Infisical: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("patchenv: Infisical returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("patchenv: invalid response from Infisical: %w", err)
+	}
+	return nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
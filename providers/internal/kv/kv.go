@@ -0,0 +1,23 @@
+// Package kv holds helpers shared by the key-value store providers.
+package kv
+
+import (
+	"strings"
+)
+
+// Name returns the environment variable name for a key in a key-value
+// store, after the key's prefix has been removed: "db/url" becomes
+// "DB_URL".  Characters that aren't letters, digits, or underscores are
+// replaced with underscores.
+func Name(key string) string {
+	key = strings.Trim(key, "/")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
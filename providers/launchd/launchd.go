@@ -0,0 +1,93 @@
+// Package launchd shares variables with the launchd user environment on
+// macOS, which is the environment of apps started from the Finder, the
+// Dock, or Spotlight.  Those apps don't read shell profiles, so this is the
+// way to give them patched variables, and to read variables set for them
+// with "launchctl setenv".
+package launchd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// launchctl runs the launchctl command with args and returns its output.
+func launchctl(ctx context.Context, path string, args ...string) ([]byte, error) {
+	if path == "" {
+		path = "launchctl"
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := patchenv.RunCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("patchenv: launchctl %s failed: %w: %s",
+			args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Source is a patchenv.Source that reads variables from the launchd user
+// environment with "launchctl getenv".  launchctl can't list the
+// environment, so the variables to read must be named.  launchctl doesn't
+// distinguish unset and empty variables, so empty variables are skipped.
+type Source struct {
+	// Names are the names of the variables to read.
+	Names []string
+
+	// Path is the path of the launchctl executable, or empty to look up
+	// "launchctl" in PATH.
+	Path string
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	var vars []patchenv.Var
+	for _, name := range s.Names {
+		out, err := launchctl(ctx, s.Path, "getenv", name)
+		if err != nil {
+			return nil, err
+		}
+		if value := strings.TrimSuffix(string(out), "\n"); value != "" {
+			vars = append(vars, patchenv.Var{Name: name, Value: value})
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "launchd".
+func (s *Source) Kind() string {
+	return "launchd"
+}
+
+// Export sets and unsets vars in the launchd user environment with
+// "launchctl setenv" and "launchctl unsetenv", so apps started afterwards
+// see them.  Apps that are already running keep their environment.  Pass
+// the Vars of the Result returned by patchenv.PatchWith or patchenv.Resolve
+// to share a patched environment:
+//
+//	result, err := patchenv.PatchWith()
+//	if err == nil {
+//		err = launchd.Export(ctx, "", result.Vars)
+//	}
+//
+// path is the path of the launchctl executable, or empty to look up
+// "launchctl" in PATH.  The values are visible to every process of the
+// user, so consider leaving secret variables out.
+func Export(ctx context.Context, path string, vars []patchenv.Var) error {
+	for _, v := range vars {
+		var err error
+		if v.Unset {
+			_, err = launchctl(ctx, path, "unsetenv", v.Name)
+		} else {
+			_, err = launchctl(ctx, path, "setenv", v.Name, v.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
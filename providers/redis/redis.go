@@ -0,0 +1,180 @@
+// Package redis provides a patchenv.Source that reads variables from a
+// Redis hash, or from the string keys that start with a prefix.
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/arpio/patchenv"
+	"github.com/arpio/patchenv/providers/internal/kv"
+)
+
+// defaultURL is the URL used if neither Source.URL nor REDIS_URL is set.
+const defaultURL = "redis://127.0.0.1:6379"
+
+// scanCount is the number of keys a SCAN command asks for at a time.
+const scanCount = 100
+
+// Source is a patchenv.Source that reads variables from Redis.  If Key is
+// set, each field of the hash at Key sets a variable; otherwise each string
+// key that starts with Prefix does.  Field and key names are mapped to
+// variable names by removing the prefix, upper-casing them, and replacing
+// other characters with underscores, so "db_url" and "myapp:db_url" (with
+// the prefix "myapp:") both set DB_URL.
+type Source struct {
+	// URL is the address of the Redis server, in the form
+	// "redis://[user:password@]host[:port][/db]".  The "rediss" scheme
+	// connects with TLS.  If it's empty, REDIS_URL or
+	// redis://127.0.0.1:6379 is used.
+	URL string
+
+	// Username and Password, if Password isn't empty, are used to
+	// authenticate instead of the ones in the URL.
+	Username string
+	Password string
+
+	// TLSConfig configures TLS for "rediss" URLs, or is nil to use the
+	// default configuration.
+	TLSConfig *tls.Config
+
+	// Key is the key of the hash to read.
+	Key string
+
+	// Prefix is the prefix of the string keys to read if Key is empty.
+	Prefix string
+
+	// Name, if not nil, maps a field or key (without the prefix) to a
+	// variable name instead of the default mapping.  Names it maps to ""
+	// are skipped.
+	Name func(key string) string
+
+	// Secret marks all of the variables secret.
+	Secret bool
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	if s.Key == "" && s.Prefix == "" {
+		return nil, errors.New("patchenv: a Redis source needs a Key or a Prefix")
+	}
+	c, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var pairs []string
+	if s.Key != "" {
+		pairs, err = c.strings("HGETALL", s.Key)
+	} else {
+		pairs, err = c.scanPrefix(s.Prefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read from Redis: %w", err)
+	}
+
+	name := s.Name
+	if name == nil {
+		name = kv.Name
+	}
+	var vars []patchenv.Var
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key := strings.TrimPrefix(pairs[i], s.Prefix)
+		if n := name(key); n != "" {
+			vars = append(vars, patchenv.Var{Name: n, Value: pairs[i+1], Secret: s.Secret})
+		}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "redis".
+func (s *Source) Kind() string {
+	return "redis"
+}
+
+// dial connects to the server, authenticates, and selects the database.
+func (s *Source) dial(ctx context.Context) (*conn, error) {
+	rawURL := s.URL
+	if rawURL == "" {
+		rawURL = os.Getenv("REDIS_URL")
+	}
+	if rawURL == "" {
+		rawURL = defaultURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("patchenv: invalid Redis URL %q", redactURL(rawURL))
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	var nc net.Conn
+	dialer := &net.Dialer{}
+	if u.Scheme == "rediss" {
+		cfg := s.TLSConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: cfg}).DialContext(ctx, "tcp", address)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't connect to Redis: %w", err)
+	}
+	c := newConn(ctx, nc)
+
+	username, password := s.Username, s.Password
+	if password == "" && u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	if password != "" {
+		args := []string{"AUTH", password}
+		if username != "" {
+			args = []string{"AUTH", username, password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("patchenv: can't authenticate to Redis: %w", err)
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		if _, err := strconv.Atoi(db); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("patchenv: invalid Redis database %q", db)
+		}
+		if _, err := c.do("SELECT", db); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("patchenv: can't select Redis database %s: %w", db, err)
+		}
+	}
+	return c, nil
+}
+
+// redactURL returns rawURL with its password, if any, replaced.
+func redactURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return "(unparseable)"
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
@@ -0,0 +1,183 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// conn is a minimal client for the Redis protocol (RESP2).
+type conn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	stop chan struct{}
+}
+
+// serverError is an error reply from the server.
+type serverError string
+
+// Error implements the error interface.
+func (e serverError) Error() string {
+	return string(e)
+}
+
+// newConn returns a conn for nc that's closed when ctx is done.
+func newConn(ctx context.Context, nc net.Conn) *conn {
+	c := &conn{nc: nc, r: bufio.NewReader(nc), stop: make(chan struct{})}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			nc.Close()
+		case <-c.stop:
+		}
+	}()
+	return c
+}
+
+// Close closes the connection.
+func (c *conn) Close() error {
+	close(c.stop)
+	return c.nc.Close()
+}
+
+// do sends a command and returns its reply: a string, an int64, nil, or a
+// []interface{} of those.
+func (c *conn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.nc, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// strings sends a command whose reply is an array of strings.  Nil
+// elements become empty strings.
+func (c *conn) strings(args ...string) ([]string, error) {
+	reply, err := c.do(args...)
+	if err != nil {
+		return nil, err
+	}
+	return toStrings(reply)
+}
+
+// scanPrefix returns the names and values of the string keys that start
+// with prefix, alternating.
+func (c *conn) scanPrefix(prefix string) ([]string, error) {
+	var keys []string
+	cursor := "0"
+	for {
+		reply, err := c.do("SCAN", cursor, "MATCH", globEscape(prefix)+"*",
+			"COUNT", strconv.Itoa(scanCount))
+		if err != nil {
+			return nil, err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, errors.New("invalid SCAN reply")
+		}
+		cursor, _ = parts[0].(string)
+		batch, err := toStrings(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if cursor == "0" || cursor == "" {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	reply, err := c.do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != len(keys) {
+		return nil, errors.New("invalid MGET reply")
+	}
+	var pairs []string
+	for i, v := range values {
+		// MGET returns nil for keys that aren't strings (or were deleted
+		// since the SCAN).
+		if s, ok := v.(string); ok {
+			pairs = append(pairs, keys[i], s)
+		}
+	}
+	return pairs, nil
+}
+
+// readReply reads one reply from the server.
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("invalid reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, serverError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("invalid reply type %q", line[0])
+}
+
+// toStrings converts an array reply to strings.
+func toStrings(reply interface{}) ([]string, error) {
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array reply, got %T", reply)
+	}
+	strs := make([]string, len(items))
+	for i, item := range items {
+		strs[i], _ = item.(string)
+	}
+	return strs, nil
+}
+
+// globEscape escapes the characters that are special in SCAN's MATCH
+// patterns.
+func globEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(s)
+}
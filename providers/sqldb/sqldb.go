@@ -0,0 +1,85 @@
+// Package sqldb provides a patchenv.Source that reads variables from a
+// database with a query, for programs whose configuration lives in a table.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/arpio/patchenv"
+)
+
+// Source is a patchenv.Source that runs Query on DB and sets a variable for
+// each row it returns.  The query must return two columns, the variable's
+// name and its value:
+//
+//	src := &sqldb.Source{
+//		DB:    db,
+//		Query: "SELECT name, value FROM config WHERE service = $1",
+//		Args:  []interface{}{"billing"},
+//	}
+//
+// A NULL value unsets the variable.  Rows are applied in the order the
+// query returns them, so if a name appears more than once, the last row
+// wins.
+type Source struct {
+	// DB is the database to query, opened with any database/sql driver.
+	DB *sql.DB
+
+	// Query is the query to run.
+	Query string
+
+	// Args are the query's arguments.
+	Args []interface{}
+
+	// Secret marks all of the variables secret.
+	Secret bool
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	if s.DB == nil || s.Query == "" {
+		return nil, errors.New("patchenv: a SQL source needs a DB and a Query")
+	}
+	rows, err := s.DB.QueryContext(ctx, s.Query, s.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: config query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var vars []patchenv.Var
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("patchenv: config query must return (name, value) rows: %w", err)
+		}
+		if name == "" {
+			continue
+		}
+		vars = append(vars, patchenv.Var{
+			Name:   name,
+			Value:  value.String,
+			Unset:  !value.Valid,
+			Secret: s.Secret && value.Valid,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("patchenv: config query failed: %w", err)
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "sqldb".
+func (s *Source) Kind() string {
+	return "sqldb"
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true, since most database drivers connect to a server, even though some,
+// like SQLite's, don't.
+func (s *Source) UsesNetwork() bool {
+	return true
+}
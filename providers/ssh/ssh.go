@@ -0,0 +1,131 @@
+// Package ssh provides a patchenv.Runner that runs the patch command on a
+// remote host with the ssh client, for fetching an environment from a
+// bastion or license server.
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Runner is a patchenv.Runner that runs commands on Host with ssh.  The
+// command's output is parsed with the same protocol as a local command's,
+// including JSON envelopes and the no-changes exit status:
+//
+//	patchenv.PatchWith(
+//		patchenv.WithCommand("/opt/license/bin/env-for dev"),
+//		patchenv.WithRunner(&ssh.Runner{Host: "bastion.example.com"}),
+//	)
+//
+// Authentication uses keys and the SSH agent as configured for the ssh
+// client.  ssh runs in batch mode, so it fails instead of prompting for a
+// password or passphrase.  The handshake variables are exported on the
+// remote host before the command runs, so the remote login shell must be a
+// POSIX shell.
+type Runner struct {
+	// Host is the host to connect to, which may be an alias from the ssh
+	// configuration.
+	Host string
+
+	// User is the user to log in as, or empty for the ssh default.
+	User string
+
+	// Port is the port to connect to, or zero for the ssh default.
+	Port int
+
+	// IdentityFile is the private key to authenticate with, or empty to
+	// use the agent and default keys.
+	IdentityFile string
+
+	// Options are additional ssh options, like "StrictHostKeyChecking=yes",
+	// each passed with -o.
+	Options []string
+
+	// Path is the path of the ssh executable, or empty to look up "ssh"
+	// in PATH.
+	Path string
+}
+
+// Run implements the patchenv.Runner interface.  If the command fails, its
+// stdout and stderr (and any errors from ssh itself) are written to
+// patchenv.FailureOutput() and os.Stderr.
+func (r *Runner) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	if r.Host == "" {
+		return nil, errors.New("patchenv: an SSH runner needs a Host")
+	}
+	path := r.Path
+	if path == "" {
+		path = "ssh"
+	}
+	args := []string{"-o", "BatchMode=yes"}
+	if r.User != "" {
+		args = append(args, "-l", r.User)
+	}
+	if r.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(r.Port))
+	}
+	if r.IdentityFile != "" {
+		args = append(args, "-i", r.IdentityFile)
+	}
+	for _, opt := range r.Options {
+		args = append(args, "-o", opt)
+	}
+	args = append(args, "--", r.Host, remoteCommand(command, env))
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := patchenv.RunCommand(ctx, cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("patchenv command %q on %s timed out: %w", command, r.Host, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == patchenv.NoChangesExitCode {
+		return nil, patchenv.ErrNoChanges
+	}
+	if err != nil {
+		_, _ = patchenv.FailureOutput().Write(stdout.Bytes())
+		_, _ = os.Stderr.Write(stderr.Bytes())
+		return nil, fmt.Errorf("patchenv command %q on %s failed: %q", command, r.Host, err.Error())
+	}
+	return stdout.Bytes(), nil
+}
+
+// remoteCommand returns the command line for the remote shell, which
+// exports env and then runs command.
+func remoteCommand(command string, env []string) string {
+	if len(env) == 0 {
+		return command
+	}
+	var b strings.Builder
+	b.WriteString("export")
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fmt.Fprintf(&b, " %s=%s", parts[0], shellQuote(parts[1]))
+	}
+	b.WriteString("; ")
+	b.WriteString(command)
+	return b.String()
+}
+
+// shellQuote returns s in POSIX shell single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// UsesNetwork implements the patchenv.NetworkUser interface.  It returns
+// true.
+func (r *Runner) UsesNetwork() bool {
+	return true
+}
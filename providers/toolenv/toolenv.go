@@ -0,0 +1,213 @@
+// Package toolenv provides patchenv.Sources for the environments of tool
+// version managers, so Go programs that spawn builds get the PATH and
+// version variables a project pins without a shell wrapper.  MiseSource
+// runs mise, and AsdfSource reads asdf's .tool-versions file directly.
+package toolenv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// MiseSource is a patchenv.Source that sets the variables "mise env"
+// reports for a directory, including the PATH entries for the tools its
+// configuration pins.
+type MiseSource struct {
+	// Dir is the project directory, or empty for the current directory.
+	Dir string
+
+	// Path is the path of the mise executable, or empty to look up "mise"
+	// in PATH.
+	Path string
+}
+
+// Load implements the patchenv.Source interface.
+func (s *MiseSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	path := s.Path
+	if path == "" {
+		path = "mise"
+	}
+	cmd := exec.CommandContext(ctx, path, "env", "--json")
+	cmd.Dir = s.Dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := patchenv.RunCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("patchenv: mise env failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var env map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		return nil, fmt.Errorf("patchenv: invalid output from mise env: %w", err)
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vars := make([]patchenv.Var, len(names))
+	for i, name := range names {
+		vars[i] = patchenv.Var{Name: name, Value: env[name]}
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "toolenv".
+func (s *MiseSource) Kind() string {
+	return "toolenv"
+}
+
+// toolVersionsName is the name of asdf's configuration file.
+const toolVersionsName = ".tool-versions"
+
+// AsdfSource is a patchenv.Source that reads the .tool-versions file for a
+// directory and puts the bin directories of the pinned tool versions at
+// the front of PATH, as asdf's shims would select them.  It also sets
+// ASDF_<TOOL>_VERSION for each tool, so asdf shims run by child processes
+// select the same versions.  Versions that aren't installed are skipped.
+type AsdfSource struct {
+	// Dir is the project directory, or empty for the current directory.
+	// Like asdf, AsdfSource looks for .tool-versions in Dir's parent
+	// directories if there isn't one in Dir.
+	Dir string
+
+	// DataDir is asdf's data directory, or empty to use ASDF_DATA_DIR or
+	// ~/.asdf.
+	DataDir string
+}
+
+// Load implements the patchenv.Source interface.
+func (s *AsdfSource) Load(ctx context.Context) ([]patchenv.Var, error) {
+	path, err := findUp(s.Dir, toolVersionsName)
+	if err != nil {
+		return nil, err
+	}
+	dataDir := s.DataDir
+	if dataDir == "" {
+		dataDir = os.Getenv("ASDF_DATA_DIR")
+	}
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dataDir = filepath.Join(home, ".asdf")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vars []patchenv.Var
+	var bins []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		tool := fields[0]
+		// Later fields are fallbacks, used if the first version isn't
+		// installed.
+		for _, version := range fields[1:] {
+			installDir := filepath.Join(dataDir, "installs", tool, version)
+			if version == "system" {
+				break
+			}
+			if _, err := os.Stat(installDir); err != nil {
+				continue
+			}
+			bins = append(bins, binPaths(ctx, dataDir, tool, installDir)...)
+			vars = append(vars, patchenv.Var{Name: versionVar(tool), Value: version})
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("patchenv: can't read %s: %w", path, err)
+	}
+	if len(bins) > 0 {
+		pathList := strings.Join(bins, string(os.PathListSeparator))
+		if current := os.Getenv("PATH"); current != "" {
+			pathList += string(os.PathListSeparator) + current
+		}
+		vars = append(vars, patchenv.Var{Name: "PATH", Value: pathList})
+	}
+	return vars, nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "toolenv".
+func (s *AsdfSource) Kind() string {
+	return "toolenv"
+}
+
+// binPaths returns the directories of an installed tool version that hold
+// its executables, from the plugin's list-bin-paths script if it has one,
+// or "bin" otherwise.
+func binPaths(ctx context.Context, dataDir, tool, installDir string) []string {
+	script := filepath.Join(dataDir, "plugins", tool, "bin", "list-bin-paths")
+	rel := []string{"bin"}
+	if _, err := os.Stat(script); err == nil {
+		cmd := exec.CommandContext(ctx, script)
+		cmd.Env = append(os.Environ(), "ASDF_INSTALL_PATH="+installDir)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if err := patchenv.RunCommand(ctx, cmd); err == nil {
+			rel = strings.Fields(stdout.String())
+		}
+	}
+	dirs := make([]string, len(rel))
+	for i, r := range rel {
+		dirs[i] = filepath.Join(installDir, r)
+	}
+	return dirs
+}
+
+// versionVar returns the name of the variable asdf reads to override the
+// version of tool, like ASDF_NODEJS_VERSION.
+func versionVar(tool string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' {
+			return '_'
+		}
+		return r
+	}, strings.ToUpper(tool))
+	return "ASDF_" + name + "_VERSION"
+}
+
+// findUp returns the path of the file named name in dir or its nearest
+// parent.
+func findUp(dir, name string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("patchenv: no %s found", name)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,165 @@
+// Package winreg provides a patchenv.Source for the environment variables
+// stored in the Windows registry, which Windows only reads into a process's
+// environment when the user logs in.  With Source, a long-running program
+// like a service picks up changes to the user and system environment
+// without the user logging out and in again.
+//
+// On other platforms, Source.Load returns an error.
+package winreg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arpio/patchenv"
+)
+
+// Scope selects the registry keys that Source reads.
+type Scope int
+
+const (
+	// ScopeAll reads the system environment and then the user
+	// environment, as Windows does when a user logs in.
+	ScopeAll Scope = iota
+
+	// ScopeUser reads HKEY_CURRENT_USER\Environment.
+	ScopeUser
+
+	// ScopeSystem reads HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\
+	// Control\Session Manager\Environment.
+	ScopeSystem
+)
+
+// Registry paths of the environment keys, relative to their root keys.
+const (
+	userKey   = `Environment`
+	systemKey = `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`
+)
+
+// pathVar is the variable whose user value Windows appends to its system
+// value, instead of replacing it.
+const pathVar = "Path"
+
+// value is a variable read from the registry.
+type value struct {
+	name string
+	data string
+
+	// expand is true for REG_EXPAND_SZ values, which may refer to other
+	// variables as %NAME%.
+	expand bool
+}
+
+// Source is a patchenv.Source that sets the environment variables stored
+// in the registry.  Like Windows, it appends the user's Path to the system
+// Path and expands %NAME% references in REG_EXPAND_SZ values, using the
+// registry's variables first and then the process's environment.
+//
+// Source implements patchenv.Watcher, so a patchenv.Refresher applies
+// changes to the registry as soon as they're made.
+type Source struct {
+	// Scope selects the keys to read.
+	Scope Scope
+}
+
+// Load implements the patchenv.Source interface.
+func (s *Source) Load(ctx context.Context) ([]patchenv.Var, error) {
+	var system, user []value
+	var err error
+	if s.Scope == ScopeAll || s.Scope == ScopeSystem {
+		if system, err = readKey(true); err != nil {
+			return nil, fmt.Errorf("patchenv: can't read the system environment: %w", err)
+		}
+	}
+	if s.Scope == ScopeAll || s.Scope == ScopeUser {
+		if user, err = readKey(false); err != nil {
+			return nil, fmt.Errorf("patchenv: can't read the user environment: %w", err)
+		}
+	}
+	return merge(system, user), nil
+}
+
+// Kind implements the patchenv.Kinded interface.  It returns "winreg".
+func (s *Source) Kind() string {
+	return "winreg"
+}
+
+// merge combines the system and user values into variables, with user
+// values replacing system ones (except for Path), and expands them.
+// Variable names are case-insensitive, as they are on Windows.
+func merge(system, user []value) []patchenv.Var {
+	var values []value
+	index := make(map[string]int)
+	add := func(v value, isUser bool) {
+		key := strings.ToUpper(v.name)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(values)
+			values = append(values, v)
+			return
+		}
+		if isUser && strings.EqualFold(v.name, pathVar) && values[i].data != "" {
+			v.data = strings.TrimSuffix(values[i].data, ";") + ";" + v.data
+			v.expand = v.expand || values[i].expand
+		}
+		v.name = values[i].name
+		values[i] = v
+	}
+	for _, v := range system {
+		add(v, false)
+	}
+	for _, v := range user {
+		add(v, true)
+	}
+
+	lookup := func(name string) (string, bool) {
+		if i, ok := index[strings.ToUpper(name)]; ok {
+			if values[i].expand {
+				// Only one level of references is expanded.
+				return expand(values[i].data, os.LookupEnv), true
+			}
+			return values[i].data, true
+		}
+		return os.LookupEnv(name)
+	}
+	vars := make([]patchenv.Var, len(values))
+	for i, v := range values {
+		data := v.data
+		if v.expand {
+			data = expand(data, lookup)
+		}
+		vars[i] = patchenv.Var{Name: v.name, Value: data}
+	}
+	return vars
+}
+
+// expand replaces %NAME% references in s with the values lookup returns.
+// References to unknown variables are left as they are, as they are by
+// ExpandEnvironmentStrings.
+func expand(s string, lookup func(string) (string, bool)) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(s, '%')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start+1:], '%')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		name := s[start+1 : end]
+		if value, ok := lookup(name); ok && name != "" {
+			b.WriteString(s[:start])
+			b.WriteString(value)
+			s = s[end+1:]
+		} else {
+			b.WriteString(s[:end])
+			s = s[end:]
+		}
+	}
+	b.WriteString(s)
+	return b.String()
+}
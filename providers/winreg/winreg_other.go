@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package winreg
+
+import (
+	"context"
+	"errors"
+)
+
+// errNotWindows is returned on platforms without a registry.
+var errNotWindows = errors.New("the registry is only available on Windows")
+
+// readKey returns the values in the system or user environment key.
+func readKey(system bool) ([]value, error) {
+	return nil, errNotWindows
+}
+
+// Wait implements the patchenv.Watcher interface.
+func (s *Source) Wait(ctx context.Context) error {
+	return errNotWindows
+}
@@ -0,0 +1,152 @@
+package winreg
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procRegEnumValueW           = advapi32.NewProc("RegEnumValueW")
+	procRegNotifyChangeKeyValue = advapi32.NewProc("RegNotifyChangeKeyValue")
+	procCreateEventW            = kernel32.NewProc("CreateEventW")
+)
+
+const (
+	// regNotifyChangeLastSet reports changes to a key's values.
+	regNotifyChangeLastSet = 0x00000004
+
+	// errorNoMoreItems is returned by RegEnumValueW after the last value.
+	errorNoMoreItems = syscall.Errno(259)
+
+	// errorMoreData is returned by RegEnumValueW if a buffer is too small.
+	errorMoreData = syscall.Errno(234)
+
+	// waitPollMillis is how long Wait blocks between checks of its
+	// context.
+	waitPollMillis = 500
+)
+
+// openKey opens the system or user environment key.
+func openKey(system bool) (syscall.Handle, error) {
+	root, path := syscall.Handle(syscall.HKEY_CURRENT_USER), userKey
+	if system {
+		root, path = syscall.HKEY_LOCAL_MACHINE, systemKey
+	}
+	var key syscall.Handle
+	if err := syscall.RegOpenKeyEx(root, syscall.StringToUTF16Ptr(path), 0, syscall.KEY_READ, &key); err != nil {
+		return 0, err
+	}
+	return key, nil
+}
+
+// readKey returns the string values in the system or user environment key.
+func readKey(system bool) ([]value, error) {
+	key, err := openKey(system)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(key)
+
+	var maxName, maxData uint32
+	if err := syscall.RegQueryInfoKey(key, nil, nil, nil, nil, nil, nil, nil, &maxName, &maxData, nil, nil); err != nil {
+		return nil, err
+	}
+	name := make([]uint16, maxName+1)
+	data := make([]byte, maxData+2)
+
+	var values []value
+	for i := uint32(0); ; i++ {
+		nameLen := uint32(len(name))
+		dataLen := uint32(len(data))
+		var typ uint32
+		r, _, _ := procRegEnumValueW.Call(uintptr(key), uintptr(i),
+			uintptr(unsafe.Pointer(&name[0])), uintptr(unsafe.Pointer(&nameLen)), 0,
+			uintptr(unsafe.Pointer(&typ)), uintptr(unsafe.Pointer(&data[0])), uintptr(unsafe.Pointer(&dataLen)))
+		switch err := syscall.Errno(r); err {
+		case 0:
+		case errorNoMoreItems:
+			return values, nil
+		case errorMoreData:
+			// A value was added or grew since RegQueryInfoKey.
+			name = make([]uint16, 2*len(name))
+			data = make([]byte, 2*len(data))
+			i--
+			continue
+		default:
+			return nil, err
+		}
+		if typ != syscall.REG_SZ && typ != syscall.REG_EXPAND_SZ {
+			continue
+		}
+		values = append(values, value{
+			name:   syscall.UTF16ToString(name[:nameLen]),
+			data:   utf16Bytes(data[:dataLen]),
+			expand: typ == syscall.REG_EXPAND_SZ,
+		})
+	}
+}
+
+// utf16Bytes decodes registry string data, which is NUL-terminated UTF-16.
+func utf16Bytes(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+	return syscall.UTF16ToString(u)
+}
+
+// Wait implements the patchenv.Watcher interface.  It returns when a value
+// in one of the source's keys changes.
+func (s *Source) Wait(ctx context.Context) error {
+	// Each notification is bound to the thread that requests it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	r, _, err := procCreateEventW.Call(0, 0, 0, 0)
+	if r == 0 {
+		return fmt.Errorf("patchenv: can't create event: %w", err)
+	}
+	event := syscall.Handle(r)
+	defer syscall.CloseHandle(event)
+
+	var keys []syscall.Handle
+	defer func() {
+		for _, key := range keys {
+			syscall.RegCloseKey(key)
+		}
+	}()
+	for _, system := range []bool{true, false} {
+		if (system && s.Scope == ScopeUser) || (!system && s.Scope == ScopeSystem) {
+			continue
+		}
+		key, err := openKey(system)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		r, _, _ := procRegNotifyChangeKeyValue.Call(uintptr(key), 0,
+			regNotifyChangeLastSet, uintptr(event), 1)
+		if r != 0 {
+			return fmt.Errorf("patchenv: can't watch the registry: %w", syscall.Errno(r))
+		}
+	}
+
+	for {
+		ev, err := syscall.WaitForSingleObject(event, waitPollMillis)
+		if err != nil {
+			return err
+		}
+		if ev == syscall.WAIT_OBJECT_0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
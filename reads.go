@@ -0,0 +1,103 @@
+package patchenv
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// trackReadsVar is the environment variable that, when set to "1", enables
+// recording the variables read with Getenv and LookupEnv before the
+// environment is patched.
+const trackReadsVar = "PATCH_ENV_TRACK_READS"
+
+// trackReads is whether early reads are recorded, read once at startup.
+var trackReads = envEnabled(trackReadsVar)
+
+// EarlyRead is a variable that was read with Getenv or LookupEnv before
+// the environment was patched.
+type EarlyRead struct {
+	// Name is the name of the variable.
+	Name string
+
+	// Caller is the file and line of the first call that read it.
+	Caller string
+}
+
+// earlyReads holds the variables read before the environment was patched,
+// by name.
+var earlyReads struct {
+	sync.Mutex
+	byName map[string]string
+}
+
+// EarlyReads returns the variables that were read with Getenv or
+// LookupEnv before the environment was patched, sorted by name, when the
+// PATCH_ENV_TRACK_READS environment variable is set to "1".  In that mode,
+// Getenv and LookupEnv don't patch the environment on first use, so the
+// reads that would have been too early if the program relied on calling
+// Patch in main() show up here, and PatchWith logs a warning for each
+// variable it changes that was read early.  Without PATCH_ENV_TRACK_READS,
+// EarlyReads returns nil.
+func EarlyReads() []EarlyRead {
+	earlyReads.Lock()
+	defer earlyReads.Unlock()
+	var reads []EarlyRead
+	for name, caller := range earlyReads.byName {
+		reads = append(reads, EarlyRead{Name: name, Caller: caller})
+	}
+	sort.Slice(reads, func(i, j int) bool { return reads[i].Name < reads[j].Name })
+	return reads
+}
+
+// recordRead records that key was read, if the environment hasn't been
+// patched yet.  skip is the number of stack frames between recordRead and
+// the caller to report.
+func recordRead(key string, skip int) {
+	if atomic.LoadInt32(&patched) != 0 {
+		return
+	}
+	caller := "an unknown location"
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	earlyReads.Lock()
+	defer earlyReads.Unlock()
+	if earlyReads.byName == nil {
+		earlyReads.byName = make(map[string]string)
+	}
+	if _, ok := earlyReads.byName[key]; !ok {
+		earlyReads.byName[key] = caller
+	}
+}
+
+// warnEarlyReads logs a warning for each of vars that was read before the
+// environment was patched.
+func warnEarlyReads(vars []Var) {
+	if !trackReads {
+		return
+	}
+	earlyReads.Lock()
+	defer earlyReads.Unlock()
+	for _, v := range vars {
+		if caller, ok := earlyReads.byName[v.Name]; ok {
+			log.Printf("[WARNING] patchenv: %s was read at %s before the environment was patched",
+				v.Name, caller)
+		}
+	}
+}
+
+// lookupEnv is LookupEnv, with skip stack frames between it and the caller
+// to report to EarlyReads.
+func lookupEnv(key string, skip int) (string, bool) {
+	if trackReads {
+		recordRead(key, skip+1)
+	} else if err := EnsurePatched(); err != nil {
+		log.Printf("[WARNING] patchenv: %s", err)
+	}
+	return os.LookupEnv(key)
+}
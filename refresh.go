@@ -0,0 +1,201 @@
+package patchenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watchRetryDelay is how long a Refresher waits before watching again after
+// a Watcher fails, if it doesn't have an interval.
+const watchRetryDelay = 5 * time.Second
+
+// Watcher is implemented by Sources that can tell when their variables
+// change, like a KV store with blocking queries.  A Refresher waits for a
+// Watcher's changes instead of polling it.
+type Watcher interface {
+	// Wait blocks until the source's variables may have changed since
+	// the last call to Load, or until ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// Refresher keeps a long-running program's environment up to date by
+// patching it again whenever the variables may have changed.  It also
+// patches the environment when a variable left out of a Result because of
+// its NotBefore time becomes valid, and when one that was set expires, in
+// which case the variable is unset unless the refresh set it again.
+type Refresher struct {
+	// OnRefresh, if not nil, is called with the Result and error of each
+	// refresh.  If it's nil, failed refreshes are logged.  If it panics,
+	// the panic is logged and the Refresher keeps running.
+	OnRefresh func(*Result, error)
+
+	// History, if not nil, records the changes each refresh applies, so
+	// they can be rolled back with History.RollbackTo.
+	History *History
+
+	// MaxAge, if it's positive, makes Healthy report an error when the
+	// environment hasn't been refreshed successfully for longer than
+	// MaxAge, counting from when Run started.
+	MaxAge time.Duration
+
+	interval time.Duration
+	opts     []Option
+
+	mu          sync.Mutex
+	running     bool
+	started     time.Time
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// NewRefresher returns a Refresher that patches the environment with
+// PatchWith(opts...) every interval, or, if the source is a Watcher,
+// whenever the source reports a change.  The command sees
+// PATCH_ENV_INVOCATION=reload.
+func NewRefresher(interval time.Duration, opts ...Option) *Refresher {
+	return &Refresher{
+		interval: interval,
+		opts:     append([]Option{WithInvocation(InvocationReload)}, opts...),
+	}
+}
+
+// Run refreshes the environment until ctx is done, then returns ctx.Err().
+// It doesn't patch the environment before the first change or interval, so
+// programs should call PatchWith once at startup.  A source given with
+// WithSource or WithSourceURI is opened once, and the same one is watched
+// and loaded from, so a change a Watcher found is the one that's applied.
+func (r *Refresher) Run(ctx context.Context) error {
+	cfg := newConfig(r.opts)
+	src := cfg.patchSource()
+	opts := r.opts
+	if cfg.source != nil && src != nil {
+		opts = append(opts[:len(opts):len(opts)], WithSource(src))
+	}
+	watcher, _ := src.(Watcher)
+	if watcher == nil && r.interval <= 0 {
+		return errors.New("patchenv: a Refresher needs an interval unless its source is a Watcher")
+	}
+	r.mu.Lock()
+	r.running, r.started = true, time.Now()
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	for {
+		if err := r.wait(ctx, watcher, nextValidityChange(time.Now())); err != nil {
+			return err
+		}
+		var before map[string]string
+		if r.History != nil {
+			before = environMap()
+		}
+		result, err := PatchWith(opts...)
+		dropExpired(result, time.Now())
+		count(&statRefreshes, &statRefreshFailures, err)
+		r.record(err)
+		if r.History != nil && err == nil {
+			r.History.record(result, before)
+		}
+		if err != nil {
+			emit(EventRefreshFailed, func(e *Event) {
+				e.Err = err
+			})
+		}
+		if r.OnRefresh != nil {
+			func() {
+				defer recoverCallback("OnRefresh")
+				r.OnRefresh(result, err)
+			}()
+		} else if err != nil {
+			log.Printf("[WARNING] patchenv: refresh failed: %s", err)
+		}
+	}
+}
+
+// record saves the outcome of a refresh for Healthy and LastSuccess.
+func (r *Refresher) record(err error) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = err
+	if err == nil {
+		r.lastSuccess = now
+		atomic.StoreInt64(&statLastRefresh, now.UnixNano())
+	}
+}
+
+// LastSuccess returns the time of the last successful refresh, or the zero
+// time if there hasn't been one.
+func (r *Refresher) LastSuccess() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastSuccess
+}
+
+// Healthy returns an error if Run isn't running, if the last refresh
+// failed, or if the environment is older than MaxAge.  Services can call
+// it from their readiness or liveness checks:
+//
+//	http.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+//		if err := refresher.Healthy(); err != nil {
+//			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+//		}
+//	})
+func (r *Refresher) Healthy() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.running {
+		return errors.New("patchenv: the Refresher isn't running")
+	}
+	if r.lastErr != nil {
+		return fmt.Errorf("patchenv: the last refresh failed: %w", r.lastErr)
+	}
+	since := r.lastSuccess
+	if since.IsZero() {
+		since = r.started
+	}
+	if age := time.Since(since); r.MaxAge > 0 && age > r.MaxAge {
+		return fmt.Errorf("patchenv: the environment hasn't been refreshed for %s", age.Round(time.Second))
+	}
+	return nil
+}
+
+// wait blocks until it's time for the next refresh, or until deadline if
+// it's not the zero time, and returns an error only if ctx is done.
+func (r *Refresher) wait(ctx context.Context, watcher Watcher, deadline time.Time) error {
+	waitCtx := ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	delay := r.interval
+	if watcher != nil {
+		err := watcher.Wait(waitCtx)
+		if err == nil || waitCtx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("[WARNING] patchenv: watch failed: %s", err)
+		if delay <= 0 {
+			delay = watchRetryDelay
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-waitCtx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,211 @@
+package patchenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SourceFactory creates a Source from a URI whose scheme it was registered
+// for with RegisterSource.  The URI is passed as it was written, so
+// factories can accept values that aren't valid URLs, like commands;
+// factories for URL-like schemes can parse it with url.Parse.
+type SourceFactory func(uri string) (Source, error)
+
+var (
+	// factoriesMu guards factories.
+	factoriesMu sync.RWMutex
+
+	// factories maps URI schemes to the factories registered for them.
+	factories = map[string]SourceFactory{
+		"bundle": openBundle,
+		"cmd":    openCommand,
+		"file":   openFile,
+		"http":   openURL,
+		"https":  openURL,
+		"plugin": openPlugin,
+	}
+)
+
+// RegisterSource makes a Source available to OpenSource and WithSourceURI
+// under the URI scheme name, like "vault" for "vault://secret/myapp".
+// Providers usually call it from an init function.  RegisterSource panics
+// if name is already registered or factory is nil.
+//
+// The schemes "cmd" (a command, like "cmd:aws-vault exec dev -- env"),
+// "file" (a file in the "var=value" format or a JSON envelope, like
+// "file:///etc/myapp.env"), "http" and "https" (a document in the same
+// formats fetched with a URLSource, like "https://config.example.com/env"),
+// "plugin" (a provider plugin, like "plugin:vault?path=secret/myapp"), and
+// "bundle" (a snapshot bundle loaded with a BundleSource, like
+// "bundle:///var/lib/myapp/env.bundle?key=/etc/myapp/bundle.pub") are
+// built in.
+func RegisterSource(name string, factory SourceFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("patchenv: RegisterSource factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("patchenv: RegisterSource called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// SourceSchemes returns the registered URI schemes, sorted.
+func SourceSchemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenSource returns the Source for uri, created by the factory registered
+// for its scheme.
+func OpenSource(uri string) (Source, error) {
+	i := strings.Index(uri, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("patchenv: source URI %q has no scheme", uri)
+	}
+	scheme := strings.ToLower(uri[:i])
+	factoriesMu.RLock()
+	factory, ok := factories[scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("patchenv: unknown source scheme %q (is its provider imported?)", scheme)
+	}
+	src, err := factory(uri)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: invalid source URI %q: %w", uri, err)
+	}
+	return src, nil
+}
+
+// uriRest returns the part of uri after its scheme, without the "//" that
+// may follow the colon.
+func uriRest(uri string) string {
+	rest := uri[strings.Index(uri, ":")+1:]
+	return strings.TrimPrefix(rest, "//")
+}
+
+// openCommand is the SourceFactory for "cmd:COMMAND" URIs, which run
+// COMMAND as it's written, without decoding it.
+func openCommand(uri string) (Source, error) {
+	command := uriRest(uri)
+	if command == "" {
+		return nil, errors.New("no command")
+	}
+	return &CommandSource{Command: command}, nil
+}
+
+// openFile is the SourceFactory for "file:PATH" URIs.
+func openFile(uri string) (Source, error) {
+	path := uriRest(uri)
+	if path == "" {
+		return nil, errors.New("no path")
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	return &FileSource{Path: path}, nil
+}
+
+// openURL is the SourceFactory for "http:" and "https:" URIs.
+func openURL(uri string) (Source, error) {
+	if _, err := url.Parse(uri); err != nil {
+		return nil, err
+	}
+	return &URLSource{URL: uri}, nil
+}
+
+// openPlugin is the SourceFactory for "plugin:NAME?KEY=VALUE&..." URIs,
+// whose query parameters are the plugin's configuration.
+func openPlugin(uri string) (Source, error) {
+	rest := uriRest(uri)
+	name, query := rest, ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		name, query = rest[:i], rest[i+1:]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]string, len(params))
+	for key, values := range params {
+		config[key] = values[len(values)-1]
+	}
+	return &PluginSource{Name: name, Config: config}, nil
+}
+
+// FileSource is a Source that parses a file in the "var=value" format, or
+// a JSON envelope, like the output of a command.
+type FileSource struct {
+	// Path is the path of the file.
+	Path string
+
+	// Parser parses the file, or is nil to use the default Parser.
+	Parser *Parser
+}
+
+// Load implements the Source interface.
+func (s *FileSource) Load(ctx context.Context) ([]Var, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("patchenv: can't read variables: %w", err)
+	}
+	defer f.Close()
+	parser := s.Parser
+	if parser == nil {
+		parser = &Parser{}
+	}
+	return parser.Parse(limitReader(ctx, f))
+}
+
+// multiSource is a Source that loads from several Sources in order, so the
+// later ones' variables take precedence.
+type multiSource []Source
+
+// Load implements the Source interface.  It returns ErrNoChanges only if
+// all of the sources report that there's nothing to change.
+func (m multiSource) Load(ctx context.Context) ([]Var, error) {
+	layers, err := m.loadLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return flatten(layers), nil
+}
+
+// loadLayers loads the variables from each of the sources, named by their
+// position and description.
+func (m multiSource) loadLayers(ctx context.Context) ([]layer, error) {
+	var layers []layer
+	noChanges := 0
+	for i, src := range m {
+		loaded, err := src.Load(ctx)
+		if errors.Is(err, ErrNoChanges) {
+			noChanges++
+			continue
+		}
+		if err != nil {
+			removeFiles(loaded)
+			removeFiles(flatten(layers))
+			return nil, err
+		}
+		name := fmt.Sprintf("source %d (%s)", i+1, describeSource(src))
+		layers = append(layers, layer{name: name, vars: loaded})
+	}
+	if noChanges == len(m) {
+		return nil, ErrNoChanges
+	}
+	return layers, nil
+}
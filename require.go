@@ -0,0 +1,45 @@
+package patchenv
+
+import (
+	"os"
+	"strings"
+)
+
+// Require returns a *MissingError listing each of the named environment
+// variables that is unset or empty, or nil if they're all set.  Call it
+// after Patch to report every missing variable at once:
+//
+//	if err := patchenv.Require("DATABASE_URL", "API_TOKEN"); err != nil {
+//		log.Fatal(err)
+//	}
+func Require(names ...string) error {
+	return checkRequired(names, os.LookupEnv)
+}
+
+// checkRequired returns a *MissingError listing each of the named variables
+// that lookup reports as unset or empty.
+func checkRequired(names []string, lookup func(string) (string, bool)) error {
+	var missing []string
+	for _, name := range names {
+		if value, _ := lookup(name); value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingError{Names: missing}
+	}
+	return nil
+}
+
+// MissingError is returned when required environment variables are unset or
+// empty.
+type MissingError struct {
+	// Names are the names of the missing variables.
+	Names []string
+}
+
+// Error implements the error interface.
+func (e *MissingError) Error() string {
+	return "patchenv: required environment variables not set: " +
+		strings.Join(e.Names, ", ")
+}
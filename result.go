@@ -0,0 +1,131 @@
+package patchenv
+
+import (
+	"os"
+	"time"
+)
+
+// Result describes the outcome of PatchWith or Resolve.
+type Result struct {
+	// Command is the command that was run, or empty if there was no
+	// command to run or the variables came from a Source set with
+	// WithSource.
+	Command string
+
+	// Vars are the variables that were set or unset (or, for Resolve,
+	// that would be), in the order the command output them.
+	Vars []Var
+
+	// NoChanges is true if the source reported that there was nothing to
+	// change, rather than producing zero variables: for example, the
+	// command exited with NoChangesExitCode.  Vars is empty when NoChanges
+	// is true.  Programs that refresh the environment periodically can
+	// use it to skip work when nothing changed.
+	NoChanges bool
+
+	// Degraded is true if the command or Source failed and the variables
+	// came from the fallback set with WithFallback, WithFallbackCommand, or
+	// PATCH_ENV_FALLBACK_COMMAND.
+	Degraded bool
+
+	// PrimaryErr is the error from the command or Source when Degraded is
+	// true.
+	PrimaryErr error
+
+	// IgnoredErr is the error from the command or Source that was logged
+	// instead of being returned because of WithBestEffort.
+	IgnoredErr error
+
+	// Unchanged are the names of the variables whose values were already
+	// set in the environment.  It's only filled in when the
+	// WithReportUnchanged option is used.
+	Unchanged []string
+
+	// Conflicts lists the variables that were defined more than once,
+	// either by one source or by several of the sources given to
+	// WithSourceURI, and says which definition took effect.
+	Conflicts []Conflict
+
+	// Scheduled are the variables that were left out of Vars because
+	// their NotBefore times haven't come yet.  A Refresher patches the
+	// environment again when the first of them does.
+	Scheduled []Var
+
+	// Panics are the panics that were recovered from hooks, like
+	// Transforms and Sources, according to WithPanicPolicy.
+	Panics []*PanicError
+
+	// provenance records where the variables came from, for Explain.
+	provenance *provenance
+}
+
+// Var is an environment variable parsed from the command's output.
+type Var struct {
+	Name  string
+	Value string
+
+	// Unset means the variable is removed from the environment instead of
+	// being set to Value.
+	Unset bool
+
+	// Secret means the value is sensitive and shouldn't be logged or
+	// displayed.
+	Secret bool
+
+	// Expires is the time after which the value is no longer valid, or the
+	// zero time if it doesn't expire.
+	Expires time.Time
+
+	// NotBefore is the time before which the value isn't valid yet, or the
+	// zero time if it's valid now.  PatchWith and Resolve leave variables
+	// that aren't valid yet, or have expired, out of Result.Vars.
+	NotBefore time.Time
+
+	// File means Value is the path of a temporary file that patchenv wrote
+	// the variable's content to.
+	File bool
+}
+
+// Expiry returns the time the value the result gives the variable name
+// expires, or the zero time if it doesn't expire or the result doesn't set
+// the variable.  If the result sets the variable more than once, the last
+// value counts, as it does in the environment.
+func (r *Result) Expiry(name string) time.Time {
+	for i := len(r.Vars) - 1; i >= 0; i-- {
+		if v := r.Vars[i]; v.Name == name {
+			if v.Unset {
+				return time.Time{}
+			}
+			return v.Expires
+		}
+	}
+	return time.Time{}
+}
+
+// NextExpiry returns the earliest time that one of the values the result
+// sets expires, or the zero time if none of them do.  Programs can use it
+// to schedule their own refresh, or to warn before credentials lapse:
+//
+//	if at := result.NextExpiry(); !at.IsZero() {
+//		time.AfterFunc(time.Until(at)-time.Minute, refresh)
+//	}
+func (r *Result) NextExpiry() time.Time {
+	var next time.Time
+	for _, v := range r.finalVars() {
+		if !v.Unset && !v.Expires.IsZero() && (next.IsZero() || v.Expires.Before(next)) {
+			next = v.Expires
+		}
+	}
+	return next
+}
+
+// lookup returns the value the variable name would have after the result's
+// variables are set.
+func (r *Result) lookup(name string) (string, bool) {
+	for i := len(r.Vars) - 1; i >= 0; i-- {
+		if r.Vars[i].Name == name {
+			return r.Vars[i].Value, !r.Vars[i].Unset
+		}
+	}
+	return os.LookupEnv(name)
+}
@@ -0,0 +1,33 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd netbsd openbsd solaris
+
+package patchenv
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// runCommand runs cmd with limits applied.  Only Nice is supported, and
+// sandboxes aren't.
+func runCommand(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	if sandbox != nil {
+		return errSandboxUnsupported
+	}
+	if limits.CPUTime > 0 || limits.Memory > 0 || limits.FileSize > 0 {
+		return errLimitUnsupported
+	}
+	if limits.Nice == 0 {
+		return cmd.Run()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, cmd.Process.Pid, limits.Nice); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("patchenv: can't set niceness: %w", err)
+	}
+	return cmd.Wait()
+}
@@ -0,0 +1,131 @@
+package patchenv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// rlimit64 is the structure the prlimit64 system call takes.
+type rlimit64 struct {
+	cur, max uint64
+}
+
+// runCommand runs cmd with SIGKILL as its parent-death signal, so it's
+// killed if the program dies while it's running, and with limits and the
+// sandbox applied before it runs.
+func runCommand(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	if sandbox != nil {
+		return runSandboxed(cmd, limits, sandbox)
+	}
+
+	// The signal is sent when the thread that started the command exits,
+	// not the process, so the thread must not exit while it runs.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	return runLocked(cmd, limits)
+}
+
+// runLocked runs cmd like runCommand.  The caller must have locked the
+// goroutine to its thread.
+func runLocked(cmd *exec.Cmd, limits Limits) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Pdeathsig = syscall.SIGKILL
+	if limits.isZero() {
+		return cmd.Run()
+	}
+
+	// To apply the limits before the command does anything, it's started
+	// under ptrace, which stops it when it execs, and then released.  The
+	// tracer is the thread that started it, which is locked.
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, syscall.EPERM) && cmd.SysProcAttr.Credential == nil {
+			return fmt.Errorf("patchenv: can't set the command's resource limits, since it can't "+
+				"be traced until it execs (ptrace may be restricted by Yama's "+
+				"kernel.yama.ptrace_scope, a container's seccomp profile, or gVisor): %w", err)
+		}
+		return err
+	}
+	pid := cmd.Process.Pid
+	err := waitForExecStop(pid)
+	if err == nil {
+		err = applyLimits(pid, limits)
+	}
+	if err == nil {
+		err = syscall.PtraceDetach(pid)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	return cmd.Wait()
+}
+
+// waitForExecStop waits for the traced process with the given ID to stop
+// after it execs.
+func waitForExecStop(pid int) error {
+	var status syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("patchenv: can't start the command: %w", err)
+		}
+		if !status.Stopped() {
+			return fmt.Errorf("patchenv: command exited before its limits were set")
+		}
+		return nil
+	}
+}
+
+// applyLimits sets limits on the process with the given ID.
+func applyLimits(pid int, limits Limits) error {
+	if limits.CPUTime > 0 {
+		seconds := uint64(math.Ceil(limits.CPUTime.Seconds()))
+		if err := prlimit(pid, syscall.RLIMIT_CPU, seconds); err != nil {
+			return fmt.Errorf("patchenv: can't limit CPU time: %w", err)
+		}
+	}
+	if limits.Memory > 0 {
+		if err := prlimit(pid, syscall.RLIMIT_AS, limits.Memory); err != nil {
+			return fmt.Errorf("patchenv: can't limit memory: %w", err)
+		}
+	}
+	if limits.FileSize > 0 {
+		if err := prlimit(pid, syscall.RLIMIT_FSIZE, limits.FileSize); err != nil {
+			return fmt.Errorf("patchenv: can't limit file size: %w", err)
+		}
+	}
+	if limits.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, limits.Nice); err != nil {
+			return fmt.Errorf("patchenv: can't set niceness: %w", err)
+		}
+	}
+	return nil
+}
+
+// prlimit sets the soft and hard limits of a resource of the process with
+// the given ID.
+func prlimit(pid, resource int, value uint64) error {
+	lim := rlimit64{cur: value, max: value}
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(&lim)), 0, 0, 0)
+	if errno == syscall.EPERM {
+		return fmt.Errorf("%w (prlimit may be blocked by a seccomp profile, or the limit is "+
+			"higher than the inherited hard limit, which needs CAP_SYS_RESOURCE)", errno)
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !solaris && !js && !wasip1
+// +build !linux,!windows,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!solaris,!js,!wasip1
+
+package patchenv
+
+import "os/exec"
+
+// runCommand runs cmd.  No limits or sandboxes are supported.
+func runCommand(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	if sandbox != nil {
+		return errSandboxUnsupported
+	}
+	if !limits.isZero() {
+		return errLimitUnsupported
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,12 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package patchenv
+
+import "os/exec"
+
+// runCommand returns ErrExecUnsupported, since WebAssembly programs can't
+// start processes.
+func runCommand(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	return ErrExecUnsupported
+}
@@ -0,0 +1,195 @@
+package patchenv
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+
+	ntdll = syscall.NewLazyDLL("ntdll.dll")
+
+	procNtResumeProcess = ntdll.NewProc("NtResumeProcess")
+)
+
+const (
+	// jobObjectExtendedLimitInformation is the information class of
+	// jobObjectExtendedLimit.
+	jobObjectExtendedLimitInformation = 9
+
+	// jobObjectLimitKillOnJobClose kills the job's processes when the last
+	// handle to the job closes.
+	jobObjectLimitKillOnJobClose = 0x2000
+
+	// Flags for the limits set by jobLimits.
+	jobObjectLimitProcessTime   = 0x0002
+	jobObjectLimitPriorityClass = 0x0020
+	jobObjectLimitProcessMemory = 0x0100
+
+	// Windows priority classes used for Limits.Nice.
+	idlePriorityClass        = 0x0040
+	belowNormalPriorityClass = 0x4000
+	aboveNormalPriorityClass = 0x8000
+
+	// processSetQuotaTerminate is the access AssignProcessToJobObject
+	// needs.
+	processSetQuotaTerminate = 0x0100 | 0x0001
+
+	// processSuspendResume is the access NtResumeProcess needs.
+	processSuspendResume = 0x0800
+
+	// createSuspended creates a process with its main thread suspended.
+	createSuspended = 0x00000004
+)
+
+// ioCounters is the Windows IO_COUNTERS structure.
+type ioCounters struct {
+	ReadOperationCount, WriteOperationCount, OtherOperationCount uint64
+	ReadTransferCount, WriteTransferCount, OtherTransferCount    uint64
+}
+
+// jobObjectExtendedLimit is the Windows JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+// structure.
+type jobObjectExtendedLimit struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+	IoInfo                  ioCounters
+	ProcessMemoryLimit      uintptr
+	JobMemoryLimit          uintptr
+	PeakProcessMemoryUsed   uintptr
+	PeakJobMemoryUsed       uintptr
+}
+
+// runCommand runs cmd in a Job Object with limits that kills it when
+// patchenv's handle to the job closes, which happens when the program exits
+// for any reason.  Processes the command started that are still running
+// when it exits are killed too.  The command is created suspended and only
+// resumed once it's in the job, so neither it nor the processes it starts
+// can run outside of it, or before the limits apply.  If the job can't be
+// set up and there are no limits, the command runs without it.  Sandboxes
+// aren't supported.
+func runCommand(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	if sandbox != nil {
+		return errSandboxUnsupported
+	}
+	if limits.FileSize > 0 {
+		return errLimitUnsupported
+	}
+	job, err := newKillOnCloseJob(limits)
+	if err != nil {
+		if !limits.isZero() {
+			return fmt.Errorf("patchenv: can't create a job object for the command: %w", err)
+		}
+		log.Printf("[WARNING] patchenv: can't create a job object for the command: %s", err)
+		return cmd.Run()
+	}
+	defer syscall.CloseHandle(job)
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := assignToJob(job, cmd.Process.Pid); err != nil {
+		if !limits.isZero() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("patchenv: can't add the command to a job object: %w", err)
+		}
+		log.Printf("[WARNING] patchenv: can't add the command to a job object: %s", err)
+	}
+	if err := resumeProcess(cmd.Process.Pid); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("patchenv: can't resume the command: %w", err)
+	}
+	return cmd.Wait()
+}
+
+// newKillOnCloseJob creates a Job Object with limits whose processes are
+// killed when its last handle closes.
+func newKillOnCloseJob(limits Limits) (syscall.Handle, error) {
+	r, _, err := procCreateJobObjectW.Call(0, 0)
+	if r == 0 {
+		return 0, err
+	}
+	job := syscall.Handle(r)
+	info := jobLimits(limits)
+	r, _, err = procSetInformationJobObject.Call(uintptr(job), jobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+	if r == 0 {
+		syscall.CloseHandle(job)
+		return 0, err
+	}
+	return job, nil
+}
+
+// jobLimits returns the Job Object limits for limits.
+func jobLimits(limits Limits) jobObjectExtendedLimit {
+	info := jobObjectExtendedLimit{LimitFlags: jobObjectLimitKillOnJobClose}
+	if limits.CPUTime > 0 {
+		info.LimitFlags |= jobObjectLimitProcessTime
+		info.PerProcessUserTimeLimit = int64(limits.CPUTime / 100) // 100ns units
+	}
+	if limits.Memory > 0 {
+		info.LimitFlags |= jobObjectLimitProcessMemory
+		info.ProcessMemoryLimit = uintptr(limits.Memory)
+	}
+	if limits.Nice != 0 {
+		info.LimitFlags |= jobObjectLimitPriorityClass
+		switch {
+		case limits.Nice >= 10:
+			info.PriorityClass = idlePriorityClass
+		case limits.Nice > 0:
+			info.PriorityClass = belowNormalPriorityClass
+		default:
+			info.PriorityClass = aboveNormalPriorityClass
+		}
+	}
+	return info
+}
+
+// assignToJob adds the process with the given ID to job.
+func assignToJob(job syscall.Handle, pid int) error {
+	process, err := syscall.OpenProcess(processSetQuotaTerminate, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(process)
+	r, _, err := procAssignProcessToJobObject.Call(uintptr(job), uintptr(process))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// resumeProcess resumes the process with the given ID, which was created
+// suspended.
+func resumeProcess(pid int) error {
+	process, err := syscall.OpenProcess(processSuspendResume, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(process)
+	if status, _, _ := procNtResumeProcess.Call(uintptr(process)); status != 0 {
+		return fmt.Errorf("NtResumeProcess failed with status 0x%08x", status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package patchenv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrExecUnsupported is returned by ShellRunner on platforms that can't run
+// processes, like js/wasm and wasip1.  Use SetDefaultRunner or WithRunner
+// to run commands some other way there, or load variables from a file or
+// URL with another Source.
+var ErrExecUnsupported = errors.New("patchenv: running commands is not supported on this platform")
+
+// RunnerFunc adapts a function to the Runner interface, so a program can run
+// commands with, for example, an HTTP request to a service that runs them
+// or a function provided by a WebAssembly host.
+type RunnerFunc func(ctx context.Context, command string, env []string) ([]byte, error)
+
+// Run implements the Runner interface by calling f.
+func (f RunnerFunc) Run(ctx context.Context, command string, env []string) ([]byte, error) {
+	return f(ctx, command, env)
+}
+
+var (
+	// defaultRunnerMu guards defaultRunner.
+	defaultRunnerMu sync.RWMutex
+
+	// defaultRunner is the Runner set with SetDefaultRunner, or nil to use
+	// ShellRunner.
+	defaultRunner Runner
+)
+
+// SetDefaultRunner makes r the Runner used to run commands when none is
+// given with WithRunner or a CommandSource's Runner field, including by
+// Patch and by the "cmd:" source URIs.  A nil r restores ShellRunner.
+func SetDefaultRunner(r Runner) {
+	defaultRunnerMu.Lock()
+	defer defaultRunnerMu.Unlock()
+	defaultRunner = r
+}
+
+// DefaultRunner returns the Runner set with SetDefaultRunner, or
+// ShellRunner if none has been.
+func DefaultRunner() Runner {
+	defaultRunnerMu.RLock()
+	defer defaultRunnerMu.RUnlock()
+	if defaultRunner == nil {
+		return ShellRunner{}
+	}
+	return defaultRunner
+}
+
+var (
+	// failureOutputMu guards failureOutput.
+	failureOutputMu sync.RWMutex
+
+	// failureOutput is the writer set with SetFailureOutput, or nil to use
+	// os.Stdout.
+	failureOutput io.Writer
+)
+
+// SetFailureOutput makes w the writer that ShellRunner, and the runners in
+// the providers, write the stdout of a command that fails to, so the user
+// can diagnose the problem.  Programs whose own stdout is machine-readable,
+// like a credential helper whose output another program parses, should set
+// it to os.Stderr.  A nil w restores os.Stdout, the default.
+func SetFailureOutput(w io.Writer) {
+	failureOutputMu.Lock()
+	defer failureOutputMu.Unlock()
+	failureOutput = w
+}
+
+// FailureOutput returns the writer set with SetFailureOutput, or os.Stdout
+// if none has been.
+func FailureOutput() io.Writer {
+	failureOutputMu.RLock()
+	defer failureOutputMu.RUnlock()
+	if failureOutput == nil {
+		return os.Stdout
+	}
+	return failureOutput
+}
+
+// RunCommand runs cmd, which hasn't been started, the way ShellRunner runs
+// commands: it's killed if the program dies while it runs, and when ctx
+// enables air-gapped mode (ctx is the one PatchWith and Resolve pass to
+// Source.Load), it runs in a Sandbox with NoNetwork set, which fails on
+// platforms that don't support sandboxing.  Sources that run programs
+// should run them with it so air-gapped mode applies to them.  cmd should
+// have been created with exec.CommandContext(ctx, ...).
+func RunCommand(ctx context.Context, cmd *exec.Cmd) error {
+	var sandbox *Sandbox
+	if airGappedFrom(ctx) {
+		sandbox = &Sandbox{NoNetwork: true}
+	}
+	return runCommand(cmd, Limits{}, sandbox)
+}
@@ -0,0 +1,38 @@
+package patchenv
+
+import "errors"
+
+// Sandbox restricts what a command can do, for environments where the
+// helper that computes the environment is only semi-trusted.  Sandboxes
+// are only supported on Linux on amd64 and arm64, where they're enforced
+// with seccomp filters, which need no privileges and are inherited by the
+// command's child processes.
+//
+// The restrictions are on system calls, not paths, so they apply to every
+// file system.  Files the command inherits open, like its standard output,
+// can still be written.
+type Sandbox struct {
+	// NoNetwork stops the command from creating sockets other than Unix
+	// domain sockets, so it can't connect to the network, although it can
+	// still talk to local services.
+	NoNetwork bool
+
+	// ReadOnly stops the command from opening files for writing, creating,
+	// removing, or renaming files, and changing their metadata, including
+	// through file descriptors it opened read-only.  Those
+	// calls fail with EROFS, as they would on a read-only file system.
+	// That includes opening /dev/null for writing, so shell commands
+	// that redirect output to /dev/null fail too.
+	ReadOnly bool
+
+	// Seccomp is an additional seccomp filter to install, as a classic BPF
+	// program in the kernel's sock_filter format, like the output of
+	// libseccomp's seccomp_export_bpf or a compiled Docker seccomp
+	// profile.  It's installed after the NoNetwork and ReadOnly filters,
+	// and the kernel applies the most restrictive result of all of them.
+	Seccomp []byte
+}
+
+// errSandboxUnsupported is returned when a Sandbox is used on a platform
+// that doesn't support it.
+var errSandboxUnsupported = errors.New("patchenv: sandboxes are not supported on this platform")
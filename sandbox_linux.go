@@ -0,0 +1,198 @@
+package patchenv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Values and offsets from linux/seccomp.h.
+const (
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+	seccompModeFilter     = 2
+
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArgs = 16
+
+	prSetNoNewPrivs = 38
+)
+
+// fileWriteFlags are the open flags that make ReadOnly deny an open.
+const fileWriteFlags = syscall.O_WRONLY | syscall.O_RDWR | syscall.O_CREAT | syscall.O_TRUNC
+
+// sandboxSyscalls lists the system calls a Sandbox restricts, which
+// differ by architecture.  See the sandbox_linux_*.go files.
+type sandboxSyscalls struct {
+	// arch is the AUDIT_ARCH value of the architecture.
+	arch uint32
+
+	// maxNr is the first system call number that isn't of this
+	// architecture's native ABI, or zero if there is no limit.
+	maxNr uint32
+
+	// modify are the calls that create, remove, rename, or change files.
+	modify []uint32
+
+	// open maps the calls that open files to the index of their flags
+	// argument.
+	open map[uint32]int
+
+	// unavailable are calls that could bypass the filter's checks of
+	// their arguments, which fail with ENOSYS so libraries fall back to
+	// the checked calls.
+	unavailable []uint32
+
+	// socket is the socket call.
+	socket uint32
+}
+
+// runSandboxed runs cmd with the sandbox's seccomp filters, which are
+// installed on a dedicated thread and inherited by the command when that
+// thread starts it.  A filter can't be removed, so the thread is never
+// unlocked, which makes the Go runtime discard it when its goroutine
+// exits.
+func runSandboxed(cmd *exec.Cmd, limits Limits, sandbox *Sandbox) error {
+	filters, err := sandbox.filters()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := installFilters(filters); err != nil {
+			done <- err
+			return
+		}
+		done <- runLocked(cmd, limits)
+	}()
+	return <-done
+}
+
+// filters returns the seccomp programs that enforce the sandbox.
+func (s *Sandbox) filters() ([][]syscall.SockFilter, error) {
+	if currentSandboxSyscalls == nil {
+		return nil, errSandboxUnsupported
+	}
+	var filters [][]syscall.SockFilter
+	if s.NoNetwork || s.ReadOnly {
+		filters = append(filters, s.builtinFilter(currentSandboxSyscalls))
+	}
+	if len(s.Seccomp) > 0 {
+		prog, err := decodeFilter(s.Seccomp)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, prog)
+	}
+	return filters, nil
+}
+
+// builtinFilter returns the seccomp program for NoNetwork and ReadOnly.
+func (s *Sandbox) builtinFilter(calls *sandboxSyscalls) []syscall.SockFilter {
+	ld := func(offset uint32) syscall.SockFilter {
+		return bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offset)
+	}
+	ret := func(k uint32) syscall.SockFilter {
+		return bpfStmt(syscall.BPF_RET|syscall.BPF_K, k)
+	}
+
+	// Calls of other architectures, like 32-bit calls on a 64-bit
+	// system, have different numbers, so they're refused.
+	prog := []syscall.SockFilter{
+		ld(seccompDataArch),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, calls.arch, 1, 0),
+		ret(seccompRetKillProcess),
+		ld(seccompDataNr),
+	}
+	if calls.maxNr != 0 {
+		prog = append(prog,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, calls.maxNr, 0, 1),
+			ret(seccompRetKillProcess))
+	}
+	deny := func(nr uint32, errno syscall.Errno) {
+		prog = append(prog,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, 1),
+			ret(seccompRetErrno|uint32(errno)))
+	}
+
+	for _, nr := range calls.unavailable {
+		deny(nr, syscall.ENOSYS)
+	}
+	if s.ReadOnly {
+		for _, nr := range calls.modify {
+			deny(nr, syscall.EROFS)
+		}
+		for nr, arg := range calls.open {
+			// The low 32 bits of the flags argument, on a little-endian
+			// architecture.
+			prog = append(prog,
+				bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, 4),
+				ld(seccompDataArgs+8*uint32(arg)),
+				bpfJump(syscall.BPF_JMP|syscall.BPF_JSET|syscall.BPF_K, fileWriteFlags, 0, 1),
+				ret(seccompRetErrno|uint32(syscall.EROFS)),
+				ret(seccompRetAllow))
+		}
+	}
+	if s.NoNetwork {
+		prog = append(prog,
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, calls.socket, 0, 4),
+			ld(seccompDataArgs),
+			bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, syscall.AF_UNIX, 1, 0),
+			ret(seccompRetErrno|uint32(syscall.EACCES)),
+			ret(seccompRetAllow))
+	}
+	return append(prog, ret(seccompRetAllow))
+}
+
+// bpfStmt returns a BPF instruction without jumps.
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+// bpfJump returns a BPF jump instruction.
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// decodeFilter parses a BPF program in the kernel's sock_filter format.
+func decodeFilter(b []byte) ([]syscall.SockFilter, error) {
+	if len(b)%8 != 0 || len(b)/8 > 0xffff {
+		return nil, fmt.Errorf("patchenv: invalid seccomp filter of %d bytes", len(b))
+	}
+	prog := make([]syscall.SockFilter, len(b)/8)
+	for i := range prog {
+		insn := b[8*i:]
+		prog[i] = syscall.SockFilter{
+			Code: binary.LittleEndian.Uint16(insn),
+			Jt:   insn[2],
+			Jf:   insn[3],
+			K:    binary.LittleEndian.Uint32(insn[4:]),
+		}
+	}
+	return prog, nil
+}
+
+// installFilters installs seccomp filters on the calling thread, after
+// setting no_new_privs, which the kernel requires for unprivileged filters
+// and which stops the command from gaining privileges with setuid
+// programs.
+func installFilters(filters [][]syscall.SockFilter) error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("patchenv: can't set no_new_privs: %w", errno)
+	}
+	for _, prog := range filters {
+		fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP,
+			seccompModeFilter, uintptr(unsafe.Pointer(&fprog)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("patchenv: can't install seccomp filter: %w", errno)
+		}
+	}
+	return nil
+}
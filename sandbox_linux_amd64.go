@@ -0,0 +1,38 @@
+package patchenv
+
+import "syscall"
+
+// currentSandboxSyscalls are the system calls a Sandbox restricts on
+// linux/amd64.
+var currentSandboxSyscalls = &sandboxSyscalls{
+	arch: 0xc000003e, // AUDIT_ARCH_X86_64
+
+	// Calls numbered from 0x40000000 are of the x32 ABI.
+	maxNr: 0x40000000,
+
+	modify: []uint32{
+		syscall.SYS_CREAT,
+		syscall.SYS_MKDIR, syscall.SYS_MKDIRAT,
+		syscall.SYS_RMDIR, syscall.SYS_UNLINK, syscall.SYS_UNLINKAT,
+		syscall.SYS_RENAME, syscall.SYS_RENAMEAT, 316, // renameat2
+		syscall.SYS_LINK, syscall.SYS_LINKAT,
+		syscall.SYS_SYMLINK, syscall.SYS_SYMLINKAT,
+		syscall.SYS_MKNOD, syscall.SYS_MKNODAT,
+		syscall.SYS_TRUNCATE, syscall.SYS_FTRUNCATE,
+		syscall.SYS_CHMOD, syscall.SYS_FCHMOD, syscall.SYS_FCHMODAT, 452, // fchmodat2
+		syscall.SYS_CHOWN, syscall.SYS_LCHOWN, syscall.SYS_FCHOWN, syscall.SYS_FCHOWNAT,
+		syscall.SYS_UTIME, syscall.SYS_UTIMES, syscall.SYS_UTIMENSAT, syscall.SYS_FUTIMESAT,
+		syscall.SYS_SETXATTR, syscall.SYS_LSETXATTR, syscall.SYS_FSETXATTR,
+		syscall.SYS_REMOVEXATTR, syscall.SYS_LREMOVEXATTR, syscall.SYS_FREMOVEXATTR,
+	},
+	open: map[uint32]int{
+		syscall.SYS_OPEN:   1,
+		syscall.SYS_OPENAT: 2,
+		304:                2, // open_by_handle_at
+	},
+	unavailable: []uint32{
+		425, // io_uring_setup
+		437, // openat2
+	},
+	socket: syscall.SYS_SOCKET,
+}
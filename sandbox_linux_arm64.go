@@ -0,0 +1,33 @@
+package patchenv
+
+import "syscall"
+
+// currentSandboxSyscalls are the system calls a Sandbox restricts on
+// linux/arm64.
+var currentSandboxSyscalls = &sandboxSyscalls{
+	arch: 0xc00000b7, // AUDIT_ARCH_AARCH64
+
+	modify: []uint32{
+		syscall.SYS_MKDIRAT,
+		syscall.SYS_UNLINKAT,
+		syscall.SYS_RENAMEAT, syscall.SYS_RENAMEAT2,
+		syscall.SYS_LINKAT,
+		syscall.SYS_SYMLINKAT,
+		syscall.SYS_MKNODAT,
+		syscall.SYS_TRUNCATE, syscall.SYS_FTRUNCATE,
+		syscall.SYS_FCHMOD, syscall.SYS_FCHMODAT, 452, // fchmodat2
+		syscall.SYS_FCHOWN, syscall.SYS_FCHOWNAT,
+		syscall.SYS_UTIMENSAT,
+		syscall.SYS_SETXATTR, syscall.SYS_LSETXATTR, syscall.SYS_FSETXATTR,
+		syscall.SYS_REMOVEXATTR, syscall.SYS_LREMOVEXATTR, syscall.SYS_FREMOVEXATTR,
+	},
+	open: map[uint32]int{
+		syscall.SYS_OPENAT:            2,
+		syscall.SYS_OPEN_BY_HANDLE_AT: 2,
+	},
+	unavailable: []uint32{
+		425, // io_uring_setup
+		437, // openat2
+	},
+	socket: syscall.SYS_SOCKET,
+}
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+// +build linux,!amd64,!arm64
+
+package patchenv
+
+// currentSandboxSyscalls is nil because sandboxes aren't supported on this
+// architecture.
+var currentSandboxSyscalls *sandboxSyscalls
@@ -0,0 +1,154 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package patchenv
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// sandboxHelperVar is set in the environment of the test binary when it's
+// run as the sandboxed command by TestSandboxReadOnlyDescriptors.
+const sandboxHelperVar = "PATCHENV_TEST_SANDBOX_HELPER"
+
+// atFDCWD is AT_FDCWD, which makes the *at calls resolve relative paths
+// from the working directory.
+const atFDCWD = -100
+
+// openByHandleAt is the number of the open_by_handle_at call, which the
+// syscall package doesn't define on every architecture.
+var openByHandleAt = map[string]uintptr{"amd64": 304, "arm64": 265}[runtime.GOARCH]
+
+// fdBypasses are the calls that change a file through a descriptor opened
+// read-only, which ReadOnly must refuse.
+var fdBypasses = map[string]func(fd int, path string) error{
+	"fchmod": func(fd int, path string) error {
+		return syscall.Fchmod(fd, 0o777)
+	},
+	"fchown": func(fd int, path string) error {
+		return syscall.Fchown(fd, os.Getuid(), os.Getgid())
+	},
+	"fchownat": func(fd int, path string) error {
+		return syscall.Fchownat(atFDCWD, path, os.Getuid(), os.Getgid(), 0)
+	},
+	"ftruncate": func(fd int, path string) error {
+		return syscall.Ftruncate(fd, 0)
+	},
+	"fsetxattr": func(fd int, path string) error {
+		return xattrCall(syscall.SYS_FSETXATTR, uintptr(fd), "user.patchenv", []byte("x"))
+	},
+	"fremovexattr": func(fd int, path string) error {
+		return xattrCall(syscall.SYS_FREMOVEXATTR, uintptr(fd), "user.patchenv", nil)
+	},
+	"removexattr": func(fd int, path string) error {
+		p, err := syscall.BytePtrFromString(path)
+		if err != nil {
+			return err
+		}
+		return xattrCall(syscall.SYS_REMOVEXATTR, uintptr(unsafe.Pointer(p)), "user.patchenv", nil)
+	},
+	"open_by_handle_at": func(fd int, path string) error {
+		// The handle doesn't need to be valid, since the flags are checked
+		// before it is.
+		var handle [8 + 128]byte
+		handle[0] = 128
+		r, _, errno := syscall.Syscall(openByHandleAt, uintptr(fd),
+			uintptr(unsafe.Pointer(&handle[0])), syscall.O_RDWR)
+		if errno != 0 {
+			return errno
+		}
+		syscall.Close(int(r))
+		return nil
+	},
+	"lremovexattr": func(fd int, path string) error {
+		p, err := syscall.BytePtrFromString(path)
+		if err != nil {
+			return err
+		}
+		return xattrCall(syscall.SYS_LREMOVEXATTR, uintptr(unsafe.Pointer(p)), "user.patchenv", nil)
+	},
+}
+
+// xattrCall makes one of the xattr system calls on target, a descriptor
+// or a path, setting the attribute to value if it isn't nil.
+func xattrCall(nr, target uintptr, name string, value []byte) error {
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var args [3]uintptr
+	if value != nil {
+		args = [3]uintptr{uintptr(unsafe.Pointer(&value[0])), uintptr(len(value)), 0}
+	}
+	_, _, errno := syscall.Syscall6(nr, target, uintptr(unsafe.Pointer(n)), args[0], args[1], args[2], 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// TestSandboxHelper is the sandboxed command: it opens the file named by
+// sandboxHelperVar read-only, tries each bypass, and writes the name of
+// each one that wasn't refused with EROFS.
+func TestSandboxHelper(t *testing.T) {
+	path := os.Getenv(sandboxHelperVar)
+	if path == "" {
+		t.Skip("only run as a helper process")
+	}
+	fd, err := syscall.Open(path, syscall.O_RDONLY, 0)
+	if err != nil {
+		os.Stdout.WriteString("open: " + err.Error() + "\n")
+		os.Exit(1)
+	}
+	for name, bypass := range fdBypasses {
+		if err := bypass(fd, path); err != syscall.EROFS {
+			os.Stdout.WriteString(name + ": " + errString(err) + "\n")
+		}
+	}
+	os.Exit(0)
+}
+
+// errString describes err, which may be nil.
+func errString(err error) string {
+	if err == nil {
+		return "succeeded"
+	}
+	return err.Error()
+}
+
+func TestSandboxReadOnlyDescriptors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "target")
+	if err := os.WriteFile(path, []byte("content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSandboxHelper$")
+	cmd.Env = append(os.Environ(), sandboxHelperVar+"="+path)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := runCommand(cmd, Limits{}, &Sandbox{ReadOnly: true})
+	if err != nil && strings.Contains(err.Error(), "seccomp") {
+		t.Skipf("seccomp isn't available: %s", err)
+	}
+	if err != nil || out.Len() > 0 {
+		t.Errorf("calls weren't refused with EROFS (%v):\n%s", err, out.String())
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 || info.Size() != int64(len("content")) {
+		t.Errorf("file changed: mode %v, size %d", info.Mode().Perm(), info.Size())
+	}
+}
@@ -0,0 +1,211 @@
+package patchenv
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types that a VarSpec can declare.
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeFloat    = "float"
+	TypeBool     = "bool"
+	TypeDuration = "duration"
+	TypeURL      = "url"
+)
+
+// Schema declares the environment variables a program expects.  Pass it to
+// WithSchema to validate the patched environment, or call WriteMarkdown to
+// document it.
+//
+// The fields have json and yaml tags, so a Schema can also be read from a
+// manifest file with encoding/json or a YAML library:
+//
+//	vars:
+//	  - name: DATABASE_URL
+//	    type: url
+//	    required: true
+//	  - name: API_TOKEN
+//	    secret: true
+//	    pattern: "^[a-z0-9]{32}$"
+type Schema struct {
+	Vars []VarSpec `json:"vars" yaml:"vars"`
+}
+
+// VarSpec declares an expected environment variable.
+type VarSpec struct {
+	// Name is the name of the variable.
+	Name string `json:"name" yaml:"name"`
+
+	// Description explains the variable's purpose in generated
+	// documentation.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Type is one of the Type constants, and the value must parse as that
+	// type.  An empty Type is the same as TypeString.
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Default is the value the variable is set to if it's unset or empty
+	// after patching.  An empty Default means there is no default.
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Required means the variable must be non-empty after patching and
+	// defaults are applied.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+
+	// Secret means the variable's value is sensitive, so it's left out of
+	// error messages and documentation, and the variable is marked secret
+	// in the Result.
+	Secret bool `json:"secret,omitempty" yaml:"secret,omitempty"`
+
+	// Pattern is a regular expression that the entire value must match.
+	// An empty Pattern matches anything.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// apply marks result's variables that the schema declares secret, adds the
+// schema's defaults for variables that would be unset or empty, then
+// validates the variables result would produce.
+func (s *Schema) apply(result *Result) error {
+	for _, spec := range s.Vars {
+		if spec.Secret {
+			for i := range result.Vars {
+				if result.Vars[i].Name == spec.Name {
+					result.Vars[i].Secret = true
+				}
+			}
+		}
+		if spec.Default == "" {
+			continue
+		}
+		if value, _ := result.lookup(spec.Name); value == "" {
+			result.Vars = append(result.Vars, Var{Name: spec.Name, Value: spec.Default, Secret: spec.Secret})
+		}
+	}
+	return s.validate(result.lookup)
+}
+
+// validate checks the variables returned by lookup against the schema,
+// returning a *ValidationError describing every problem it finds.
+func (s *Schema) validate(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, spec := range s.Vars {
+		value, _ := lookup(spec.Name)
+		if value == "" {
+			if spec.Required {
+				errs = append(errs, fmt.Errorf("%s is required but not set", spec.Name))
+			}
+			continue
+		}
+		if err := spec.check(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// check returns an error if value isn't valid for the variable.
+func (spec *VarSpec) check(value string) error {
+	var err error
+	switch spec.Type {
+	case "", TypeString:
+	case TypeInt:
+		_, err = strconv.ParseInt(value, 0, 64)
+	case TypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case TypeBool:
+		_, err = strconv.ParseBool(value)
+	case TypeDuration:
+		_, err = time.ParseDuration(value)
+	case TypeURL:
+		_, err = parseURL(value)
+	default:
+		return fmt.Errorf("%s has unknown type %q in schema", spec.Name, spec.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s=%s is not a valid %s", spec.Name, spec.quote(value), spec.Type)
+	}
+
+	if spec.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + spec.Pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("%s has invalid pattern in schema: %s", spec.Name, err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("%s=%s doesn't match pattern %q",
+				spec.Name, spec.quote(value), spec.Pattern)
+		}
+	}
+	return nil
+}
+
+// quote returns value quoted for an error message, or a placeholder if the
+// variable is secret.
+func (spec *VarSpec) quote(value string) string {
+	if spec.Secret {
+		return "(secret)"
+	}
+	return strconv.Quote(value)
+}
+
+// WriteMarkdown writes documentation of the schema's variables to w as a
+// Markdown table.
+func (s *Schema) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("| Name | Type | Required | Default | Description |\n")
+	b.WriteString("| ---- | ---- | -------- | ------- | ----------- |\n")
+	for _, spec := range s.Vars {
+		typ := spec.Type
+		if typ == "" {
+			typ = TypeString
+		}
+		required := "no"
+		if spec.Required {
+			required = "yes"
+		}
+		def := ""
+		if spec.Default != "" {
+			def = "`" + spec.Default + "`"
+			if spec.Secret {
+				def = "(secret)"
+			}
+		}
+		description := spec.Description
+		if spec.Pattern != "" {
+			description = strings.TrimSpace(description + " Must match `" + spec.Pattern + "`.")
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", spec.Name, typ, required,
+			markdownEscape(def), markdownEscape(description))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscape escapes s for use in a Markdown table cell.
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// ValidationError is returned when the environment doesn't satisfy a
+// Schema.
+type ValidationError struct {
+	// Errors describe each problem that was found.
+	Errors []error
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "patchenv: environment doesn't match schema: " + strings.Join(msgs, "; ")
+}
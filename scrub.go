@@ -0,0 +1,84 @@
+package patchenv
+
+import (
+	"fmt"
+	"os"
+)
+
+// Scrub unsets the secret variables PatchWith set in the process's
+// environment, and the variables it set to the paths of files it wrote
+// (from an envelope's "files"), whose contents it overwrites with zeros
+// before removing them.  It's meant to be deferred by short-lived tools
+// that go on to run long-running commands, so the secrets don't outlive
+// their use:
+//
+//	patchenv.MustPatch()
+//	defer patchenv.Scrub()
+//
+// Variables the program has since changed itself are left alone, although
+// the files are still removed, as are the files Resolve wrote.  Scrub works
+// after Seal, since it only removes what PatchWith set.  It returns the
+// first error it encounters, after scrubbing everything it can.
+func Scrub() error {
+	vars := ledgerVars(func(v Var) bool { return v.Secret || v.File })
+	var first error
+	for _, v := range vars {
+		if value, ok := os.LookupEnv(v.Name); ok && value == v.Value {
+			if err := os.Unsetenv(v.Name); err != nil && first == nil {
+				first = fmt.Errorf("patchenv: can't unset %s: %w", v.Name, err)
+			}
+		}
+		if v.File {
+			if err := shred(v.Value); err != nil && first == nil {
+				first = fmt.Errorf("patchenv: can't scrub the file for %s: %w", v.Name, err)
+			}
+		}
+	}
+	recordLedger(unsets(vars))
+	for _, v := range takeFiles() {
+		if err := shred(v.Value); err != nil && first == nil {
+			first = fmt.Errorf("patchenv: can't scrub the file for %s: %w", v.Name, err)
+		}
+	}
+	return first
+}
+
+// shred overwrites the file at path with zeros and removes it.  A file
+// that no longer exists is ignored.
+func shred(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The file may have been written read-only.
+	if err := os.Chmod(path, 0o600); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(make([]byte, info.Size()))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(path); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// unsets returns changes that unset vars.
+func unsets(vars []Var) Changes {
+	changes := make(Changes, len(vars))
+	for i, v := range vars {
+		changes[i] = Var{Name: v.Name, Unset: true}
+	}
+	return changes
+}
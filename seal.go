@@ -0,0 +1,48 @@
+package patchenv
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// ErrSealed is returned (wrapped with where Seal was called) by PatchWith
+// and the functions that use it after the environment has been sealed.
+var ErrSealed = errors.New("patchenv: the environment is sealed")
+
+// seal records where Seal was called, or is empty if it hasn't been.
+var seal struct {
+	sync.Mutex
+	caller string
+}
+
+// Seal marks the environment as consumed: after it's called, PatchWith (and
+// so Patch, MustPatch, Decode, and Refresher) returns an error wrapping
+// ErrSealed instead of changing the environment.  Call it once the program
+// has read its configuration, to catch patches that land too late to have
+// any effect, such as a Patch call in an init function that runs after the
+// package whose settings it was meant to change.  The error says where Seal
+// was called.  Resolve isn't affected, since it doesn't change the
+// environment.
+func Seal() {
+	caller := "an unknown location"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	seal.Lock()
+	defer seal.Unlock()
+	if seal.caller == "" {
+		seal.caller = caller
+	}
+}
+
+// checkSealed returns an error wrapping ErrSealed if Seal has been called.
+func checkSealed() error {
+	seal.Lock()
+	defer seal.Unlock()
+	if seal.caller != "" {
+		return fmt.Errorf("%w (by %s)", ErrSealed, seal.caller)
+	}
+	return nil
+}
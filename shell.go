@@ -0,0 +1,128 @@
+package patchenv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// shellVar is the name of the environment variable that indicates the user's
+// configured shell.
+const shellVar = "SHELL"
+
+// NoChangesExitCode is the exit status a command can use to report that
+// there is nothing to change.  ShellRunner returns ErrNoChanges when the
+// command exits with this status, so the Result has NoChanges set instead
+// of the command being treated as having failed.  The value is passed to
+// the command in the PATCH_ENV_NO_CHANGES_EXIT environment variable.
+const NoChangesExitCode = 80
+
+// ShellRunner is the default Runner.  It runs the command with the user's
+// shell, as indicated by the SHELL environment variable.  The shell program
+// is assumed to accept the POSIX "-c" command-line option, unless its
+// arguments are set with RegisterShell, as they are for cmd and PowerShell.
+// If SHELL isn't set, the shell set for the operating system with
+// RegisterDefaultShell is used, which is rc on Plan 9.  Otherwise, the
+// command string is passed as the first argument to exec.Command (on
+// Windows SHELL usually isn't set, but programs parse their own
+// command-line arguments, so this is the expected behavior there).
+//
+// If the command returns an error status other than NoChangesExitCode, its
+// stdout and stderr are written to os.Stdout (or the writer set with
+// SetFailureOutput) and os.Stderr respectively to help the user diagnose
+// the problem.  Otherwise, its stderr is discarded.
+//
+// If the program dies while the command is running, the command is killed
+// rather than left running as an orphan that holds locks or waits
+// invisibly for input: on Linux it gets SIGKILL as its parent-death signal,
+// and on Windows it runs in a Job Object that is killed when the program's
+// handle to it closes.  The Job Object also kills any processes the
+// command left running when it exits.
+//
+// On js/wasm and wasip1, where processes can't be started, it returns
+// ErrExecUnsupported.
+type ShellRunner struct {
+	// Limits restricts the resources the command can use.
+	Limits Limits
+
+	// Sandbox restricts what the command can do, or is nil to run it
+	// unrestricted.
+	Sandbox *Sandbox
+
+	// User is the name or numeric ID of the user to run the command as,
+	// or empty to run it as the current user.  A program running as root
+	// can use it to run the helper with least privilege.  The command
+	// runs with the user's groups, and HOME, USER, and LOGNAME are set
+	// for the user.  Switching users needs privileges, and it isn't
+	// supported on Windows, where it needs the other user's password.
+	User string
+}
+
+// Run implements the Runner interface.  The command is killed if ctx is
+// done before it exits.
+func (r ShellRunner) Run(ctx context.Context, cmdString string, env []string) ([]byte, error) {
+	var cmd *exec.Cmd
+	trace := traceFrom(ctx)
+
+	shell := os.Getenv(shellVar)
+	if shell != "" {
+		trace.printf("using shell %s from %s", shell, shellVar)
+	} else if shell = defaultShell(); shell != "" {
+		trace.printf("%s is not set, using default shell %s", shellVar, shell)
+	}
+	if shell == "" {
+		trace.printf("%s is not set, running command directly", shellVar)
+		cmd = exec.CommandContext(ctx, cmdString)
+	} else {
+		cmd = exec.CommandContext(ctx, shell, append(ShellArgs(shell), cmdString)...)
+	}
+	trace.printf("argv: %q", cmd.Args)
+	trace.printf("added to environment: %s", strings.Join(env, " "))
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if r.User != "" {
+		if err := runAs(cmd, r.User); err != nil {
+			return nil, err
+		}
+		trace.printf("running as user %s", r.User)
+	}
+
+	outBuf := new(bytes.Buffer)
+	errBuf := new(bytes.Buffer)
+	var exceeded func() error
+	cmd.Stdout, exceeded = limitWriter(ctx, outBuf)
+	cmd.Stderr = errBuf
+
+	start := time.Now()
+	err := runCommand(cmd, r.Limits, r.Sandbox)
+	trace.printf("command exited after %s (%v) with %d bytes of stdout and %d bytes of stderr",
+		time.Since(start).Round(time.Microsecond), cmd.ProcessState, outBuf.Len(), errBuf.Len())
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("patchenv command %q timed out: %w", cmdString, ctx.Err())
+	}
+	if err := exceeded(); err != nil {
+		return nil, err
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == NoChangesExitCode {
+		return nil, ErrNoChanges
+	}
+	if err == ErrExecUnsupported {
+		return nil, err
+	}
+	if err != nil {
+		_, _ = FailureOutput().Write(outBuf.Bytes())
+		_, _ = os.Stderr.Write(errBuf.Bytes())
+		return nil, fmt.Errorf("patchenv command %q failed: %q",
+			cmdString, err.Error())
+	}
+
+	return outBuf.Bytes(), nil
+}
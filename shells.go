@@ -0,0 +1,82 @@
+package patchenv
+
+import (
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	// shellsMu guards shellArgs and defaultShells.
+	shellsMu sync.RWMutex
+
+	// shellArgs maps the names of shells to the arguments that come
+	// before a command string to make them run it.
+	shellArgs = map[string][]string{
+		"cmd":        {"/d", "/s", "/c"},
+		"powershell": {"-NoProfile", "-NonInteractive", "-Command"},
+		"pwsh":       {"-NoProfile", "-NonInteractive", "-Command"},
+	}
+
+	// defaultShells maps operating systems, as in runtime.GOOS, to the
+	// shell ShellRunner uses when SHELL isn't set.  Plan 9 doesn't set
+	// SHELL, but always has rc.
+	defaultShells = map[string]string{
+		"plan9": "/bin/rc",
+	}
+)
+
+// RegisterShell sets the arguments that make the shell called name run a
+// command string that follows them, for shells that don't accept the POSIX
+// "-c" option like sh, bash, zsh, fish, and rc do.  The name is matched
+// against the base name of the shell's path, without any ".exe", ignoring
+// case.  The built-in table covers cmd, powershell, and pwsh.
+func RegisterShell(name string, args ...string) {
+	shellsMu.Lock()
+	defer shellsMu.Unlock()
+	shellArgs[shellName(name)] = append([]string(nil), args...)
+}
+
+// RegisterDefaultShell sets the shell that ShellRunner uses on goos, an
+// operating system as in runtime.GOOS, when SHELL isn't set.  An empty
+// shell removes the default, so the command string is run directly.
+// Plan 9 defaults to /bin/rc, and other systems to running directly.
+func RegisterDefaultShell(goos, shell string) {
+	shellsMu.Lock()
+	defer shellsMu.Unlock()
+	if shell == "" {
+		delete(defaultShells, goos)
+	} else {
+		defaultShells[goos] = shell
+	}
+}
+
+// ShellArgs returns the arguments that come before a command string to make
+// shell, a path or name, run it: the ones set with RegisterShell, or "-c".
+// It's exported for Runners that start shells elsewhere, like inside a
+// container.
+func ShellArgs(shell string) []string {
+	shellsMu.RLock()
+	defer shellsMu.RUnlock()
+	if args, ok := shellArgs[shellName(shell)]; ok {
+		return append([]string(nil), args...)
+	}
+	return []string{"-c"}
+}
+
+// defaultShell returns the shell to use on this system when SHELL isn't
+// set, or "" to run the command string directly.
+func defaultShell() string {
+	shellsMu.RLock()
+	defer shellsMu.RUnlock()
+	return defaultShells[runtime.GOOS]
+}
+
+// shellName returns the key of shell in shellArgs.  Both kinds of slash
+// are separators, since Windows shells can be named on any system, for
+// example inside a container.
+func shellName(shell string) string {
+	name := path.Base(strings.ReplaceAll(shell, "\\", "/"))
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
@@ -0,0 +1,157 @@
+package patchenv
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// SizeLimits restricts how much a source can produce, to protect the
+// program from a malicious or buggy helper that writes gigabytes of output.
+// Zero fields mean no limit.
+type SizeLimits struct {
+	// MaxVars is the maximum number of variables a source can set or
+	// unset.
+	MaxVars int
+
+	// MaxValueBytes is the maximum length of a variable's value.
+	MaxValueBytes int
+
+	// MaxTotalBytes is the maximum size of a command's, plugin's, file's,
+	// or URL's output, which stops being read when it's exceeded.  For
+	// other sources, it limits the total length of the variables' names
+	// and values.
+	MaxTotalBytes int64
+}
+
+// WithSizeLimits makes PatchWith and Resolve fail with a *SizeLimitError,
+// without changing the environment, if a source exceeds limits.
+func WithSizeLimits(limits SizeLimits) Option {
+	return func(cfg *config) {
+		cfg.sizeLimits = limits
+	}
+}
+
+// SizeLimitError is returned by PatchWith and Resolve when a source exceeds
+// one of the SizeLimits.
+type SizeLimitError struct {
+	// Limit is the name of the SizeLimits field that was exceeded.
+	Limit string
+
+	// Max is the value of the limit.
+	Max int64
+
+	// Name is the variable whose value was too long, for MaxValueBytes.
+	Name string
+}
+
+// Error implements the error interface.
+func (e *SizeLimitError) Error() string {
+	switch e.Limit {
+	case "MaxVars":
+		return fmt.Sprintf("patchenv: source produced more than %d variables", e.Max)
+	case "MaxValueBytes":
+		return fmt.Sprintf("patchenv: the value of %s is longer than %d bytes", e.Name, e.Max)
+	}
+	return fmt.Sprintf("patchenv: source produced more than %d bytes", e.Max)
+}
+
+// check returns a *SizeLimitError if vars exceed the limits.
+func (l SizeLimits) check(vars []Var) error {
+	if l.MaxVars > 0 && len(vars) > l.MaxVars {
+		return &SizeLimitError{Limit: "MaxVars", Max: int64(l.MaxVars)}
+	}
+	var total int64
+	for _, v := range vars {
+		if l.MaxValueBytes > 0 && len(v.Value) > l.MaxValueBytes {
+			return &SizeLimitError{Limit: "MaxValueBytes", Max: int64(l.MaxValueBytes), Name: v.Name}
+		}
+		total += int64(len(v.Name) + len(v.Value))
+	}
+	if l.MaxTotalBytes > 0 && total > l.MaxTotalBytes {
+		return &SizeLimitError{Limit: "MaxTotalBytes", Max: l.MaxTotalBytes}
+	}
+	return nil
+}
+
+// sizeLimitsKey is the context key for the size limits of the source being
+// loaded.
+type sizeLimitsKey struct{}
+
+// withSizeLimits returns a copy of ctx that carries limits, if they limit
+// the size of the output.
+func withSizeLimits(ctx context.Context, limits SizeLimits) context.Context {
+	if limits.MaxTotalBytes <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, sizeLimitsKey{}, limits)
+}
+
+// maxOutput returns the maximum size of output that ctx allows, or zero
+// for no limit.
+func maxOutput(ctx context.Context) int64 {
+	limits, _ := ctx.Value(sizeLimitsKey{}).(SizeLimits)
+	return limits.MaxTotalBytes
+}
+
+// limitedWriter is a Writer that fails once more than max bytes have been
+// written to it, so a command's output stops being collected.
+type limitedWriter struct {
+	w   io.Writer
+	n   int64
+	max int64
+
+	// err is the *SizeLimitError returned once the limit is exceeded.
+	err error
+}
+
+// limitWriter returns w limited to the output size ctx allows, and a
+// function that returns the *SizeLimitError if the limit was exceeded.
+func limitWriter(ctx context.Context, w io.Writer) (io.Writer, func() error) {
+	max := maxOutput(ctx)
+	if max <= 0 {
+		return w, func() error { return nil }
+	}
+	lw := &limitedWriter{w: w, max: max}
+	return lw, func() error { return lw.err }
+}
+
+// Write implements the io.Writer interface.
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.err != nil {
+		return 0, lw.err
+	}
+	if lw.n+int64(len(p)) > lw.max {
+		lw.err = &SizeLimitError{Limit: "MaxTotalBytes", Max: lw.max}
+		return 0, lw.err
+	}
+	lw.n += int64(len(p))
+	return lw.w.Write(p)
+}
+
+// limitedReader is a Reader that fails once more than max bytes have been
+// read from it.
+type limitedReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+// limitReader returns r limited to the output size ctx allows.
+func limitReader(ctx context.Context, r io.Reader) io.Reader {
+	max := maxOutput(ctx)
+	if max <= 0 {
+		return r
+	}
+	return &limitedReader{r: io.LimitReader(r, max+1), max: max}
+}
+
+// Read implements the io.Reader interface.
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+	if lr.n > lr.max {
+		return 0, &SizeLimitError{Limit: "MaxTotalBytes", Max: lr.max}
+	}
+	return n, err
+}
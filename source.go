@@ -0,0 +1,103 @@
+package patchenv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+// protocolVar is the environment variable that tells the command the
+// highest payload protocol version patchenv understands.
+const protocolVar = "PATCH_ENV_PROTOCOL"
+
+// protocolVersion is the highest payload protocol version that Parser
+// understands.  Version 1 is the "var=value" line protocol and version 2
+// adds the JSON envelope.
+const protocolVersion = 2
+
+// ErrNoChanges is returned by a Source's Load method to report that there
+// is nothing to change, as opposed to returning zero variables.  PatchWith
+// and Resolve don't return it; they set Result.NoChanges instead.
+var ErrNoChanges = errors.New("patchenv: no changes")
+
+// Source produces the variables that PatchWith sets in the environment.
+// The default source runs the command in PATCH_ENV_COMMAND; use WithSource
+// to load variables from somewhere else.
+type Source interface {
+	// Load returns the variables to set, or ErrNoChanges if there is
+	// nothing to change.  It should give up and return an error when ctx
+	// is done.
+	Load(ctx context.Context) ([]Var, error)
+}
+
+// Runner runs a patch command and returns what it wrote to its standard
+// output.  The default Runner is ShellRunner; use WithRunner or
+// SetDefaultRunner to run commands some other way.
+type Runner interface {
+	// Run runs command with the variables in env (in "name=value" form)
+	// added to its environment, and returns its output, or an error if the
+	// command couldn't be run or failed.  It should kill the command and
+	// return an error when ctx is done.
+	Run(ctx context.Context, command string, env []string) ([]byte, error)
+}
+
+// CommandSource is a Source that runs a command and parses its output.  The
+// command's environment describes patchenv's capabilities:
+//
+//	PATCH_ENV_PROTOCOL  highest payload protocol version Parser understands
+//	PATCH_ENV_FORMATS   payload formats Parser accepts, e.g. "lines,json"
+//	PATCH_ENV_FEATURES  JSON envelope features, e.g. "secret,ttl,unset"
+//	PATCH_ENV_PLATFORM  operating system and architecture, e.g. "linux/amd64"
+//
+// and the process running it:
+//
+//	PATCH_ENV_PARENT_PID  process ID
+//	PATCH_ENV_PARENT_EXE  path of the executable
+//	PATCH_ENV_INVOCATION  "startup" or "reload"; see Invocation
+//
+// A command reports that there is nothing to change by exiting with the
+// status in PATCH_ENV_NO_CHANGES_EXIT (see NoChangesExitCode) or by
+// printing a JSON envelope with "noChanges" set.
+//
+// Commands can check them to decide what kind of payload to produce.
+type CommandSource struct {
+	// Command is the command to run.
+	Command string
+
+	// Runner runs the command, or is nil to use DefaultRunner.
+	Runner Runner
+
+	// Parser parses the command's output, or is nil to use the default
+	// Parser.
+	Parser *Parser
+
+	// Invocation says why the command is being run.  If it's empty,
+	// InvocationStartup is used.
+	Invocation Invocation
+}
+
+// runner returns the Runner that runs the command.
+func (s *CommandSource) runner() Runner {
+	if s.Runner == nil {
+		return DefaultRunner()
+	}
+	return s.Runner
+}
+
+// Load implements the Source interface.
+func (s *CommandSource) Load(ctx context.Context) ([]Var, error) {
+	runner := s.runner()
+	if airGappedFrom(ctx) {
+		runner = noNetwork(runner)
+	}
+	out, err := runner.Run(ctx, s.Command, handshakeEnv(s.Invocation))
+	if err != nil {
+		return nil, err
+	}
+
+	parser := s.Parser
+	if parser == nil {
+		parser = &Parser{}
+	}
+	return parser.withFormatFromEnv().Parse(bytes.NewReader(out))
+}
@@ -0,0 +1,84 @@
+package patchenv
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counters for ReadStats.  They're separate variables, rather than fields
+// of a struct, so they're 64-bit aligned for the atomic package on 32-bit
+// platforms.
+var (
+	statPatches         uint64
+	statPatchFailures   uint64
+	statVarsApplied     uint64
+	statLoads           uint64
+	statLoadFailures    uint64
+	statLoadNanos       int64
+	statCacheHits       uint64
+	statCacheMisses     uint64
+	statRefreshes       uint64
+	statRefreshFailures uint64
+	statLastRefresh     int64
+)
+
+// Stats counts what patchenv has done in the process since it started, for
+// monitoring.  The patchenvprometheus module exports them as Prometheus
+// metrics.
+type Stats struct {
+	// Patches counts the calls to PatchWith (including through Patch),
+	// and PatchFailures the ones that returned errors.
+	Patches       uint64
+	PatchFailures uint64
+
+	// VarsApplied counts the variables PatchWith set or unset.
+	VarsApplied uint64
+
+	// Loads counts the times PatchWith and Resolve loaded variables from
+	// a command or Source, including fallbacks, and LoadFailures the ones
+	// that failed.  LoadTime is the total time they took.
+	Loads        uint64
+	LoadFailures uint64
+	LoadTime     time.Duration
+
+	// CacheHits and CacheMisses count the calls to CachedSource.Load that
+	// returned cached variables and that loaded them from the wrapped
+	// Source.
+	CacheHits   uint64
+	CacheMisses uint64
+
+	// Refreshes counts the refreshes done by Refreshers, and
+	// RefreshFailures the ones that failed.  LastRefresh is the time of the
+	// last one that succeeded, or the zero time if none has.
+	Refreshes       uint64
+	RefreshFailures uint64
+	LastRefresh     time.Time
+}
+
+// ReadStats returns the current Stats.
+func ReadStats() Stats {
+	s := Stats{
+		Patches:         atomic.LoadUint64(&statPatches),
+		PatchFailures:   atomic.LoadUint64(&statPatchFailures),
+		VarsApplied:     atomic.LoadUint64(&statVarsApplied),
+		Loads:           atomic.LoadUint64(&statLoads),
+		LoadFailures:    atomic.LoadUint64(&statLoadFailures),
+		LoadTime:        time.Duration(atomic.LoadInt64(&statLoadNanos)),
+		CacheHits:       atomic.LoadUint64(&statCacheHits),
+		CacheMisses:     atomic.LoadUint64(&statCacheMisses),
+		Refreshes:       atomic.LoadUint64(&statRefreshes),
+		RefreshFailures: atomic.LoadUint64(&statRefreshFailures),
+	}
+	if last := atomic.LoadInt64(&statLastRefresh); last != 0 {
+		s.LastRefresh = time.Unix(0, last)
+	}
+	return s
+}
+
+// count adds one to counter, and also to failures if err isn't nil.
+func count(counter, failures *uint64, err error) {
+	atomic.AddUint64(counter, 1)
+	if err != nil {
+		atomic.AddUint64(failures, 1)
+	}
+}
@@ -0,0 +1,45 @@
+package patchenv
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteTrampoline writes a self-contained script that re-creates the
+// result's environment and then runs the command given as its arguments,
+// for handing the environment to systems that can't run patchenv:
+//
+//	./env.sh terraform plan
+//
+// format selects the script's language: FormatShell writes a POSIX shell
+// script, and FormatPowerShell a PowerShell script.  Without arguments,
+// the script only sets the variables, so it can also be sourced.  The
+// script holds the values of secret variables, so it should be stored
+// readable only by the user who runs it.
+func (r *Result) WriteTrampoline(w io.Writer, format Format) error {
+	var body bytes.Buffer
+	if err := r.Export(&body, format); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	switch format {
+	case FormatShell:
+		b.WriteString("#!/bin/sh\n# Generated by patchenv.  Usage: script [command [arg...]]\n")
+		b.Write(body.Bytes())
+		b.WriteString("if [ \"$#\" -gt 0 ]; then\n  exec \"$@\"\nfi\n")
+	case FormatPowerShell:
+		b.WriteString("# Generated by patchenv.  Usage: script [command [arg...]]\n")
+		b.Write(body.Bytes())
+		b.WriteString("if ($args.Count -gt 0) {\n" +
+			"  $command, $rest = $args\n" +
+			"  & $command @rest\n" +
+			"  exit $LASTEXITCODE\n" +
+			"}\n")
+	default:
+		return fmt.Errorf("patchenv: can't write a trampoline script in %s format", format)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,68 @@
+package patchenv
+
+import (
+	"fmt"
+	"log"
+)
+
+// Transform rewrites the value of a variable after it's loaded.  See
+// WithTransform.
+type Transform func(value string) (string, error)
+
+// transformRule applies a Transform to the variables with the given names.
+type transformRule struct {
+	transform Transform
+	names     []string
+}
+
+// WithTransform makes PatchWith and Resolve rewrite the values of the named
+// variables with t before the environment is updated, for payloads that
+// are shared between systems that spell values differently:
+//
+//	patchenv.PatchWith(patchenv.WithTransform(patchenv.WindowsToWSLPath, "GOPATH"))
+//
+// Transforms run in the order they're given, before the Schema is applied.
+// If a transform returns an error, PatchWith and Resolve return it without
+// changing the environment.
+func WithTransform(t Transform, names ...string) Option {
+	return func(cfg *config) {
+		cfg.transforms = append(cfg.transforms, transformRule{transform: t, names: names})
+	}
+}
+
+// applyTransforms returns a copy of vars with the values rewritten by the
+// configured transforms.  Unset variables are left alone.
+func (cfg *config) applyTransforms(vars []Var) ([]Var, error) {
+	if len(cfg.transforms) == 0 {
+		return vars, nil
+	}
+	vars = append([]Var(nil), vars...)
+	for _, rule := range cfg.transforms {
+		for _, name := range rule.names {
+			for i := range vars {
+				if vars[i].Name != name || vars[i].Unset {
+					continue
+				}
+				var value string
+				err := cfg.guard("transform of "+name, func() error {
+					var err error
+					value, err = rule.transform(vars[i].Value)
+					return err
+				})
+				if perr, ok := err.(*PanicError); ok {
+					if cfg.panicPolicy == PanicContinue {
+						log.Printf("[WARNING] %s", perr)
+						continue
+					}
+					return nil, perr
+				}
+				if err != nil {
+					return nil, fmt.Errorf("patchenv: can't transform %s: %w", name, err)
+				}
+				vars[i].Value = value
+				cfg.recordTransform(name, rule.transform)
+			}
+		}
+	}
+	return vars, nil
+}
@@ -0,0 +1,167 @@
+package patchenv
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often URLSource and PollingSource check for
+// changes if their interval is zero.
+const defaultPollInterval = time.Minute
+
+// URLSource is a Source that fetches a document in the "var=value" format,
+// or a JSON envelope, from an HTTP or HTTPS URL.
+//
+// URLSource is a Watcher that polls the URL every PollInterval with a
+// conditional request, using the ETag or Last-Modified header of the last
+// response, so a Refresher applies changes without fetching and parsing
+// the document when it hasn't changed.
+type URLSource struct {
+	// URL is the URL of the document.
+	URL string
+
+	// Header holds additional request headers, like Authorization.
+	Header http.Header
+
+	// Parser parses the document, or is nil to use the default Parser.
+	Parser *Parser
+
+	// PollInterval is how often Wait checks for changes, or zero to check
+	// every minute.
+	PollInterval time.Duration
+
+	// Client makes the requests, or is nil to use http.DefaultClient.
+	Client *http.Client
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	body         []byte
+
+	// fetched is whether body holds a fetched document.
+	fetched bool
+
+	// pending is a changed document fetched by Wait for the next Load.
+	pending []byte
+}
+
+// Load implements the Source interface.
+func (s *URLSource) Load(ctx context.Context) ([]Var, error) {
+	s.mu.Lock()
+	body := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	if body == nil {
+		var err error
+		if body, _, err = s.fetch(ctx, false); err != nil {
+			return nil, err
+		}
+	}
+	parser := s.Parser
+	if parser == nil {
+		parser = &Parser{}
+	}
+	return parser.Parse(bytes.NewReader(body))
+}
+
+// Wait implements the Watcher interface.  It returns when the document
+// differs from the one the last Load or Wait fetched.  If neither has
+// fetched it yet, Wait fetches it first to have one to compare with, so
+// the first poll doesn't report a change that didn't happen.
+func (s *URLSource) Wait(ctx context.Context) error {
+	s.mu.Lock()
+	fetched := s.fetched
+	s.mu.Unlock()
+	if !fetched {
+		if _, _, err := s.fetch(ctx, false); err != nil {
+			return err
+		}
+	}
+
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		body, changed, err := s.fetch(ctx, true)
+		if err != nil {
+			return err
+		}
+		if changed {
+			s.mu.Lock()
+			s.pending = body
+			s.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// fetch requests the document, conditionally if conditional is true, and
+// returns it and whether it differs from the last one fetched.  A response
+// saying the document wasn't modified returns a nil body.
+func (s *URLSource) fetch(ctx context.Context, conditional bool) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	for name, values := range s.Header {
+		req.Header[name] = values
+	}
+	s.mu.Lock()
+	if conditional {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+	s.mu.Unlock()
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, false, fmt.Errorf("patchenv: %s returned %s: %s", s.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	body, err := io.ReadAll(limitReader(ctx, resp.Body))
+	if err != nil {
+		return nil, false, fmt.Errorf("patchenv: can't read %s: %w", s.URL, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := !bytes.Equal(body, s.body)
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	s.body, s.fetched = body, true
+	return body, changed, nil
+}
+
+// UsesNetwork implements the NetworkUser interface.  It returns true.
+func (s *URLSource) UsesNetwork() bool {
+	return true
+}
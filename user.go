@@ -0,0 +1,29 @@
+package patchenv
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errUserUnsupported is returned when ShellRunner.User is set on a platform
+// that can't run commands as another user.
+var errUserUnsupported = errors.New("patchenv: running commands as another user is not supported on this platform")
+
+// setUserEnv sets HOME, USER, and LOGNAME in cmd's environment to the
+// values for the user it runs as.
+func setUserEnv(cmd *exec.Cmd, name, home string) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	replaced := make([]string, 0, len(env)+3)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "HOME=") || strings.HasPrefix(kv, "USER=") || strings.HasPrefix(kv, "LOGNAME=") {
+			continue
+		}
+		replaced = append(replaced, kv)
+	}
+	cmd.Env = append(replaced, "HOME="+home, "USER="+name, "LOGNAME="+name)
+}
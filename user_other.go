@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package patchenv
+
+import "os/exec"
+
+// runAs returns an error, since this platform can't switch users without
+// the other user's credentials.
+func runAs(cmd *exec.Cmd, name string) error {
+	return errUserUnsupported
+}
@@ -0,0 +1,114 @@
+package patchenv
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// validityMu guards expiring and scheduled.
+	validityMu sync.Mutex
+
+	// expiring are the variables with expiration times that PatchWith
+	// set, and that haven't been dropped by a Refresher yet.
+	expiring []Var
+
+	// scheduled are the variables the last PatchWith left out because
+	// they weren't valid yet.
+	scheduled []Var
+)
+
+// applyValidity splits vars into the ones that are valid at now and the ones
+// that won't be valid until later, leaving out the ones that have expired.
+func (cfg *config) applyValidity(vars []Var, now time.Time) (valid, later []Var) {
+	for _, v := range vars {
+		switch {
+		case v.Unset:
+			valid = append(valid, v)
+		case !v.NotBefore.IsZero() && now.Before(v.NotBefore):
+			cfg.trace.printf("%s isn't valid until %s", v.Name, v.NotBefore.Format(time.RFC3339))
+			later = append(later, v)
+		case !v.Expires.IsZero() && !now.Before(v.Expires):
+			cfg.trace.printf("%s expired at %s", v.Name, v.Expires.Format(time.RFC3339))
+			cfg.provenance.expired = append(cfg.provenance.expired, v)
+		default:
+			valid = append(valid, v)
+		}
+	}
+	return valid, later
+}
+
+// recordValidity remembers the variables PatchWith set that expire, and the
+// ones it left out because they weren't valid yet, so a Refresher can act
+// when their validity starts or ends.
+func recordValidity(result *Result) {
+	validityMu.Lock()
+	defer validityMu.Unlock()
+	set := make(map[string]bool, len(result.Vars))
+	for _, v := range result.Vars {
+		set[v.Name] = true
+	}
+	kept := expiring[:0:0]
+	for _, v := range expiring {
+		if !set[v.Name] {
+			kept = append(kept, v)
+		}
+	}
+	for _, v := range result.Vars {
+		if !v.Unset && !v.Expires.IsZero() {
+			kept = append(kept, v)
+		}
+	}
+	expiring = kept
+	scheduled = append([]Var(nil), result.Scheduled...)
+}
+
+// nextValidityChange returns the first time after now that a variable PatchWith
+// set expires or one it left out becomes valid, or the zero time if there
+// isn't one.
+func nextValidityChange(now time.Time) time.Time {
+	validityMu.Lock()
+	defer validityMu.Unlock()
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, v := range expiring {
+		consider(v.Expires)
+	}
+	for _, v := range scheduled {
+		consider(v.NotBefore)
+	}
+	return next
+}
+
+// dropExpired unsets the variables PatchWith set that have expired at now
+// and that the last refresh didn't set again, if the environment still
+// holds their values, and adds them to result as unset.
+func dropExpired(result *Result, now time.Time) {
+	validityMu.Lock()
+	defer validityMu.Unlock()
+	set := make(map[string]bool, len(result.Vars))
+	for _, v := range result.Vars {
+		set[v.Name] = true
+	}
+	kept := expiring[:0:0]
+	for _, v := range expiring {
+		if now.Before(v.Expires) {
+			kept = append(kept, v)
+			continue
+		}
+		if set[v.Name] {
+			continue
+		}
+		if value, ok := os.LookupEnv(v.Name); ok && value == v.Value {
+			if err := os.Unsetenv(v.Name); err == nil {
+				result.Vars = append(result.Vars, Var{Name: v.Name, Unset: true})
+			}
+		}
+	}
+	expiring = kept
+}
@@ -0,0 +1,25 @@
+package patchenv
+
+import "log"
+
+// notifyWindows runs after PatchWith updates the environment when
+// WithWindowsBroadcast or WithWindowsPersist is used.  It saves vars in the
+// user's registry environment if persist is true, and then tells the other
+// windows on the desktop that the environment changed, so programs like
+// Explorer start new programs with the new values.
+func notifyWindows(vars []Var, persist bool) error {
+	if persist {
+		var saved []Var
+		for _, v := range vars {
+			if v.Secret {
+				log.Printf("[WARNING] patchenv: not saving secret %s in the registry", v.Name)
+				continue
+			}
+			saved = append(saved, v)
+		}
+		if err := persistUserEnv(saved); err != nil {
+			return err
+		}
+	}
+	return broadcastEnvChange()
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package patchenv
+
+// windowsEnvSupported is true if notifyWindows has an effect.
+const windowsEnvSupported = false
+
+// persistUserEnv saves vars in the registry's user environment.
+func persistUserEnv(vars []Var) error {
+	return nil
+}
+
+// broadcastEnvChange sends WM_SETTINGCHANGE to all top-level windows.
+func broadcastEnvChange() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package patchenv
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// windowsEnvSupported is true if notifyWindows has an effect.
+const windowsEnvSupported = true
+
+var (
+	advapi32 = syscall.NewLazyDLL("advapi32.dll")
+	user32   = syscall.NewLazyDLL("user32.dll")
+
+	procRegSetValueExW      = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteValueW     = advapi32.NewProc("RegDeleteValueW")
+	procSendMessageTimeoutW = user32.NewProc("SendMessageTimeoutW")
+)
+
+const (
+	// hwndBroadcast sends a message to all top-level windows.
+	hwndBroadcast = 0xffff
+
+	// wmSettingChange is the message that reports a changed setting.
+	wmSettingChange = 0x001a
+
+	// smtoAbortIfHung skips windows that aren't responding.
+	smtoAbortIfHung = 0x0002
+
+	// broadcastTimeoutMillis is how long each window has to handle the
+	// message.
+	broadcastTimeoutMillis = 5000
+)
+
+// persistUserEnv saves vars in the registry's user environment.
+func persistUserEnv(vars []Var) error {
+	var key syscall.Handle
+	err := syscall.RegOpenKeyEx(syscall.HKEY_CURRENT_USER, syscall.StringToUTF16Ptr("Environment"),
+		0, syscall.KEY_SET_VALUE, &key)
+	if err != nil {
+		return fmt.Errorf("patchenv: can't open the user environment: %w", err)
+	}
+	defer syscall.RegCloseKey(key)
+
+	for _, v := range vars {
+		name, err := syscall.UTF16PtrFromString(v.Name)
+		if err != nil {
+			return fmt.Errorf("patchenv: can't save %s in the registry: %w", v.Name, err)
+		}
+		if v.Unset {
+			r, _, _ := procRegDeleteValueW.Call(uintptr(key), uintptr(unsafe.Pointer(name)))
+			if r != 0 && syscall.Errno(r) != syscall.ERROR_FILE_NOT_FOUND {
+				return fmt.Errorf("patchenv: can't remove %s from the registry: %w", v.Name, syscall.Errno(r))
+			}
+			continue
+		}
+		data, err := syscall.UTF16FromString(v.Value)
+		if err != nil {
+			return fmt.Errorf("patchenv: can't save %s in the registry: %w", v.Name, err)
+		}
+		r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(name)), 0,
+			syscall.REG_SZ, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)*2))
+		if r != 0 {
+			return fmt.Errorf("patchenv: can't save %s in the registry: %w", v.Name, syscall.Errno(r))
+		}
+	}
+	return nil
+}
+
+// broadcastEnvChange sends WM_SETTINGCHANGE to all top-level windows.
+func broadcastEnvChange() error {
+	var result uintptr
+	r, _, err := procSendMessageTimeoutW.Call(hwndBroadcast, wmSettingChange, 0,
+		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("Environment"))),
+		smtoAbortIfHung, broadcastTimeoutMillis, uintptr(unsafe.Pointer(&result)))
+	if r == 0 {
+		return fmt.Errorf("patchenv: can't broadcast the environment change: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package patchenv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// wslMountRoot is the directory where WSL mounts Windows drives by
+	// default.
+	wslMountRoot = "/mnt/"
+
+	// wslDistroVar is set by WSL to the name of the running distribution.
+	wslDistroVar = "WSL_DISTRO_NAME"
+)
+
+// WindowsToWSLPath is a Transform that converts a Windows path to the path
+// of the same file in WSL, like "wslpath -u": a drive path like
+// C:\Users\me becomes /mnt/c/Users/me, and a path in a distribution's file
+// system like \\wsl.localhost\Ubuntu\home\me becomes /home/me.  Relative
+// paths only have their separators changed.  Drives are assumed to be
+// mounted under /mnt, the WSL default.
+func WindowsToWSLPath(value string) (string, error) {
+	switch {
+	case hasDriveLetter(value):
+		rest := strings.TrimLeft(strings.ReplaceAll(value[2:], `\`, "/"), "/")
+		path := wslMountRoot + strings.ToLower(value[:1])
+		if rest != "" {
+			path += "/" + rest
+		}
+		return path, nil
+	case strings.HasPrefix(value, `\\`):
+		parts := strings.SplitN(value[2:], `\`, 3)
+		host := strings.ToLower(parts[0])
+		if (host != "wsl$" && host != "wsl.localhost") || len(parts) < 2 {
+			return "", fmt.Errorf("can't convert network path %q to a WSL path", value)
+		}
+		if len(parts) == 2 {
+			return "/", nil
+		}
+		return "/" + strings.ReplaceAll(parts[2], `\`, "/"), nil
+	default:
+		return strings.ReplaceAll(value, `\`, "/"), nil
+	}
+}
+
+// WSLToWindowsPath is a Transform that converts a WSL path to the Windows
+// path of the same file, like "wslpath -w": a path under /mnt like
+// /mnt/c/Users/me becomes C:\Users\me, and other absolute paths become
+// paths under \\wsl.localhost\ for the distribution named in
+// WSL_DISTRO_NAME.  Relative paths only have their separators changed.
+func WSLToWindowsPath(value string) (string, error) {
+	if !strings.HasPrefix(value, "/") {
+		return strings.ReplaceAll(value, "/", `\`), nil
+	}
+	if rest := strings.TrimPrefix(value, wslMountRoot); rest != value && len(rest) > 0 &&
+		isASCIILetter(rest[0]) && (len(rest) == 1 || rest[1] == '/') {
+		return strings.ToUpper(rest[:1]) + `:\` + strings.ReplaceAll(strings.TrimPrefix(rest[1:], "/"), "/", `\`), nil
+	}
+	distro := os.Getenv(wslDistroVar)
+	if distro == "" {
+		return "", errors.New(wslDistroVar + " is not set")
+	}
+	return `\\wsl.localhost\` + distro + strings.ReplaceAll(value, "/", `\`), nil
+}
+
+// WindowsToWSLPathList is a Transform that converts a semicolon-separated
+// list of Windows paths, like a Windows PATH, to a colon-separated list of
+// WSL paths with WindowsToWSLPath.
+func WindowsToWSLPathList(value string) (string, error) {
+	return convertPathList(value, ";", ":", WindowsToWSLPath)
+}
+
+// WSLToWindowsPathList is a Transform that converts a colon-separated list
+// of WSL paths to a semicolon-separated list of Windows paths with
+// WSLToWindowsPath.
+func WSLToWindowsPathList(value string) (string, error) {
+	return convertPathList(value, ":", ";", WSLToWindowsPath)
+}
+
+// convertPathList splits value on from, converts each non-empty element
+// with t, and joins the results with to.
+func convertPathList(value, from, to string, t Transform) (string, error) {
+	elems := strings.Split(value, from)
+	for i, elem := range elems {
+		if elem == "" {
+			continue
+		}
+		converted, err := t(elem)
+		if err != nil {
+			return "", err
+		}
+		elems[i] = converted
+	}
+	return strings.Join(elems, to), nil
+}
+
+// hasDriveLetter reports whether path starts with a drive like "C:".
+func hasDriveLetter(path string) bool {
+	return len(path) >= 2 && isASCIILetter(path[0]) && path[1] == ':'
+}
+
+// isASCIILetter reports whether c is an ASCII letter.
+func isASCIILetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}